@@ -3,24 +3,51 @@ package bench
 import (
 	"chess/engine"
 	"chess/game"
+	"errors"
+	"flag"
 	"fmt"
+	"time"
 )
 
-func Bench() {
-	state := game.NewStartState(game.White)
-	game.PrintBoard(state.Board)
-	gameDone := false
-	turn := game.White
-	var ch chan *game.Move = make(chan *game.Move, 1)
-	for !gameDone {
-		fmt.Printf("%v to move\n", game.PlayerToString[turn])
-		engine.GetBestMove(state, turn, ch)
-		m := <-ch
-		if m.Capture != nil && state.Board[m.Capture.X][m.Capture.Y].Type == game.King {
-			gameDone = true
+// Run is the bench command: chess bench [flags]. It searches the bench positions to a fixed depth with one thread from
+// an empty table, so the total node count only changes when the search or the evaluation does
+func Run(args []string) error {
+	flags := flag.NewFlagSet("bench", flag.ContinueOnError)
+	depth := flags.Int("depth", 4, "depth to search every position to")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 0 {
+		return errors.New("usage: chess bench [flags]")
+	}
+	// the options of the user would change the search, a parameter file or network included
+	opts := engine.DefaultOptions
+	opts.Threads = 1
+	if err := engine.SetOptions(opts); err != nil {
+		return err
+	}
+
+	var nodes uint64
+	var total time.Duration
+	for i, fen := range engine.BenchPositions {
+		state, err := game.NewStateFromFEN(fen)
+		if err != nil {
+			return err
 		}
-		state.RunMove(*m)
-		game.PrintBoard(state.Board)
-		turn = (turn + 1) % 2
+		engine.NewGame()
+		var info engine.Info
+		start := time.Now()
+		engine.Think(state, state.Turn, engine.Limits{Depth: *depth, Infinite: true}, func(i engine.Info) {
+			info = i
+		})
+		took := time.Since(start)
+		nodes += info.Nodes
+		total += took
+		fmt.Printf("Position %v/%v: %v nodes, %v ms (%v)\n", i+1, len(engine.BenchPositions), info.Nodes, took.Milliseconds(), fen)
 	}
+	fmt.Println("===========================")
+	fmt.Printf("Total time (ms) : %v\n", total.Milliseconds())
+	fmt.Printf("Nodes searched  : %v\n", nodes)
+	fmt.Printf("Nodes/second    : %v\n", int(float64(nodes)/total.Seconds()))
+	return nil
 }
@@ -0,0 +1,263 @@
+package book
+
+import (
+	"chess/engine"
+	"chess/game"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+const maxWeight int = 0xFFFF
+
+var resultScores map[string]float64 = map[string]float64{"1-0": 1, "0-1": 0, "1/2-1/2": 0.5}
+
+// moveStats counts the games a move was played in, the results and ratings are the ones of the player making the move
+type moveStats struct {
+	san        string
+	move       uint16
+	games      int
+	wins       int
+	draws      int
+	losses     int
+	ratingSum  int
+	ratedGames int
+	weight     int
+}
+
+func (ms *moveStats) score() float64 {
+	return (float64(ms.wins) + float64(ms.draws)/2) / float64(ms.games)
+}
+
+type positionStats struct {
+	key   uint64
+	fen   string
+	games int
+	moves []*moveStats
+}
+
+type collection struct {
+	positions map[uint64]*positionStats
+	games     int
+	skipped   int
+	truncated int      // games ended before maxPly at a move the engine can't play, castling
+	read      int      // games read from the pgn file, numbering them from 1
+	invalid   []string // games ended at a move that couldn't be read, with their number and the move
+}
+
+// add replays a game up to maxPly, castling ends it early as the engine can't play it and so does a move that can't
+// be read, the moves before are kept
+func (c *collection) add(pgn *game.PGN, maxPly int, minRating int) {
+	c.read++
+	whiteScore, ok := resultScores[pgn.Result]
+	state, err := pgn.StartState()
+	if !ok || err != nil {
+		c.skipped++
+		return
+	}
+	ratings := map[game.Player]int{}
+	ratings[game.White], _ = strconv.Atoi(pgn.Tags["WhiteElo"])
+	ratings[game.Black], _ = strconv.Atoi(pgn.Tags["BlackElo"])
+	if minRating > 0 && (ratings[game.White] < minRating || ratings[game.Black] < minRating) {
+		c.skipped++
+		return
+	}
+	c.games++
+	player := state.Turn
+	for ply, san := range pgn.Moves {
+		if ply >= maxPly {
+			break
+		}
+		m, err := state.ParseSAN(san, player)
+		if errors.Is(err, game.ErrCastling) {
+			c.truncated++
+			break
+		}
+		if err != nil {
+			c.invalid = append(c.invalid, fmt.Sprintf("game %v, ply %v: %v", c.read, ply+1, err))
+			break
+		}
+		key := engine.PolyglotKey(state, player)
+		pos, ok := c.positions[key]
+		if !ok {
+			pos = &positionStats{key: key, fen: state.FEN()}
+			c.positions[key] = pos
+		}
+		pos.games++
+		move := engine.PolyglotMove(state, m)
+		var ms *moveStats
+		for _, s := range pos.moves {
+			if s.move == move {
+				ms = s
+			}
+		}
+		if ms == nil {
+			ms = &moveStats{san: san, move: move}
+			pos.moves = append(pos.moves, ms)
+		}
+		ms.games++
+		score := whiteScore
+		if player == game.Black {
+			score = 1 - whiteScore
+		}
+		if score == 1 {
+			ms.wins++
+		} else if score == 0 {
+			ms.losses++
+		} else {
+			ms.draws++
+		}
+		if ratings[player] > 0 {
+			ms.ratingSum += ratings[player]
+			ms.ratedGames++
+		}
+		state.RunMove(m)
+		player = (player + 1) % 2
+		state.Turn = player
+	}
+}
+
+// filter keeps the moves played in at least minGames games that scored at least minScore percent,
+// and weighs them as polyglot does by two points a win and one a draw, scaled down to fit the weight field
+func (c *collection) filter(minGames int, minScore float64) []*positionStats {
+	kept := []*positionStats{}
+	highest := 0
+	for _, pos := range c.positions {
+		moves := []*moveStats{}
+		for _, ms := range pos.moves {
+			ms.weight = 2*ms.wins + ms.draws
+			if ms.games >= minGames && ms.score()*100 >= minScore && ms.weight > 0 {
+				moves = append(moves, ms)
+				if ms.weight > highest {
+					highest = ms.weight
+				}
+			}
+		}
+		if len(moves) > 0 {
+			sort.SliceStable(moves, func(i, j int) bool {
+				return moves[i].games > moves[j].games
+			})
+			kept = append(kept, &positionStats{pos.key, pos.fen, pos.games, moves})
+		}
+	}
+	if highest > maxWeight {
+		for _, pos := range kept {
+			for _, ms := range pos.moves {
+				ms.weight = ms.weight*maxWeight/highest + 1
+				if ms.weight > maxWeight {
+					ms.weight = maxWeight
+				}
+			}
+		}
+	}
+	sort.Slice(kept, func(i, j int) bool {
+		if kept[i].games != kept[j].games {
+			return kept[i].games > kept[j].games
+		}
+		return kept[i].key < kept[j].key
+	})
+	return kept
+}
+
+func writeReport(path string, c *collection, positions []*positionStats) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	numMoves := 0
+	for _, pos := range positions {
+		numMoves += len(pos.moves)
+	}
+	fmt.Fprintf(file, "games: %v, skipped: %v, truncated: %v, invalid: %v, positions: %v, moves: %v\n", c.games, c.skipped,
+		c.truncated, len(c.invalid), len(positions), numMoves)
+	for _, invalid := range c.invalid {
+		fmt.Fprintf(file, "invalid %v\n", invalid)
+	}
+	w := tabwriter.NewWriter(file, 0, 0, 2, ' ', tabwriter.AlignRight)
+	for _, pos := range positions {
+		fmt.Fprintf(w, "\n%v (%v games)\n", pos.fen, pos.games)
+		fmt.Fprintln(w, "Move\tGames\tWins\tDraws\tLosses\tScore\tRating\tWeight\t")
+		for _, ms := range pos.moves {
+			rating := "-"
+			if ms.ratedGames > 0 {
+				rating = strconv.Itoa(ms.ratingSum / ms.ratedGames)
+			}
+			fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%.1f%%\t%v\t%v\t\n", ms.san, ms.games, ms.wins, ms.draws, ms.losses, ms.score()*100, rating, ms.weight)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Build is the book build command: chess book build [flags] <games.pgn> <out.bin>. Castling isn't supported, a game
+// is only added up to its first castling move and counted as truncated. A game with a move that can't be read is
+// added up to that move and counted as invalid, with its number in the pgn file
+func Build(args []string) error {
+	flags := flag.NewFlagSet("book build", flag.ContinueOnError)
+	maxPly := flags.Int("plies", 20, "number of plies of every game to add to the book")
+	minGames := flags.Int("min-games", 3, "minimum number of games a move was played in")
+	minScore := flags.Float64("min-score", 30, "minimum score of a move for the player making it, in percent")
+	minRating := flags.Int("min-rating", 0, "skip games with a player rated below this")
+	report := flags.String("report", "", "report file, the book file with a .txt extension by default")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: chess book build [flags] <games.pgn> <out.bin>")
+		fmt.Fprintln(flags.Output(), "castling isn't supported: games are added up to their first castling move, the truncated ones are counted")
+		fmt.Fprintln(flags.Output(), "games with a move that can't be read are added up to that move and listed as invalid")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return errors.New("expected a pgn file and a book file")
+	}
+	file, err := os.Open(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	c := &collection{positions: map[uint64]*positionStats{}}
+	reader := game.NewPGNReader(file)
+	for {
+		pgn, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("%v: %v", flags.Arg(0), err)
+		}
+		c.add(pgn, *maxPly, *minRating)
+	}
+	positions := c.filter(*minGames, *minScore)
+	entries := []engine.PolyglotEntry{}
+	for _, pos := range positions {
+		for _, ms := range pos.moves {
+			entries = append(entries, engine.PolyglotEntry{Key: pos.key, Move: ms.move, Weight: uint16(ms.weight)})
+		}
+	}
+	if err := engine.WritePolyglotBook(flags.Arg(1), entries); err != nil {
+		return err
+	}
+	if *report == "" {
+		*report = strings.TrimSuffix(flags.Arg(1), ".bin") + ".txt"
+	}
+	if err := writeReport(*report, c, positions); err != nil {
+		return err
+	}
+	for _, invalid := range c.invalid {
+		fmt.Printf("invalid %v\n", invalid)
+	}
+	fmt.Printf("games: %v, skipped: %v, truncated: %v, invalid: %v, positions: %v, entries: %v\n", c.games, c.skipped,
+		c.truncated, len(c.invalid), len(positions), len(entries))
+	return nil
+}
@@ -0,0 +1,234 @@
+package clock
+
+import (
+	"chess/game"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Period is a part of a time control: Time for Moves moves, 0 for the rest of the game, with an increment or a delay
+// on every move
+type Period struct {
+	Moves     int
+	Time      time.Duration
+	Increment time.Duration // Fischer, added after every move
+	Delay     time.Duration
+	// the delay is given back after the move up to the time it took, instead of passing before the clock runs (simple delay)
+	Bronstein bool
+}
+
+// TimeControl are the periods of a game, the last one is played again when its moves are made
+type TimeControl []Period
+
+// periodRegexp is a period: moves/minutes, then +seconds of increment, d seconds of simple delay or b seconds of
+// Bronstein delay ("40/90+30", "5+3", "5d2")
+var periodRegexp *regexp.Regexp = regexp.MustCompile(`^(?:(\d+)/)?(\d+(?:\.\d+)?)(?:([+db])(\d+(?:\.\d+)?))?$`)
+
+// Parse reads a time control of periods separated by commas, like "40/90+30,30+30"
+func Parse(s string) (TimeControl, error) {
+	tc := TimeControl{}
+	parts := strings.Split(s, ",")
+	for i, part := range parts {
+		m := periodRegexp.FindStringSubmatch(strings.TrimSpace(part))
+		if m == nil {
+			return nil, fmt.Errorf("invalid time control %q", s)
+		}
+		p := Period{}
+		if m[1] != "" {
+			p.Moves, _ = strconv.Atoi(m[1])
+		}
+		minutes, _ := strconv.ParseFloat(m[2], 64)
+		p.Time = time.Duration(minutes * float64(time.Minute))
+		if m[3] != "" {
+			seconds, _ := strconv.ParseFloat(m[4], 64)
+			bonus := time.Duration(seconds * float64(time.Second))
+			switch m[3] {
+			case "+":
+				p.Increment = bonus
+			case "d":
+				p.Delay = bonus
+			case "b":
+				p.Delay, p.Bronstein = bonus, true
+			}
+		}
+		if p.Time <= 0 && p.Increment <= 0 && p.Delay <= 0 {
+			return nil, fmt.Errorf("invalid time control %q: no time", s)
+		}
+		if p.Moves == 0 && i != len(parts)-1 {
+			return nil, fmt.Errorf("invalid time control %q: only the last period can be for the rest of the game", s)
+		}
+		tc = append(tc, p)
+	}
+	return tc, nil
+}
+
+func (tc TimeControl) String() string {
+	parts := []string{}
+	for _, p := range tc {
+		s := strconv.FormatFloat(p.Time.Minutes(), 'f', -1, 64)
+		if p.Moves > 0 {
+			s = fmt.Sprintf("%v/%v", p.Moves, s)
+		}
+		if p.Increment > 0 {
+			s += "+" + strconv.FormatFloat(p.Increment.Seconds(), 'f', -1, 64)
+		} else if p.Delay > 0 && p.Bronstein {
+			s += "b" + strconv.FormatFloat(p.Delay.Seconds(), 'f', -1, 64)
+		} else if p.Delay > 0 {
+			s += "d" + strconv.FormatFloat(p.Delay.Seconds(), 'f', -1, 64)
+		}
+		parts = append(parts, s)
+	}
+	return strings.Join(parts, ",")
+}
+
+// Clock is the clock of the two players of a game, it runs for at most one of them. It is a value, a copy is a
+// snapshot that can be restored
+type Clock struct {
+	tc      TimeControl
+	left    [2]time.Duration
+	moves   [2]int // moves made in the current period
+	period  [2]int
+	running game.Player // NilPlayer while stopped
+	started time.Time   // when the move of the running player started
+	flagged game.Player // the player out of time, NilPlayer while both have time
+	now     func() time.Time
+}
+
+// New is a stopped clock with the time of the first period for both players, now tells the time (time.Now when nil)
+func New(tc TimeControl, now func() time.Time) *Clock {
+	if now == nil {
+		now = time.Now
+	}
+	c := &Clock{tc: tc, running: game.NilPlayer, flagged: game.NilPlayer, now: now}
+	for _, p := range game.Players {
+		c.left[p] = tc[0].Time
+	}
+	return c
+}
+
+func (c *Clock) current(player game.Player) Period {
+	return c.tc[c.period[player]]
+}
+
+// used is the time the move of the running player took from its clock up to now, the simple delay passes first
+func (c *Clock) used(now time.Time) time.Duration {
+	elapsed := now.Sub(c.started)
+	if p := c.current(c.running); p.Delay > 0 && !p.Bronstein {
+		elapsed -= p.Delay
+		if elapsed < 0 {
+			elapsed = 0
+		}
+	}
+	return elapsed
+}
+
+// Start runs the clock of player from now, without taking time from the player it ran for
+func (c *Clock) Start(player game.Player) {
+	c.running, c.started = player, c.now()
+}
+
+// Stop takes the time of the move from the running player and stops the clock, for the end of the game
+func (c *Clock) Stop() {
+	c.stop(c.now())
+}
+
+func (c *Clock) stop(now time.Time) {
+	if c.running == game.NilPlayer {
+		return
+	}
+	c.left[c.running] -= c.used(now)
+	if c.left[c.running] <= 0 {
+		c.left[c.running] = 0
+		c.flagged = c.running
+	}
+	c.running = game.NilPlayer
+}
+
+// Press ends the move of the running player: its time is taken, the increment or Bronstein delay given, the next
+// period started when its moves are made, and the clock of the opponent runs
+func (c *Clock) Press() {
+	player := c.running
+	if player == game.NilPlayer {
+		return
+	}
+	p := c.current(player)
+	now := c.now()
+	elapsed := now.Sub(c.started)
+	c.stop(now)
+	if c.flagged == player {
+		return
+	}
+	if p.Bronstein && elapsed < p.Delay {
+		c.left[player] += elapsed
+	} else if p.Bronstein {
+		c.left[player] += p.Delay
+	}
+	c.left[player] += p.Increment
+	c.moves[player]++
+	if p.Moves > 0 && c.moves[player] == p.Moves {
+		c.moves[player] = 0
+		if c.period[player] < len(c.tc)-1 {
+			c.period[player]++
+		}
+		c.left[player] += c.current(player).Time
+	}
+	c.running, c.started = (player+1)%2, now
+}
+
+// Left is the time player has left, counting down while its clock runs
+func (c *Clock) Left(player game.Player) time.Duration {
+	left := c.left[player]
+	if player == c.running {
+		left -= c.used(c.now())
+	}
+	if left < 0 {
+		return 0
+	}
+	return left
+}
+
+// Running is the player the clock runs for, NilPlayer while stopped
+func (c *Clock) Running() game.Player {
+	return c.running
+}
+
+// Flagged is the player out of time, NilPlayer while both have time
+func (c *Clock) Flagged() game.Player {
+	if c.flagged == game.NilPlayer && c.running != game.NilPlayer && c.Left(c.running) <= 0 {
+		c.flagged = c.running
+	}
+	return c.flagged
+}
+
+// MovesToGo are the moves player has to make in the current period, 0 for the rest of the game
+func (c *Clock) MovesToGo(player game.Player) int {
+	p := c.current(player)
+	if p.Moves == 0 {
+		return 0
+	}
+	return p.Moves - c.moves[player]
+}
+
+// Increment is the time player gets a move on top of its time, the increment or the delay of the current period
+func (c *Clock) Increment(player game.Player) time.Duration {
+	p := c.current(player)
+	return p.Increment + p.Delay
+}
+
+// Format writes a time left as h:mm:ss, m:ss or with tenths of seconds under ten seconds
+func Format(d time.Duration) string {
+	if d < 0 {
+		d = 0
+	}
+	if d < 10*time.Second {
+		return fmt.Sprintf("%d.%d", int(d.Seconds()), int(d/(100*time.Millisecond))%10)
+	}
+	s := int(d.Seconds())
+	if s >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", s/3600, s/60%60, s%60)
+	}
+	return fmt.Sprintf("%d:%02d", s/60, s%60)
+}
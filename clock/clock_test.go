@@ -0,0 +1,197 @@
+package clock
+
+import (
+	"chess/game"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		s    string
+		want TimeControl
+	}{
+		{"5+3", TimeControl{{Time: 5 * time.Minute, Increment: 3 * time.Second}}},
+		{"1.5", TimeControl{{Time: 90 * time.Second}}},
+		{"5d2", TimeControl{{Time: 5 * time.Minute, Delay: 2 * time.Second}}},
+		{"5b2", TimeControl{{Time: 5 * time.Minute, Delay: 2 * time.Second, Bronstein: true}}},
+		{"40/90+30,30+30", TimeControl{
+			{Moves: 40, Time: 90 * time.Minute, Increment: 30 * time.Second},
+			{Time: 30 * time.Minute, Increment: 30 * time.Second},
+		}},
+		{"40/120,20/60,15", TimeControl{
+			{Moves: 40, Time: 120 * time.Minute},
+			{Moves: 20, Time: 60 * time.Minute},
+			{Time: 15 * time.Minute},
+		}},
+	}
+	for _, test := range tests {
+		tc, err := Parse(test.s)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", test.s, err)
+			continue
+		}
+		if len(tc) != len(test.want) {
+			t.Errorf("Parse(%q) = %v, want %v", test.s, tc, test.want)
+			continue
+		}
+		for i := range tc {
+			if tc[i] != test.want[i] {
+				t.Errorf("Parse(%q) period %v = %+v, want %+v", test.s, i, tc[i], test.want[i])
+			}
+		}
+		if s := tc.String(); s != test.s {
+			t.Errorf("Parse(%q).String() = %q", test.s, s)
+		}
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, s := range []string{"", "0", "5+", "5x3", "40/", "/90", "40/90,5+3,30", "5+3,40/90"} {
+		if tc, err := Parse(s); err == nil {
+			t.Errorf("Parse(%q) = %v, want an error", s, tc)
+		}
+	}
+}
+
+// fakeTime is a clock source that only moves when told to
+type fakeTime struct {
+	t time.Time
+}
+
+func (f *fakeTime) now() time.Time {
+	return f.t
+}
+
+func (f *fakeTime) advance(d time.Duration) {
+	f.t = f.t.Add(d)
+}
+
+func newClock(t *testing.T, s string) (*Clock, *fakeTime) {
+	tc, err := Parse(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeTime{t: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)}
+	return New(tc, f.now), f
+}
+
+func checkLeft(t *testing.T, c *Clock, player game.Player, want time.Duration) {
+	t.Helper()
+	if left := c.Left(player); left != want {
+		t.Errorf("%v has %v left, want %v", game.PlayerToString[player], left, want)
+	}
+}
+
+func TestIncrement(t *testing.T) {
+	c, f := newClock(t, "5+3")
+	c.Start(game.White)
+	f.advance(10 * time.Second)
+	checkLeft(t, c, game.White, 4*time.Minute+50*time.Second)
+	checkLeft(t, c, game.Black, 5*time.Minute)
+	c.Press()
+	if c.Running() != game.Black {
+		t.Errorf("the clock runs for %v after white pressed", c.Running())
+	}
+	checkLeft(t, c, game.White, 4*time.Minute+53*time.Second)
+	f.advance(2 * time.Second)
+	checkLeft(t, c, game.Black, 4*time.Minute+58*time.Second)
+	c.Press()
+	checkLeft(t, c, game.Black, 5*time.Minute+time.Second)
+	if inc := c.Increment(game.White); inc != 3*time.Second {
+		t.Errorf("increment %v, want 3s", inc)
+	}
+}
+
+func TestSimpleDelay(t *testing.T) {
+	c, f := newClock(t, "5d2")
+	c.Start(game.White)
+	f.advance(time.Second)
+	checkLeft(t, c, game.White, 5*time.Minute) // the delay passes first
+	f.advance(4 * time.Second)
+	checkLeft(t, c, game.White, 5*time.Minute-3*time.Second)
+	c.Press()
+	checkLeft(t, c, game.White, 5*time.Minute-3*time.Second)
+	f.advance(2 * time.Second)
+	c.Press()
+	checkLeft(t, c, game.Black, 5*time.Minute)
+}
+
+func TestBronsteinDelay(t *testing.T) {
+	c, f := newClock(t, "5b2")
+	c.Start(game.White)
+	f.advance(time.Second)
+	checkLeft(t, c, game.White, 5*time.Minute-time.Second) // the time runs from the start of the move
+	c.Press()
+	checkLeft(t, c, game.White, 5*time.Minute) // the refund is the time used under the delay
+	f.advance(5 * time.Second)
+	c.Press()
+	checkLeft(t, c, game.Black, 5*time.Minute-3*time.Second) // and the delay over it
+}
+
+func TestPeriods(t *testing.T) {
+	c, f := newClock(t, "2/1,1+1")
+	c.Start(game.White)
+	for move := 0; move < 2; move++ {
+		if togo := c.MovesToGo(game.White); togo != 2-move {
+			t.Errorf("move %v: %v moves to go, want %v", move, togo, 2-move)
+		}
+		f.advance(10 * time.Second)
+		c.Press()
+		f.advance(5 * time.Second)
+		c.Press()
+	}
+	// the second period adds its time to what is left of the first one
+	checkLeft(t, c, game.White, 100*time.Second)
+	checkLeft(t, c, game.Black, 110*time.Second)
+	if togo := c.MovesToGo(game.White); togo != 0 {
+		t.Errorf("%v moves to go in the last period, want 0", togo)
+	}
+	f.advance(5 * time.Second)
+	c.Press()
+	checkLeft(t, c, game.White, 96*time.Second)
+}
+
+func TestLastPeriodRepeats(t *testing.T) {
+	c, f := newClock(t, "1/1")
+	c.Start(game.White)
+	for move := 0; move < 3; move++ {
+		f.advance(20 * time.Second)
+		c.Press()
+		c.Press()
+	}
+	checkLeft(t, c, game.White, 3*time.Minute)
+	checkLeft(t, c, game.Black, 4*time.Minute)
+}
+
+func TestFlagged(t *testing.T) {
+	c, f := newClock(t, "1+0")
+	c.Start(game.White)
+	f.advance(59 * time.Second)
+	if flagged := c.Flagged(); flagged != game.NilPlayer {
+		t.Errorf("%v flagged with time left", game.PlayerToString[flagged])
+	}
+	f.advance(2 * time.Second)
+	checkLeft(t, c, game.White, 0)
+	if flagged := c.Flagged(); flagged != game.White {
+		t.Errorf("flagged %v, want white", flagged)
+	}
+	c.Press()
+	if c.Running() != game.NilPlayer {
+		t.Errorf("the clock runs for %v after the flag fell", c.Running())
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	c, f := newClock(t, "5+0")
+	c.Start(game.White)
+	f.advance(10 * time.Second)
+	c.Press()
+	snapshot := *c
+	f.advance(time.Minute)
+	c.Press()
+	*c = snapshot
+	c.Start(game.Black)
+	checkLeft(t, c, game.Black, 5*time.Minute)
+	checkLeft(t, c, game.White, 4*time.Minute+50*time.Second)
+}
@@ -0,0 +1,234 @@
+package engine
+
+import (
+	"chess/game"
+	"chess/util"
+)
+
+const (
+	minKingAttackersForDanger int = 2
+	minOutpostRank            int = 3
+	maxOutpostRank            int = 5
+)
+
+// attackInfo is the attack map of both players used by the evaluation terms
+type attackInfo struct {
+	counts       [2][8][8]int  // number of pieces of the player attacking the square
+	pawnAttacks  [2][8][8]bool // square attacked by a pawn of the player
+	pawnFiles    [2][8]int     // number of pawns of the player on the file
+	pieceAttacks [8][8][]game.Pos
+	kings        [2]*game.Pos
+}
+
+func newAttackInfo(state *game.State) *attackInfo {
+	info := &attackInfo{}
+	for i := 0; i <= 7; i++ {
+		for j := 0; j <= 7; j++ {
+			piece := state.Board[i][j]
+			if piece == nil {
+				continue
+			}
+			info.pieceAttacks[i][j] = state.GetPieceAttacks(game.Pos{X: i, Y: j})
+			for _, p := range info.pieceAttacks[i][j] {
+				info.counts[piece.Owner][p.X][p.Y]++
+				if piece.Type == game.Pawn {
+					info.pawnAttacks[piece.Owner][p.X][p.Y] = true
+				}
+			}
+			if piece.Type == game.Pawn {
+				info.pawnFiles[piece.Owner][j]++
+			}
+			if piece.Type == game.King {
+				info.kings[piece.Owner] = &game.Pos{X: i, Y: j}
+			}
+		}
+	}
+	return info
+}
+
+// safe squares are the ones not taken by own pieces and not attacked by opponent pawns
+func evalMobility(state *game.State, player game.Player, info *attackInfo) (int, int) {
+	var mg, eg int = 0, 0
+	oppPlayer := (player + 1) % 2
+	for i := 0; i <= 7; i++ {
+		for j := 0; j <= 7; j++ {
+			piece := state.Board[i][j]
+			if piece == nil || piece.Owner != player || piece.Type == game.Pawn || piece.Type == game.King {
+				continue
+			}
+			mobility := 0
+			for _, p := range info.pieceAttacks[i][j] {
+				if (state.Board[p.X][p.Y] == nil || state.Board[p.X][p.Y].Owner != player) && !info.pawnAttacks[oppPlayer][p.X][p.Y] {
+					mobility++
+				}
+			}
+			mg += params.Mobility[piece.Type] * (mobility - params.MobilityBaseline[piece.Type])
+			eg += params.MobilityEndGame[piece.Type] * (mobility - params.MobilityBaseline[piece.Type])
+		}
+	}
+	return mg, eg
+}
+
+func kingZone(state *game.State, player game.Player, king game.Pos) []game.Pos {
+	zone := []game.Pos{king}
+	dir := pawnDir(state, player)
+	for _, offset := range []game.Pos{{X: 1, Y: 1}, {X: -1, Y: -1}, {X: -1, Y: 1}, {X: 1, Y: -1}, {X: 1, Y: 0}, {X: 0, Y: 1}, {X: -1, Y: 0}, {X: 0, Y: -1}, {X: 2 * dir, Y: -1}, {X: 2 * dir, Y: 0}, {X: 2 * dir, Y: 1}} {
+		if p := king.Add(offset); game.OnBoard(p) {
+			zone = append(zone, p)
+		}
+	}
+	return zone
+}
+
+// evalKingSafety is the (negative) safety of the king of player: attacks into the king zone, the pawn shield and open files next to the king
+func evalKingSafety(state *game.State, player game.Player, info *attackInfo) (int, int) {
+	var mg, eg int = 0, 0
+	king := info.kings[player]
+	if king == nil {
+		return 0, 0
+	}
+	oppPlayer := (player + 1) % 2
+	var zone [8][8]bool
+	for _, p := range kingZone(state, player, *king) {
+		zone[p.X][p.Y] = true
+	}
+	attackers := 0
+	attackUnits := 0
+	for i := 0; i <= 7; i++ {
+		for j := 0; j <= 7; j++ {
+			piece := state.Board[i][j]
+			if piece == nil || piece.Owner != oppPlayer || params.KingAttackWeight[piece.Type] == 0 {
+				continue
+			}
+			hits := 0
+			for _, p := range info.pieceAttacks[i][j] {
+				if zone[p.X][p.Y] {
+					hits++
+				}
+			}
+			if hits > 0 {
+				attackers++
+				attackUnits += params.KingAttackWeight[piece.Type] * hits
+			}
+		}
+	}
+	if attackers >= minKingAttackersForDanger {
+		mg -= util.Min(attackUnits*attackUnits/params.KingDangerDivisor, params.MaxKingDanger)
+	}
+	eg -= attackUnits * params.KingDangerEndGame
+
+	dir := pawnDir(state, player)
+	isOnBackRanks := relativeRank(state, player, king.X) <= 1
+	for col := king.Y - 1; col <= king.Y+1; col++ {
+		if col < 0 || col > 7 {
+			continue
+		}
+		if isOnBackRanks {
+			if isPawnOf(state, game.Pos{X: king.X + dir, Y: col}, player) {
+				mg += params.PawnShield
+			} else if isPawnOf(state, game.Pos{X: king.X + 2*dir, Y: col}, player) {
+				mg += params.PawnShieldFar
+			} else {
+				mg -= params.MissingPawnShield
+			}
+		}
+		if info.pawnFiles[player][col] == 0 {
+			mg -= params.KingSemiOpenFile
+			if info.pawnFiles[oppPlayer][col] == 0 {
+				mg -= params.KingOpenFile
+			}
+		}
+	}
+	return mg, eg
+}
+
+func isPawnOf(state *game.State, pos game.Pos, player game.Player) bool {
+	return game.OnBoard(pos) && state.Board[pos.X][pos.Y] != nil && state.Board[pos.X][pos.Y].Type == game.Pawn && state.Board[pos.X][pos.Y].Owner == player
+}
+
+// evalPieces scores the bishop pair, rooks on open files and the 7th rank and knight outposts
+func evalPieces(state *game.State, player game.Player, info *attackInfo) (int, int) {
+	var mg, eg int = 0, 0
+	oppPlayer := (player + 1) % 2
+	dir := pawnDir(state, player)
+	numBishops := 0
+	for i := 0; i <= 7; i++ {
+		for j := 0; j <= 7; j++ {
+			piece := state.Board[i][j]
+			if piece == nil || piece.Owner != player {
+				continue
+			}
+			rank := relativeRank(state, player, i)
+			switch piece.Type {
+			case game.Bishop:
+				numBishops++
+			case game.Rook:
+				if info.pawnFiles[player][j] == 0 {
+					if info.pawnFiles[oppPlayer][j] == 0 {
+						mg += params.RookOpenFile
+						eg += params.RookOpenFileEndGame
+					} else {
+						mg += params.RookSemiOpenFile
+						eg += params.RookSemiOpenFileEndGame
+					}
+				}
+				if rank == 6 {
+					oppKing := info.kings[oppPlayer]
+					oppPawnsOnRank := false
+					for col := 0; col <= 7; col++ {
+						if isPawnOf(state, game.Pos{X: i, Y: col}, oppPlayer) {
+							oppPawnsOnRank = true
+						}
+					}
+					if oppPawnsOnRank || (oppKing != nil && relativeRank(state, player, oppKing.X) == 7) {
+						mg += params.RookSeventhRank
+						eg += params.RookSeventhRankEndGame
+					}
+				}
+			case game.Knight:
+				if rank < minOutpostRank || rank > maxOutpostRank || !info.pawnAttacks[player][i][j] {
+					continue
+				}
+				canBeChased := false
+				for _, col := range []int{j - 1, j + 1} {
+					for row := i + dir; row >= 0 && row <= 7; row += dir {
+						if isPawnOf(state, game.Pos{X: row, Y: col}, oppPlayer) {
+							canBeChased = true
+						}
+					}
+				}
+				if !canBeChased {
+					mg += params.KnightOutpost
+					eg += params.KnightOutpostEndGame
+				}
+			}
+		}
+	}
+	if numBishops >= 2 {
+		mg += params.BishopPair
+		eg += params.BishopPairEndGame
+	}
+	return mg, eg
+}
+
+// evalThreats rewards player for opponent pieces attacked by its pawns or attacked and not defended at all
+func evalThreats(state *game.State, player game.Player, info *attackInfo) (int, int) {
+	var mg, eg int = 0, 0
+	oppPlayer := (player + 1) % 2
+	for i := 0; i <= 7; i++ {
+		for j := 0; j <= 7; j++ {
+			piece := state.Board[i][j]
+			if piece == nil || piece.Owner != oppPlayer || piece.Type == game.King || piece.Type == game.Pawn {
+				continue
+			}
+			if info.pawnAttacks[player][i][j] {
+				mg += params.ThreatByPawn
+				eg += params.ThreatByPawnEndGame
+			} else if info.counts[player][i][j] > 0 && info.counts[oppPlayer][i][j] == 0 {
+				mg += params.HangingPiece
+				eg += params.HangingPieceEndGame
+			}
+		}
+	}
+	return mg, eg
+}
@@ -0,0 +1,69 @@
+package engine
+
+import (
+	"chess/game"
+	"testing"
+)
+
+// benchStates are new states of the bench positions for a benchmark, that no other benchmark changes
+func benchStates(b *testing.B) []*game.State {
+	if transpositionEvals == nil {
+		Init()
+	}
+	states := []*game.State{}
+	for _, fen := range BenchPositions {
+		state, err := game.NewStateFromFEN(fen)
+		if err != nil {
+			b.Fatal(err)
+		}
+		states = append(states, state)
+	}
+	return states
+}
+
+// BenchmarkGetMoves generates the moves of the side to move of the bench positions
+func BenchmarkGetMoves(b *testing.B) {
+	states := benchStates(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		state := states[i%len(states)]
+		state.GetMoves(state.Turn)
+	}
+}
+
+// BenchmarkMakeUnmake runs and reverses every move of the bench positions with the incremental hash, as the search does
+func BenchmarkMakeUnmake(b *testing.B) {
+	states := benchStates(b)
+	moves := [][]game.Move{}
+	for _, state := range states {
+		moves = append(moves, getEngineMoves(state, state.Turn))
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		state := states[i%len(states)]
+		hash := Hash(state)
+		for _, m := range moves[i%len(states)] {
+			_, undo := makeMove(state, &m, hash)
+			unmakeMove(state, &m, undo)
+		}
+	}
+}
+
+// BenchmarkEvalState evaluates the bench positions through the evaluation cache, with keys that miss it
+func BenchmarkEvalState(b *testing.B) {
+	states := benchStates(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		state := states[i%len(states)]
+		evalState(state, state.Turn, uint64(i)*0x9E3779B97F4A7C15, nil)
+	}
+}
+
+// BenchmarkHash hashes the bench positions from scratch
+func BenchmarkHash(b *testing.B) {
+	states := benchStates(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		Hash(states[i%len(states)])
+	}
+}
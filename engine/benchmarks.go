@@ -0,0 +1,18 @@
+package engine
+
+// BenchPositions are searched by the bench command and used by the benchmarks of bench_test.go: openings, middle
+// games with tactics and endgames
+var BenchPositions []string = []string{
+	"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w - - 0 1",
+	"r1bqkbnr/pppp1ppp/2n5/4p3/4P3/5N2/PPPP1PPP/RNBQKB1R w - - 2 3",
+	"rnbqkb1r/pp2pppp/3p1n2/8/3NP3/8/PPP2PPP/RNBQKB1R w - - 1 5",
+	"r2q1rk1/pp2bppp/2n1pn2/3p4/3P4/2NBPN2/PP3PPP/R2Q1RK1 w - - 0 10",
+	"r1bq1rk1/ppp2ppp/2np1n2/2b1p3/2B1P3/2NP1N2/PPP2PPP/R1BQ1RK1 w - - 0 7",
+	"2r3k1/pp3ppp/2n1b3/q2pP3/3P4/P1PB1N2/5PPP/R2Q2K1 b - - 0 20",
+	"r4rk1/1b2qppp/p3pn2/1p6/3P4/P1NB1N2/1P3PPP/R2Q1RK1 w - - 0 15",
+	"6k1/5ppp/8/8/8/8/5PPP/3R2K1 w - - 0 30",
+	"8/8/4k3/3p4/3P4/4K3/8/8 w - - 0 40",
+	"8/5pk1/6p1/8/2B5/6P1/5PK1/8 w - - 0 45",
+	"4k3/8/8/8/8/8/4P3/4K3 w - - 0 50",
+	"8/8/8/3k4/8/8/2RK4/8 w - - 0 60",
+}
@@ -0,0 +1,283 @@
+package engine
+
+import (
+	"bufio"
+	"chess/game"
+	_ "embed"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// the default book, opening lines in SAN
+//
+//go:embed openings/openings.txt
+var openingLines string
+
+var polyglotPieceKind map[game.PieceType]int = map[game.PieceType]int{
+	game.Pawn: 0, game.Knight: 1, game.Bishop: 2, game.Rook: 3, game.Queen: 4, game.King: 5,
+}
+
+var commentRegexp *regexp.Regexp = regexp.MustCompile(`\([^)]*\)|\{[^}]*\}`)
+
+var polyglotConvertTypes []game.PieceType = []game.PieceType{game.NilPiece, game.Knight, game.Bishop, game.Rook, game.Queen}
+
+type bookMove struct {
+	from        int // squares counted from a1 as seen by white
+	to          int
+	convertType game.PieceType
+	weight      int
+}
+
+// Book maps the polyglot key of a position to the moves played from it
+type Book struct {
+	positions map[uint64][]bookMove
+}
+
+var book *Book
+
+func newBook() *Book {
+	return &Book{positions: map[uint64][]bookMove{}}
+}
+
+// OpeningLines are the lines of the built in book, one opening in SAN per line
+func OpeningLines() []string {
+	return strings.Split(strings.TrimSpace(openingLines), "\n")
+}
+
+// loadBook reads a polyglot book if path ends in .bin and opening lines otherwise, the built in lines are used when path is empty
+func loadBook(path string) (*Book, error) {
+	if path == "" {
+		return parseBookLines(strings.NewReader(openingLines))
+	}
+	if strings.HasSuffix(path, ".bin") {
+		return loadPolyglotBook(path)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	b, err := parseBookLines(file)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", path, err)
+	}
+	return b, nil
+}
+
+// parseBookLines reads one opening per line ("1.e4 e5 2.Nf3 Nc6"), every time a move is played in a line its weight goes up by one.
+// A line ends at the first word that is not a move the engine can play, so notes ("or 5.e3") and castling end it
+func parseBookLines(r io.Reader) (*Book, error) {
+	b := newBook()
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		state := game.NewStartState(game.White)
+		player := game.White
+		for _, token := range strings.Fields(commentRegexp.ReplaceAllString(scanner.Text(), " ")) {
+			san := strings.TrimRight(strings.TrimLeft(token, "0123456789."), ",;")
+			if san == "" || san == "*" || san == "1-0" || san == "0-1" || san == "1/2-1/2" {
+				continue
+			}
+			m, err := state.ParseSAN(san, player)
+			if err != nil {
+				break
+			}
+			b.add(PolyglotKey(state, player), state, m, 1)
+			state.RunMove(m)
+			player = (player + 1) % 2
+		}
+	}
+	return b, scanner.Err()
+}
+
+func (b *Book) add(key uint64, state *game.State, m game.Move, weight int) {
+	from, to := whiteSquare(state.Starter, m.Start), whiteSquare(state.Starter, m.End)
+	moves := b.positions[key]
+	for i := range moves {
+		if moves[i].from == from && moves[i].to == to && moves[i].convertType == m.ConvertType {
+			moves[i].weight += weight
+			return
+		}
+	}
+	b.positions[key] = append(moves, bookMove{from, to, m.ConvertType, weight})
+}
+
+// loadPolyglotBook reads the 16 byte big endian entries of a polyglot book: key, move, weight and learn data
+func loadPolyglotBook(path string) (*Book, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(data)%16 != 0 {
+		return nil, fmt.Errorf("%v: not a polyglot book", path)
+	}
+	b := newBook()
+	for i := 0; i < len(data); i += 16 {
+		key := binary.BigEndian.Uint64(data[i:])
+		move := int(binary.BigEndian.Uint16(data[i+8:]))
+		weight := int(binary.BigEndian.Uint16(data[i+10:]))
+		convert := (move >> 12) & 7
+		if convert >= len(polyglotConvertTypes) {
+			return nil, fmt.Errorf("%v: bad move in entry %v", path, i/16)
+		}
+		b.positions[key] = append(b.positions[key], bookMove{
+			from:        (move >> 6) & 63,
+			to:          move & 63,
+			convertType: polyglotConvertTypes[convert],
+			weight:      weight,
+		})
+	}
+	return b, nil
+}
+
+// PolyglotKey is the hash of the position with player to move used by polyglot books
+func PolyglotKey(state *game.State, player game.Player) uint64 {
+	var key uint64 = 0
+	for i := 0; i <= 7; i++ {
+		for j := 0; j <= 7; j++ {
+			piece := state.Board[i][j]
+			if piece == nil {
+				continue
+			}
+			kind := polyglotPieceKind[piece.Type] * 2
+			if piece.Owner == game.White {
+				kind++
+			}
+			key ^= polyglotRandom[64*kind+whiteSquare(state.Starter, game.Pos{X: i, Y: j})]
+		}
+	}
+	if state.CanCastleShort[game.White] {
+		key ^= polyglotRandom[768]
+	}
+	if state.CanCastleLong[game.White] {
+		key ^= polyglotRandom[769]
+	}
+	if state.CanCastleShort[game.Black] {
+		key ^= polyglotRandom[770]
+	}
+	if state.CanCastleLong[game.Black] {
+		key ^= polyglotRandom[771]
+	}
+	// en passant only counts when a pawn of player can take the pawn that moved two squares
+	if p := state.PassantPos; p != nil {
+		pawn := state.Board[p.X][p.Y]
+		if pawn != nil && pawn.Type == game.Pawn && pawn.Owner != player && relativeRank(state, pawn.Owner, p.X) == 3 {
+			for _, y := range []int{p.Y - 1, p.Y + 1} {
+				if y >= 0 && y <= 7 && isPawnOf(state, game.Pos{X: p.X, Y: y}, player) {
+					key ^= polyglotRandom[772+whiteSquare(state.Starter, *p)%8]
+					break
+				}
+			}
+		}
+	}
+	if player == game.White {
+		key ^= polyglotRandom[780]
+	}
+	return key
+}
+
+// PolyglotEntry is one move of a position in a polyglot book
+type PolyglotEntry struct {
+	Key    uint64
+	Move   uint16
+	Weight uint16
+	Learn  uint32
+}
+
+// PolyglotMove encodes m as in polyglot books: the to square, the from square and the promotion
+func PolyglotMove(state *game.State, m game.Move) uint16 {
+	convert := 0
+	for i, t := range polyglotConvertTypes {
+		if m.IsConversion && t == m.ConvertType {
+			convert = i
+		}
+	}
+	return uint16(whiteSquare(state.Starter, m.End) | whiteSquare(state.Starter, m.Start)<<6 | convert<<12)
+}
+
+// WritePolyglotBook writes the entries sorted by key, as polyglot readers search the book by bisection
+func WritePolyglotBook(path string, entries []PolyglotEntry) error {
+	sorted := append([]PolyglotEntry{}, entries...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Key < sorted[j].Key
+	})
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(file)
+	for _, e := range sorted {
+		if err := binary.Write(w, binary.BigEndian, e); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// toMove finds the move of the state matching bm, book moves the engine can't play (castling) are not found
+func (bm bookMove) toMove(state *game.State, player game.Player) (game.Move, bool) {
+	for _, m := range state.GetMoves(player) {
+		if whiteSquare(state.Starter, m.Start) != bm.from || whiteSquare(state.Starter, m.End) != bm.to || m.IsConversion != (bm.convertType != game.NilPiece) {
+			continue
+		}
+		m.ConvertType = bm.convertType
+		return m, true
+	}
+	return game.Move{}, false
+}
+
+// pick chooses a random book move by weight, variety is the percentage of the weight of the most played move
+// that the other moves may fall short of and still be chosen, 0 only plays the most played move
+func (b *Book) pick(state *game.State, player game.Player, variety int) *game.Move {
+	moves := []game.Move{}
+	weights := []int{}
+	best := 0
+	for _, bm := range b.positions[PolyglotKey(state, player)] {
+		if m, ok := bm.toMove(state, player); ok && bm.weight > 0 {
+			moves = append(moves, m)
+			weights = append(weights, bm.weight)
+			if bm.weight > best {
+				best = bm.weight
+			}
+		}
+	}
+	threshold := best * (100 - variety) / 100
+	total := 0
+	for _, w := range weights {
+		if w >= threshold {
+			total += w
+		}
+	}
+	if total == 0 {
+		return nil
+	}
+	r := rand.Intn(total)
+	for i, w := range weights {
+		if w < threshold {
+			continue
+		}
+		if r < w {
+			return &moves[i]
+		}
+		r -= w
+	}
+	return nil
+}
+
+// probeBook returns a book move while the game is shorter than the book depth
+func probeBook(state *game.State, player game.Player) *game.Move {
+	if book == nil || state.Ply >= options.BookDepth {
+		return nil
+	}
+	return book.pick(state, player, options.BookVariety)
+}
@@ -0,0 +1,67 @@
+package engine
+
+import (
+	"chess/game"
+	"testing"
+)
+
+// orientations are state with white and with black at the bottom of the board, the polyglot encoding is the same
+func orientations(t *testing.T, fen string) []*game.State {
+	state, err := game.NewStateFromFEN(fen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return []*game.State{state, state.Rotated(game.Black)}
+}
+
+// TestPolyglotKey checks the keys of the polyglot book format specification
+func TestPolyglotKey(t *testing.T) {
+	tests := []struct {
+		fen string
+		key uint64
+	}{
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", 0x463b96181691fc9c},
+		{"rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1", 0x823c9b50fd114196},
+		{"rnbqkbnr/ppp1pppp/8/3p4/4P3/8/PPPP1PPP/RNBQKBNR w KQkq d6 0 2", 0x0756b94461c50fb0},
+		{"rnbqkbnr/ppp1pppp/8/3pP3/8/8/PPPP1PPP/RNBQKBNR b KQkq - 0 2", 0x662fafb965db29d4},
+		{"rnbqkbnr/ppp1p1pp/8/3pPp2/8/8/PPPP1PPP/RNBQKBNR w KQkq f6 0 3", 0x22a48b5a8e47ff78},
+		{"rnbqkbnr/ppp1p1pp/8/3pPp2/8/8/PPPPKPPP/RNBQ1BNR b kq - 0 3", 0x652a607ca3f242c1},
+		{"rnbq1bnr/ppp1pkpp/8/3pPp2/8/8/PPPPKPPP/RNBQ1BNR w - - 0 4", 0x00fdd303c946bdd9},
+		{"rnbqkbnr/p1pppppp/8/8/PpP4P/8/1P1PPPP1/RNBQKBNR b KQkq c3 0 3", 0x3c8123ea7b067637},
+		{"rnbqkbnr/p1pppppp/8/8/P6P/R1p5/1P1PPPP1/1NBQKBNR b Kkq - 0 4", 0x5c3f9b829b279560},
+	}
+	for _, test := range tests {
+		for _, state := range orientations(t, test.fen) {
+			if key := PolyglotKey(state, state.Turn); key != test.key {
+				t.Errorf("%v (starter %v): key %016x, want %016x", test.fen, game.PlayerToString[state.Starter], key, test.key)
+			}
+		}
+	}
+}
+
+func TestPolyglotMove(t *testing.T) {
+	tests := []struct {
+		fen  string
+		move string
+		want uint16
+	}{
+		{game.StartFEN, "e2e4", 28 | 12<<6},
+		{game.StartFEN, "g1f3", 21 | 6<<6},
+		{"rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1", "e7e5", 36 | 52<<6},
+		{"7k/P3P3/8/8/8/8/1p6/4K3 w - - 0 1", "e7e8q", 60 | 52<<6 | 4<<12},
+		{"7k/P3P3/8/8/8/8/1p6/4K3 w - - 0 1", "a7a8n", 56 | 48<<6 | 1<<12},
+		{"7k/P3P3/8/8/8/8/1p6/4K3 b - - 0 1", "b2b1r", 1 | 9<<6 | 3<<12},
+		{"7k/P3P3/8/8/8/8/1p6/4K3 b - - 0 1", "b2b1b", 1 | 9<<6 | 2<<12},
+	}
+	for _, test := range tests {
+		for _, state := range orientations(t, test.fen) {
+			m, err := state.ParseUCIMove(test.move, state.Turn)
+			if err != nil {
+				t.Fatalf("%v: %v", test.move, err)
+			}
+			if move := PolyglotMove(state, m); move != test.want {
+				t.Errorf("%v (starter %v): %v is %v, want %v", test.fen, game.PlayerToString[state.Starter], test.move, move, test.want)
+			}
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package engine
+
+import (
+	"chess/game"
+	"chess/util"
+)
+
+// Endgames the general terms get wrong are looked up by the material of both sides. An endgame evaluation replaces
+// the static evaluation, a scale factor shrinks the end game part of it towards a draw
+
+const (
+	knownWin    int = 10000 // above any evaluation, below the tablebase and mate scores
+	scaleNormal int = 64
+	scaleDraw   int = 0
+)
+
+// material is the number of pieces of every type of both sides and their squares, counted from a1 as seen by white
+type material struct {
+	counts  [2][6]int
+	squares [2][6][10]int
+	stm     game.Player
+}
+
+func newMaterial(state *game.State) *material {
+	m := &material{stm: state.Turn}
+	for i := 0; i <= 7; i++ {
+		for j := 0; j <= 7; j++ {
+			piece := state.Board[i][j]
+			if piece == nil {
+				continue
+			}
+			n := m.counts[piece.Owner][piece.Type]
+			if n < len(m.squares[piece.Owner][piece.Type]) {
+				m.squares[piece.Owner][piece.Type][n] = whiteSquare(state.Starter, game.Pos{X: i, Y: j})
+			}
+			m.counts[piece.Owner][piece.Type]++
+		}
+	}
+	return m
+}
+
+// key is the material signature like KBNvK, with first as the first side
+func (m *material) key(first game.Player) string {
+	counts := &[2][6]int{}
+	for _, p := range game.Players {
+		for _, t := range game.PieceTypes {
+			counts[p][6-tbPieceCodes[t]] = m.counts[p][t]
+		}
+	}
+	return materialKey(counts, int(first))
+}
+
+// nonPawn is the middle game value of the pieces of player other than the king and the pawns
+func (m *material) nonPawn(player game.Player) int {
+	value := 0
+	for _, t := range []game.PieceType{game.Queen, game.Rook, game.Bishop, game.Knight} {
+		value += m.counts[player][t] * params.PieceValues[t]
+	}
+	return value
+}
+
+func (m *material) bareKing(player game.Player) bool {
+	return m.nonPawn(player) == 0 && m.counts[player][game.Pawn] == 0
+}
+
+func (m *material) king(player game.Player) int {
+	return m.squares[player][game.King][0]
+}
+
+func squareDistance(a int, b int) int {
+	return util.Max(util.Abs(a&7-b&7), util.Abs(a>>3-b>>3))
+}
+
+// relativeSquare flips sq for black, so the pawns of player always go up the board
+func relativeSquare(player game.Player, sq int) int {
+	if player == game.Black {
+		return sq ^ 56
+	}
+	return sq
+}
+
+func isDarkSquare(sq int) bool {
+	return (sq&7+sq>>3)%2 == 0
+}
+
+// pushToEdge grows as sq gets away from the center
+func pushToEdge(sq int) int {
+	file, rank := sq&7, sq>>3
+	return 20 * (util.Max(3-file, file-4) + util.Max(3-rank, rank-4))
+}
+
+// pushClose grows as the kings get closer
+func pushClose(a int, b int) int {
+	return 140 - 20*squareDistance(a, b)
+}
+
+// endgameEval is the evaluation from the pov of strong, ok is false when the position isn't one it knows
+type endgameEval func(m *material, strong game.Player) (int, bool)
+
+// endgameEvals are by the material signature with the strong side first
+var endgameEvals map[string]endgameEval = map[string]endgameEval{
+	"KvK":   evalDraw,
+	"KNvK":  evalDraw,
+	"KBvK":  evalDraw,
+	"KNNvK": evalDraw,
+	"KBNvK": evalKBNK,
+	"KPvK":  evalKPK,
+}
+
+// probeEndgame is the evaluation of a known endgame from the pov of white and its name, ok is false for other positions
+func probeEndgame(state *game.State) (int, string, bool) {
+	m := newMaterial(state)
+	for _, strong := range game.Players {
+		weak := (strong + 1) % 2
+		key := m.key(strong)
+		var ev int
+		var ok bool
+		if f, found := endgameEvals[key]; found {
+			ev, ok = f(m, strong)
+		} else if m.bareKing(weak) && m.nonPawn(strong) >= params.PieceValues[game.Rook] {
+			ev, ok, key = evalKXK(m, strong), true, "KXvK"
+		}
+		if ok {
+			if strong == game.Black {
+				ev = -ev
+			}
+			return ev, key, true
+		}
+	}
+	return 0, "", false
+}
+
+func evalDraw(m *material, strong game.Player) (int, bool) {
+	return 0, true
+}
+
+// evalKXK drives the bare king to the edge and brings the kings together, it is a known win with mating material
+func evalKXK(m *material, strong game.Player) int {
+	weak := (strong + 1) % 2
+	ev := m.nonPawn(strong) + m.counts[strong][game.Pawn]*params.PieceValuesEndGame[game.Pawn] +
+		pushToEdge(m.king(weak)) + pushClose(m.king(strong), m.king(weak))
+	bishopColors := map[bool]bool{}
+	for _, sq := range m.squares[strong][game.Bishop][:util.Min(m.counts[strong][game.Bishop], 10)] {
+		bishopColors[isDarkSquare(sq)] = true
+	}
+	if m.counts[strong][game.Queen] > 0 || m.counts[strong][game.Rook] > 0 || len(bishopColors) == 2 ||
+		(m.counts[strong][game.Bishop] > 0 && m.counts[strong][game.Knight] > 0) {
+		ev += knownWin
+	}
+	return ev
+}
+
+// evalKBNK drives the bare king to a corner of the color of the bishop, the only corners it can be mated in
+func evalKBNK(m *material, strong game.Player) (int, bool) {
+	weak := (strong + 1) % 2
+	weakKing := m.king(weak)
+	corners := []int{0, 63} // a1 and h8
+	if !isDarkSquare(m.squares[strong][game.Bishop][0]) {
+		corners = []int{7, 56}
+	}
+	toCorner := 14
+	for _, corner := range corners {
+		toCorner = util.Min(toCorner, util.Abs(weakKing&7-corner&7)+util.Abs(weakKing>>3-corner>>3))
+	}
+	return knownWin + params.PieceValuesEndGame[game.Bishop] + params.PieceValuesEndGame[game.Knight] +
+		40*(14-toCorner) + pushClose(m.king(strong), weakKing), true
+}
+
+// evalKPK knows the pawns the weak king can't catch by the rule of the square, and the draws with the weak king
+// in front of the pawn
+func evalKPK(m *material, strong game.Player) (int, bool) {
+	weak := (strong + 1) % 2
+	pawn := relativeSquare(strong, m.squares[strong][game.Pawn][0])
+	strongKing, weakKing := relativeSquare(strong, m.king(strong)), relativeSquare(strong, m.king(weak))
+	file, rank := pawn&7, pawn>>3
+	promotion := 56 + file
+	toPromote := util.Min(5, 7-rank) // a pawn on its first rank moves two squares
+	weakDistance := squareDistance(weakKing, promotion)
+	if m.stm == weak {
+		weakDistance--
+	}
+	blocked := strongKing&7 == file && strongKing>>3 > rank
+	if toPromote < weakDistance && !blocked {
+		return knownWin + params.PieceValuesEndGame[game.Pawn] + 20*rank, true
+	}
+	weakInFront := weakKing&7 == file && weakKing>>3 > rank
+	if weakInFront && ((strongKing>>3 < rank && rank < 6) || file == 0 || file == 7) {
+		return 0, true
+	}
+	return 0, false
+}
+
+// endgameScale is the part out of scaleNormal of the end game evaluation to keep when strong is ahead, and why
+func endgameScale(m *material, strong game.Player) (int, string) {
+	weak := (strong + 1) % 2
+	if wrongRookPawn(m, strong) {
+		return scaleDraw, "wrong rook pawn"
+	}
+	// without pawns a side needs more than a minor piece of advantage to win
+	if m.counts[strong][game.Pawn] == 0 && m.nonPawn(strong)-m.nonPawn(weak) <= params.PieceValues[game.Bishop] {
+		if m.nonPawn(strong) < params.PieceValues[game.Rook] {
+			return scaleDraw, "no pawns"
+		} else if m.nonPawn(weak) <= params.PieceValues[game.Bishop] {
+			return 4, "no pawns"
+		}
+		return 14, "no pawns"
+	}
+	if m.counts[strong][game.Bishop] == 1 && m.counts[weak][game.Bishop] == 1 &&
+		isDarkSquare(m.squares[strong][game.Bishop][0]) != isDarkSquare(m.squares[weak][game.Bishop][0]) {
+		if m.nonPawn(strong) == params.PieceValues[game.Bishop] && m.nonPawn(weak) == params.PieceValues[game.Bishop] {
+			if m.counts[strong][game.Pawn]+m.counts[weak][game.Pawn] > 1 {
+				return 31, "opposite colored bishops"
+			}
+			return 9, "opposite colored bishops"
+		}
+		return 46, "opposite colored bishops"
+	}
+	return scaleNormal, ""
+}
+
+// wrongRookPawn is a bishop and rook pawns against a bare king that holds the promotion square the bishop doesn't cover
+func wrongRookPawn(m *material, strong game.Player) bool {
+	weak := (strong + 1) % 2
+	pawns := m.counts[strong][game.Pawn]
+	if pawns == 0 || pawns > len(m.squares[strong][game.Pawn]) || !m.bareKing(weak) ||
+		m.nonPawn(strong) != params.PieceValues[game.Bishop] || m.counts[strong][game.Bishop] != 1 {
+		return false
+	}
+	file := m.squares[strong][game.Pawn][0] & 7
+	if file != 0 && file != 7 {
+		return false
+	}
+	for _, sq := range m.squares[strong][game.Pawn][:pawns] {
+		if sq&7 != file {
+			return false
+		}
+	}
+	promotion := relativeSquare(strong, 56+file)
+	return isDarkSquare(promotion) != isDarkSquare(m.squares[strong][game.Bishop][0]) &&
+		squareDistance(m.king(weak), promotion) <= 1
+}
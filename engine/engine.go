@@ -8,295 +8,163 @@ import (
 	"time"
 )
 
-var (
-	pieceTypeToValue map[game.PieceType]float32 = map[game.PieceType]float32{
-		game.Pawn:   1,
-		game.Knight: 3.2,
-		game.Bishop: 3.3,
-		game.Rook:   5,
-		game.Queen:  9,
-		game.King:   1000,
-	}
-)
-
 const (
-	bigNum float32 = 10000000
+	infinity  int = 100000000
+	mateScore int = 10000000 // for capturing the king, less the ply so that faster wins score higher
+	maxPly    int = 256
 )
 
 const (
 	startDepth int = 1
 )
 
-var (
-	numNodesVisited uint64 = 0
-)
-
-type transpositionState struct {
-}
-
-var transpositions map[uint64]*transpositionState
-var transpositionEvals map[uint64]float32 //pov of white
+var tt *transpositionTable
+var transpositionEvals *evalCache //pov of white
 
 func Init() {
 	initZobrist()
-	transpositionEvals = make(map[uint64]float32)
+	tt = newTranspositionTable(options.HashMB)
+	transpositionEvals = newEvalCache(1 << 20)
+	pawnTable = newPawnCache(1 << 16)
 }
 
-func isEndGame(state *game.State) bool {
-	numQueens := 0
-	numMinors := 0
-	numNonQueenPieces := 0
-	for i := 0; i <= 7; i++ {
-		for j := 0; j <= 7; j++ {
-			if state.Board[i][j] != nil {
-				if state.Board[i][j].Type == game.Queen {
-					numQueens++
-				} else if state.Board[i][j].Type != game.King && state.Board[i][j].Type != game.Pawn {
-					numNonQueenPieces++
-				}
-				if state.Board[i][j].Type == game.Bishop || state.Board[i][j].Type == game.Knight {
-					numMinors++
-				}
-			}
-		}
-	}
-	return numQueens == 0 || (numMinors <= 2 && numNonQueenPieces <= 1)
+// Limits bound a search, zero fields are no limit
+type Limits struct {
+	MoveTime  time.Duration // the MoveTime option is used when this and Time are zero
+	Time      time.Duration // left on the clock of the player, the move gets a share of it
+	Increment time.Duration
+	MovesToGo int // moves until the next time control, 0 for the rest of the game
+	Depth     int
+	Nodes     uint64
+	Infinite  bool            // no time limit, the search runs until Stop is closed
+	Stop      <-chan struct{} // closed to end the search early
+	// while open the search ponders on the opponent's time without a time limit, closing it on a ponder hit
+	// turns it into the search for the move, which gets its time from then on
+	Ponder <-chan struct{}
 }
 
-func GetBestMove(state *game.State, player game.Player, ch chan *game.Move) {
-	isEndGame := isEndGame(state)
-	fmt.Printf("isEndGame: %v\n", isEndGame)
-	if isEndGame {
-		pieceMaps[game.King] = kingMapEndGame
+// moveTime is the time to spend on the move, the share of the clock assumes 30 more moves when the moves to go are unknown
+func (l Limits) moveTime() time.Duration {
+	if l.MoveTime > 0 {
+		return l.MoveTime
 	}
-	depth := startDepth
-	moves := getEngineMoves(state, player)
-	var best *game.Move
-	var moveI int
-	var ev float32
-	start := time.Now()
-	for time.Since(start) < time.Second*5 {
-		currStart := time.Now()
-		numNodesVisited = 0
-		if depth == startDepth {
-			best, moveI, ev = getBestMove(state, moves, player, depth, -bigNum, bigNum, Hash(state))
-		} else {
-			best = nil
-			var currWindow float32 = 0.5
-			for best == nil {
-				best, moveI, ev = getBestMove(state, moves, player, depth, ev-currWindow, ev+currWindow, Hash(state))
-				currWindow *= 2
-			}
-		}
-		moves = util.RemoveIndex(moves, moveI)
-		moves = append([]game.Move{*best}, moves...) //TODO: multiple move priority
-		fmt.Printf("depth: %v, best: %v, kilo-nodes per second: %v\n", depth, best, float64(numNodesVisited)/time.Since(currStart).Seconds()/1000)
-		if ev == bigNum-1 || ev == -bigNum+1 {
-			break
-		}
-		depth++
+	if l.Time <= 0 {
+		return options.MoveTime
+	}
+	movesToGo := 30
+	if l.MovesToGo > 0 {
+		movesToGo = util.Min(l.MovesToGo, movesToGo)
+	}
+	t := l.Time/time.Duration(movesToGo) + l.Increment*3/4
+	reserve := l.Time / 20 // never run the clock down to the last moment
+	if t > l.Time-reserve {
+		t = l.Time - reserve
 	}
-	ch <- best
-	state.RunMove(*best)
-	fmt.Printf("eval for %v: %v\n", game.PlayerToString[player], evalState(state, player, Hash(state)))
+	return time.Duration(util.Max(int(t), int(time.Millisecond)))
 }
 
-func getBestMove(state *game.State, moves []game.Move, player game.Player, depth int, min, max float32, currHash uint64) (*game.Move, int, float32) {
-	numNodesVisited++
-	state.Turn = player
-	bestI := -1
-	bestEval := -bigNum
-	for i, m := range moves {
-		captureType := game.NilPiece
-		convertType := game.NilPiece
-		if m.Capture != nil {
-			captureType = state.Board[m.Capture.X][m.Capture.Y].Type
-		}
-		if m.ConvertType != captureType {
-			convertType = m.ConvertType
-		}
+// Line is one of the best moves of a search with its score in centipawns for the player to move and the expected continuation,
+// which starts with the move
+type Line struct {
+	Move  game.Move
+	Score int
+	PV    []game.Move
+}
 
-		if captureType == game.King {
-			return &moves[i], i, bigNum - 1
-		}
-		oldHash := currHash
+// Info is the progress of a search after a completed depth, with the MultiPV best lines best first
+type Info struct {
+	Depth int
+	Nodes uint64
+	Time  time.Duration
+	Lines []Line
+}
 
-		currHash := RunMoveForHash(state, &m, currHash) //runs original RunMove
-		var ev float32
-		if depth == 1 {
-			ev = evalState(state, player, currHash)
-		} else {
-			_, _, ev = getBestMove(state, getEngineMoves(state, (player+1)%2), (player+1)%2, depth-1, -max, -min, currHash)
-			ev = -ev
-			state.Turn = player
-		}
-		if ev > bestEval {
-			bestEval = ev
-			bestI = i
-		}
-		min = util.Max(min, bestEval)
-		state.ReverseMove(m, captureType, convertType)
-		currHash = oldHash
+// Think searches state for player within limits, calling report (if not nil) after every completed depth.
+// It returns the lines of the deepest completed depth, none when player has no moves
+func Think(state *game.State, player game.Player, limits Limits, report func(Info)) []Line {
+	return newSearch(state, player, options.Threads, limits, report).run()
+}
 
-		if min >= max {
-			break
-		}
+// RootProbe is the move from the book or the tablebases and where it came from, nil if there is none
+func RootProbe(state *game.State, player game.Player) (*game.Move, string) {
+	if m := probeBook(state, player); m != nil {
+		return m, "book"
 	}
-	if bestI == -1 {
-		return nil, -1, -bigNum
+	if m, dtz, ok := probeRoot(state, player); ok && skillLevel() >= MaxSkill {
+		return m, fmt.Sprintf("tablebase, dtz %v", dtz)
 	}
-	return &moves[bestI], bestI, bestEval
+	return nil, ""
 }
 
-var (
-	pawnMap [][]float32 = [][]float32{{0, 0, 0, 0, 0, 0, 0, 0},
-		{0.5, 0.5, 0.5, 0.5, 0.5, 0.5, 0.5, 0.5},
-		{0.1, 0.1, 0.2, 0.3, 0.3, 0.2, 0.1, 0.1},
-		{0.05, 0.05, 0.1, 0.25, 0.25, 0.1, 0.05, 0.05},
-		{0, 0, 0, 0.2, 0.2, 0, 0, 0},
-		{0.05, -0.05, -0.1, 0, 0, -0.1, -0.05, 0.05},
-		{0.05, 0.1, 0.1, -0.2, -0.2, 0.1, 0.1, 0.05},
-		{0, 0, 0, 0, 0, 0, 0, 0}}
-	knightMap [][]float32 = [][]float32{{-0.5, -0.4, -0.3, -0.3, -0.3, -0.3, -0.4, -0.5},
-		{-0.4, -0.2, 0, 0, 0, 0, -0.2, -0.4},
-		{-0.3, 0, 0.1, 0.15, 0.15, 0.1, 0, -0.3},
-		{-0.3, 0.05, 0.15, 0.2, 0.2, 0.15, 0.05, -0.3},
-		{-0.3, 0, 0.15, 0.2, 0.2, 0.15, 0, -0.3},
-		{-0.3, 0.05, 0.1, 0.15, 0.15, 0.1, 0.05, -0.3},
-		{-0.4, -0.2, 0, 0.05, 0.05, 0, -0.2, -0.4},
-		{-0.5, -0.4, -0.3, -0.3, -0.3, -0.3, -0.4, -0.5}}
-	bishopMap [][]float32 = [][]float32{{-0.2, -0.1, -0.1, -0.1, -0.1, -0.1, -0.1, -0.2},
-		{-0.1, 0, 0, 0, 0, 0, 0, -0.1},
-		{-0.1, 0, 0.05, 0.1, 0.1, 0.05, 0, -0.1},
-		{-0.1, 0.05, 0.05, 0.1, 0.1, 0.05, 0.05, -0.1},
-		{-0.1, 0, 0.1, 0.1, 0.1, 0.1, 0, -0.1},
-		{-0.1, 0.1, 0.1, 0.1, 0.1, 0.1, 0.1, -0.1},
-		{-0.1, 0.05, 0, 0, 0, 0, 0.05, -0.1},
-		{-0.2, -0.1, -0.1, -0.1, -0.1, -0.1, -0.1, -0.2}}
-	rookMap [][]float32 = [][]float32{{0, 0, 0, 0, 0, 0, 0, 0},
-		{0.05, 0.1, 0.1, 0.1, 0.1, 0.1, 0.1, 0.05},
-		{-0.05, 0, 0, 0, 0, 0, 0, -0.05},
-		{-0.05, 0, 0, 0, 0, 0, 0, -0.05},
-		{-0.05, 0, 0, 0, 0, 0, 0, -0.05},
-		{-0.05, 0, 0, 0, 0, 0, 0, -0.05},
-		{-0.05, 0, 0, 0, 0, 0, 0, -0.05},
-		{0, 0, 0, 0.05, 0.05, 0, 0, 0}}
-	queenMap [][]float32 = [][]float32{{-0.2, -0.1, -0.1, -0.05, -0.05, -0.1, -0.1, -0.2},
-		{-0.1, 0, 0, 0, 0, 0, 0, -0.1},
-		{-0.1, 0, 0.05, 0.05, 0.05, 0.05, 0, -0.1},
-		{-0.05, 0, 0.05, 0.05, 0.05, 0.05, 0, -0.05},
-		{0, 0, 0.05, 0.05, 0.05, 0.05, 0, -0.05},
-		{-0.1, 0.05, 0.05, 0.05, 0.05, 0.05, 0, -0.1},
-		{-0.1, 0, 0.05, 0, 0, 0, 0, -0.1},
-		{-0.2, -0.1, -0.1, -0.05, -0.05, -0.1, -0.1, -0.2}}
-	kingMapMiddleGame [][]float32 = [][]float32{{-0.3, -0.4, -0.4, -0.5, -0.5, -0.4, -0.4, -0.3},
-		{-0.3, -0.4, -0.4, -0.5, -0.5, -0.4, -0.4, -0.3},
-		{-0.3, -0.4, -0.4, -0.5, -0.5, -0.4, -0.4, -0.3},
-		{-0.3, -0.4, -0.4, -0.5, -0.5, -0.4, -0.4, -0.3},
-		{-0.2, -0.3, -0.3, -0.4, -0.4, -0.3, -0.3, -0.2},
-		{-0.1, -0.2, -0.2, -0.2, -0.2, -0.2, -0.2, -0.1},
-		{0.2, 0.2, 0, 0, 0, 0, 0.2, 0.2},
-		{0.2, 0.3, 0.1, 0, 0, 0.1, 0.3, 0.2}}
-	kingMapEndGame [][]float32 = [][]float32{{-0.5, -0.4, -0.3, -0.2, -0.2, -0.3, -0.4, -0.5},
-		{-0.3, -0.2, -0.1, 0, 0, -0.1, -0.2, -0.3},
-		{-0.3, -0.1, 0.2, 0.3, 0.3, 0.2, -0.1, -0.3},
-		{-0.3, -0.1, 0.3, 0.4, 0.4, 0.3, -0.1, -0.3},
-		{-0.3, -0.1, 0.3, 0.4, 0.4, 0.3, -0.1, -0.3},
-		{-0.3, -0.1, 0.2, 0.3, 0.3, 0.2, -0.1, -0.3},
-		{-0.3, -0.3, 0, 0, 0, 0, -0.3, -0.3},
-		{-0.5, -0.3, -0.3, -0.3, -0.3, -0.3, -0.3, -0.5}}
-	pieceMaps map[game.PieceType][][]float32 = map[game.PieceType][][]float32{game.Pawn: pawnMap, game.Knight: knightMap, game.Bishop: bishopMap, game.Rook: rookMap, game.Queen: queenMap, game.King: kingMapMiddleGame}
-)
+// NewGame forgets the positions searched so far
+func NewGame() {
+	tt.clear()
+	transpositionEvals.clear()
+	pawnTable.clear()
+}
 
-func evalState(state *game.State, pov game.Player, currHash uint64) float32 {
-	stateHash := currHash
-	if _, ok := transpositionEvals[stateHash]; ok {
-		if pov == game.Black {
-			return -transpositionEvals[stateHash]
-		} else {
-			return transpositionEvals[stateHash]
-		}
+// Play is the move for player in a game, from the book or the tablebases or searched within limits, and the expected
+// reply to ponder on, nil if the search didn't see that far. The move is nil when player has no moves
+func Play(state *game.State, player game.Player, limits Limits) (*game.Move, *game.Move) {
+	if m, source := RootProbe(state, player); m != nil {
+		fmt.Printf("%v move: %v%v\n", source, state.PosToSquare(m.Start), state.PosToSquare(m.End))
+		return m, nil
 	}
-	var res float32 = 0
-
-	for i := 0; i <= 7; i++ {
-		for j := 0; j <= 7; j++ {
-			if state.Board[i][j] != nil {
-				if state.Board[i][j].Owner == pov {
-					res += pieceTypeToValue[state.Board[i][j].Type]
-				} else {
-					res -= pieceTypeToValue[state.Board[i][j].Type]
-				}
-				if state.Board[i][j].Owner == pov {
-					if state.Board[i][j].Owner == state.Starter {
-						res += pieceMaps[state.Board[i][j].Type][i][j]
-					} else {
-						res += pieceMaps[state.Board[i][j].Type][7-i][j]
-					}
-				} else {
-					if state.Board[i][j].Owner == state.Starter {
-						res -= pieceMaps[state.Board[i][j].Type][i][j]
-					} else {
-						res -= pieceMaps[state.Board[i][j].Type][7-i][j]
-					}
-				}
-			}
-		}
+	fmt.Printf("phase: %v\n", gamePhase(state))
+	s := newSearch(state, player, options.Threads, limits, nil)
+	lines := s.run()
+	if len(lines) == 0 {
+		fmt.Printf("threads: %v, nodes: %v, no moves\n", len(s.workers), s.nodes())
+		return nil, nil
 	}
-	//TODO: isolated pawns
-	for j := 0; j <= 7; j++ {
-		currPovPawns := 0
-		currNonPovPawns := 0
-		for i := 0; i <= 7; i++ {
-			if state.Board[i][j] != nil && state.Board[i][j].Type == game.Pawn {
-				if state.Board[i][j].Owner == pov {
-					if state.Board[i][j].Owner == state.Starter { //blocked pawns
-						if state.Board[i-1][j] != nil {
-							res -= 0.5
-						}
-					} else {
-						if state.Board[i+1][j] != nil {
-							res -= 0.5
-						}
-					}
-					currPovPawns++
-				} else {
-					if state.Board[i][j].Owner == state.Starter {
-						if state.Board[i-1][j] != nil {
-							res += 0.5
-						}
-					} else {
-						if state.Board[i+1][j] != nil {
-							res += 0.5
-						}
-					}
-					currNonPovPawns++
-				}
-			}
-		}
-		if currPovPawns >= 2 { //doubled
-			res -= 0.5
-		}
-		if currNonPovPawns >= 2 {
-			res += 0.5
-		}
+	best := lines[0].Move
+	fmt.Printf("threads: %v, nodes: %v, kilo-nodes per second: %v, eval: %v\n", len(s.workers), s.nodes(), float64(s.nodes())/time.Since(s.start).Seconds()/1000, ScoreToPawns(lines[0].Score))
+	for i, line := range lines[1:] {
+		fmt.Printf("line %v: %v%v, eval: %v\n", i+2, state.PosToSquare(line.Move.Start), state.PosToSquare(line.Move.End), ScoreToPawns(line.Score))
 	}
-	if pov == game.Black {
-		transpositionEvals[stateHash] = -res
-	} else {
-		transpositionEvals[stateHash] = res
+	var ponder *game.Move
+	if len(lines[0].PV) > 1 {
+		ponder = &lines[0].PV[1]
 	}
-	return res
+	copied := state.Copy()
+	copied.RunMove(best)
+	fmt.Printf("eval for %v: %v\n", game.PlayerToString[player], ScoreToPawns(evalState(copied, player, Hash(copied), nil)))
+	return &best, ponder
+}
+
+func GetBestMove(state *game.State, player game.Player, ch chan *game.Move) {
+	m, _ := Play(state, player, Limits{})
+	ch <- m
+}
+
+func isMateScore(score int) bool {
+	return util.Abs(score) > mateScore-maxPly
+}
+
+// MateIn is the number of moves to the mate of a mate score, negative when getting mated
+func MateIn(score int) (int, bool) {
+	if !isMateScore(score) {
+		return 0, false
+	}
+	if score > 0 {
+		return (mateScore - score + 1) / 2, true
+	}
+	return -(mateScore + score + 1) / 2, true
+}
+
+// ScoreToPawns converts a centipawn score for reporting
+func ScoreToPawns(score int) float32 {
+	return float32(score) / 100
 }
 
-func evalMove(state *game.State, move game.Move) float32 {
-	var res float32 = 0
+func evalMove(state *game.State, move game.Move) int {
+	res := 0
 	if move.Capture != nil {
-		res += pieceTypeToValue[state.Board[move.Capture.X][move.Capture.Y].Type]
-		res -= pieceTypeToValue[state.Board[move.Start.X][move.Start.Y].Type] * 0.1
+		res += params.PieceValues[state.Board[move.Capture.X][move.Capture.Y].Type]
+		res -= params.PieceValues[state.Board[move.Start.X][move.Start.Y].Type] / 10
 	}
 	if move.IsConversion {
-		res += 10 + pieceTypeToValue[move.ConvertType]
+		res += 1000 + params.PieceValues[move.ConvertType]
 	}
 	return res
 }
@@ -304,7 +172,7 @@ func evalMove(state *game.State, move game.Move) float32 {
 // TODO: move uistate.winner to state
 func getEngineMoves(state *game.State, player game.Player) []game.Move {
 	moves := state.GetMoves(player)
-	moveEvals := []float32{}
+	moveEvals := []int{}
 	for i, m := range moves {
 		if m.IsConversion {
 			moves[i].ConvertType = game.Queen
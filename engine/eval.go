@@ -0,0 +1,137 @@
+package engine
+
+import (
+	"chess/game"
+	"chess/util"
+)
+
+var (
+	// contribution of each piece to the game phase, a full board is maxPhase and bare kings with pawns is 0
+	pieceTypeToPhase map[game.PieceType]int = map[game.PieceType]int{
+		game.Knight: 1,
+		game.Bishop: 1,
+		game.Rook:   2,
+		game.Queen:  4,
+	}
+)
+
+const (
+	maxPhase int = 24
+)
+
+// gamePhase is maxPhase with all the pieces on the board and goes down to 0 as they are traded off
+func gamePhase(state *game.State) int {
+	phase := 0
+	for i := 0; i <= 7; i++ {
+		for j := 0; j <= 7; j++ {
+			if state.Board[i][j] != nil {
+				phase += pieceTypeToPhase[state.Board[i][j].Type]
+			}
+		}
+	}
+	if phase > maxPhase {
+		phase = maxPhase
+	}
+	return phase
+}
+
+// taper interpolates between the middle game and end game evaluation by the game phase
+func taper(mg int, eg int, phase int) int {
+	return (mg*phase + eg*(maxPhase-phase)) / maxPhase
+}
+
+// evalState is the cached evaluation from the pov of pov, by the accumulator of the search worker if the evaluator is incremental
+func evalState(state *game.State, pov game.Player, currHash uint64, acc *accumulatorStack) int {
+	stateHash := currHash
+	if ev, ok := transpositionEvals.probe(stateHash); ok {
+		if pov == game.Black {
+			return -ev
+		} else {
+			return ev
+		}
+	}
+	var res int
+	if ev, _, ok := probeEndgame(state); ok {
+		res = ev
+	} else if acc != nil {
+		res = acc.evaluate(state.Turn)
+	} else {
+		res = evaluator.Evaluate(state)
+	}
+	transpositionEvals.store(stateHash, res)
+	if pov == game.Black {
+		return -res
+	}
+	return res
+}
+
+// Evaluate returns the evaluation from the pov of white without going through any cache, for tools that change the weights
+func Evaluate(state *game.State) int {
+	mg, eg, phase := evaluate(state, nil, nil)
+	return taper(mg, eg, phase)
+}
+
+// evaluate returns the middle game and end game evaluation from the pov of white and the game phase, with the end game
+// part scaled down in drawish endgames, filling in the per term breakdown if trace is not nil
+func evaluate(state *game.State, trace *Trace, cache *pawnCache) (int, int, int) {
+	acc := &evalAccumulator{trace: trace}
+	phase := 0
+	var pawnKey uint64 = 0
+
+	for i := 0; i <= 7; i++ {
+		for j := 0; j <= 7; j++ {
+			if state.Board[i][j] != nil {
+				piece := state.Board[i][j]
+				phase += pieceTypeToPhase[piece.Type]
+				row := i
+				if piece.Owner != state.Starter {
+					row = 7 - i
+				}
+				acc.add(termMaterial, piece.Owner, params.PieceValues[piece.Type], params.PieceValuesEndGame[piece.Type])
+				acc.add(termPieceSquares, piece.Owner, params.PieceSquares[piece.Type][row][j], params.PieceSquaresEndGame[piece.Type][row][j])
+				if piece.Type == game.Pawn {
+					pawnKey ^= pieceTable[piece.Owner][game.Pawn][i][j]
+					front := i + pawnDir(state, piece.Owner)
+					if front >= 0 && front <= 7 && state.Board[front][j] != nil { //blocked
+						acc.add(termPawns, piece.Owner, -params.BlockedPawn, -params.BlockedPawnEndGame)
+					}
+				}
+			}
+		}
+	}
+	pawnMg, pawnEg, passed := evalPawns(state, pawnKey, cache)
+	if trace == nil {
+		acc.add(termPawns, game.White, pawnMg, pawnEg)
+	} else { // the cached pawn evaluation has both sides together
+		var pawns [2][8][8]bool
+		for i := 0; i <= 7; i++ {
+			for j := 0; j <= 7; j++ {
+				if state.Board[i][j] != nil && state.Board[i][j].Type == game.Pawn {
+					pawns[state.Board[i][j].Owner][i][j] = true
+				}
+			}
+		}
+		for _, player := range game.Players {
+			playerMg, playerEg, _ := evalPawnStructure(state, player, &pawns)
+			acc.add(termPawns, player, playerMg, playerEg)
+		}
+	}
+	info := newAttackInfo(state)
+	for _, player := range game.Players {
+		blockageMg, blockageEg := evalPassedPawnBlockage(state, player, passed)
+		acc.add(termPawns, player, blockageMg, blockageEg)
+		for _, term := range []evalTerm{termMobility, termKingSafety, termPieces, termThreats} {
+			termMg, termEg := activityTerms[term](state, player, info)
+			acc.add(term, player, termMg, termEg)
+		}
+	}
+	strong := game.White
+	if acc.eg < 0 {
+		strong = game.Black
+	}
+	scale, reason := endgameScale(newMaterial(state), strong)
+	if trace != nil {
+		trace.Scale, trace.Endgame = scale, reason
+	}
+	return acc.mg, acc.eg * scale / scaleNormal, util.Min(phase, maxPhase)
+}
@@ -0,0 +1,49 @@
+package engine
+
+import (
+	"chess/game"
+)
+
+// Evaluator is a static evaluation of a state in centipawns from the pov of white
+type Evaluator interface {
+	Name() string
+	Evaluate(state *game.State) int
+}
+
+// incrementalEvaluator is an evaluator with state that is updated as the search makes and takes back moves,
+// every search worker gets its own accumulator
+type incrementalEvaluator interface {
+	Evaluator
+	newAccumulator(state *game.State) *accumulatorStack
+}
+
+// classical is the hand crafted evaluation, the default
+type classical struct{}
+
+func (classical) Name() string {
+	return "classical"
+}
+
+func (classical) Evaluate(state *game.State) int {
+	mg, eg, phase := evaluate(state, nil, pawnTable)
+	return taper(mg, eg, phase)
+}
+
+var evaluator Evaluator = classical{}
+
+// StaticEval evaluates state with the evaluator selected by the options, from the pov of white.
+// Known endgames are evaluated by their own rules whatever the evaluator
+func StaticEval(state *game.State) (int, string) {
+	if ev, _, ok := probeEndgame(state); ok {
+		return ev, evaluator.Name()
+	}
+	return evaluator.Evaluate(state), evaluator.Name()
+}
+
+func setEvaluator(e Evaluator) {
+	evaluator = e
+	if tt != nil {
+		tt.clear()
+		transpositionEvals.clear()
+	}
+}
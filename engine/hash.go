@@ -12,7 +12,11 @@ var (
 	blackToMove  uint64
 )
 
+// zobristSeed fixes the keys, so searches are the same from run to run and the bench node count is a signature of the engine
+const zobristSeed int64 = 20220101
+
 func initZobrist() {
+	random := rand.New(rand.NewSource(zobristSeed))
 	passantTable = make([][]uint64, 8)
 	for i := 0; i <= 7; i++ {
 		passantTable[i] = make([]uint64, 8)
@@ -32,20 +36,20 @@ func initZobrist() {
 	}
 	for i := 0; i <= 7; i++ {
 		for j := 0; j <= 7; j++ {
-			passantTable[i][j] = rand.Uint64()
+			passantTable[i][j] = random.Uint64()
 			for _, p := range game.Players {
 				for _, t := range game.PieceTypes {
-					pieceTable[p][t][i][j] = rand.Uint64()
+					pieceTable[p][t][i][j] = random.Uint64()
 				}
 			}
 		}
 	}
 	for _, p := range game.Players {
 		castleTable[p] = make([]uint64, 2)
-		castleTable[p][0] = rand.Uint64()
-		castleTable[p][1] = rand.Uint64()
+		castleTable[p][0] = random.Uint64()
+		castleTable[p][1] = random.Uint64()
 	}
-	blackToMove = rand.Uint64()
+	blackToMove = random.Uint64()
 }
 
 func Hash(state *game.State) uint64 {
@@ -57,18 +61,7 @@ func Hash(state *game.State) uint64 {
 			}
 		}
 	}
-	if state.CanCastleLong[game.White] {
-		ans ^= castleTable[game.White][0]
-	}
-	if state.CanCastleShort[game.White] {
-		ans ^= castleTable[game.White][1]
-	}
-	if state.CanCastleLong[game.Black] {
-		ans ^= castleTable[game.Black][0]
-	}
-	if state.CanCastleShort[game.Black] {
-		ans ^= castleTable[game.Black][1]
-	}
+	ans ^= castleKey(state)
 	if state.Turn == game.Black {
 		ans ^= blackToMove
 	}
@@ -78,10 +71,31 @@ func Hash(state *game.State) uint64 {
 	return ans
 }
 
+// castleKey is the part of the hash of the castling rights of state
+func castleKey(state *game.State) uint64 {
+	var key uint64
+	for _, p := range game.Players {
+		if state.CanCastleLong[p] {
+			key ^= castleTable[p][0]
+		}
+		if state.CanCastleShort[p] {
+			key ^= castleTable[p][1]
+		}
+	}
+	return key
+}
+
+// RunMoveForHash runs m on state and returns hash, the hash of state before the move, updated to the hash after it
+// with the player to move switched
 func RunMoveForHash(state *game.State, m *game.Move, hash uint64) uint64 {
 	//update hash
-	hash ^= pieceTable[state.Board[m.Start.X][m.Start.Y].Owner][state.Board[m.Start.X][m.Start.Y].Type][m.Start.X][m.Start.Y]
-	hash ^= pieceTable[state.Board[m.Start.X][m.Start.Y].Owner][state.Board[m.Start.X][m.Start.Y].Type][m.End.X][m.End.Y]
+	piece := state.Board[m.Start.X][m.Start.Y]
+	endType := piece.Type
+	if m.IsConversion && m.ConvertType != game.NilPiece {
+		endType = m.ConvertType
+	}
+	hash ^= pieceTable[piece.Owner][piece.Type][m.Start.X][m.Start.Y]
+	hash ^= pieceTable[piece.Owner][endType][m.End.X][m.End.Y]
 	if m.Capture != nil {
 		hash ^= pieceTable[state.Board[m.Capture.X][m.Capture.Y].Owner][state.Board[m.Capture.X][m.Capture.Y].Type][m.Capture.X][m.Capture.Y]
 	}
@@ -92,15 +106,43 @@ func RunMoveForHash(state *game.State, m *game.Move, hash uint64) uint64 {
 	if m.IsPassant {
 		hash ^= passantTable[m.End.X][m.End.Y]
 	}
-	//update hash castling
-	hash ^= castleTable[game.White][0]
-	hash ^= castleTable[game.Black][0]
-	hash ^= castleTable[game.White][0]
-	hash ^= castleTable[game.Black][1]
+	//update hash castling, the rights before the move out and the ones after it in
+	hash ^= castleKey(state)
+	hash ^= blackToMove
 	state.RunMove(*m)
-	hash ^= castleTable[game.White][0]
-	hash ^= castleTable[game.Black][0]
-	hash ^= castleTable[game.White][0]
-	hash ^= castleTable[game.Black][1]
+	hash ^= castleKey(state)
 	return hash
 }
+
+// moveUndo is what unmakeMove needs to put the state back, ReverseMove leaves the en passant square and the castling
+// rights of the move
+type moveUndo struct {
+	captureType game.PieceType
+	convertType game.PieceType
+	passant     *game.Pos
+	castling    [2][2]bool // long and short, by player
+}
+
+// makeMove runs m on state like RunMoveForHash, with what unmakeMove needs to reverse it
+func makeMove(state *game.State, m *game.Move, hash uint64) (uint64, moveUndo) {
+	u := moveUndo{captureType: game.NilPiece, convertType: game.NilPiece, passant: state.PassantPos}
+	if m.Capture != nil {
+		u.captureType = state.Board[m.Capture.X][m.Capture.Y].Type
+	}
+	if m.IsConversion {
+		u.convertType = m.ConvertType
+	}
+	for _, p := range game.Players {
+		u.castling[p] = [2]bool{state.CanCastleLong[p], state.CanCastleShort[p]}
+	}
+	return RunMoveForHash(state, m, hash), u
+}
+
+// unmakeMove reverses m run by makeMove, with the turn back on the player of m
+func unmakeMove(state *game.State, m *game.Move, u moveUndo) {
+	state.ReverseMove(*m, u.captureType, u.convertType)
+	state.PassantPos = u.passant
+	for _, p := range game.Players {
+		state.CanCastleLong[p], state.CanCastleShort[p] = u.castling[p][0], u.castling[p][1]
+	}
+}
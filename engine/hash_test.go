@@ -0,0 +1,92 @@
+package engine
+
+import (
+	"chess/game"
+	"math/rand"
+	"testing"
+)
+
+// TestRunMoveForHash plays random games and checks the incremental hash against the hash from scratch after every
+// move and every move made and unmade, the start positions have castling rights, en passant and promotions to play
+func TestRunMoveForHash(t *testing.T) {
+	initZobrist()
+	fens := []string{
+		game.StartFEN,
+		"r3k2r/pppq1ppp/2n2n2/3pp3/3PP3/2N2N2/PPPQ1PPP/R3K2R w KQkq - 0 1",
+		"4k3/1P4P1/8/2pP4/8/8/1p4p1/4K3 w - c6 0 1",
+	}
+	random := rand.New(rand.NewSource(1))
+	converts := []game.PieceType{game.Queen, game.Rook, game.Bishop, game.Knight}
+	for _, fen := range fens {
+		for g := 0; g < 20; g++ {
+			state, err := game.NewStateFromFEN(fen)
+			if err != nil {
+				t.Fatal(err)
+			}
+			hash := Hash(state)
+			for ply := 0; ply < 200; ply++ {
+				moves := state.GetMoves(state.Turn)
+				if len(moves) == 0 {
+					break
+				}
+				checkMakeUnmake(t, state, moves, hash)
+				m := moves[random.Intn(len(moves))]
+				if m.IsConversion {
+					m.ConvertType = converts[random.Intn(len(converts))]
+				}
+				before := state.FEN()
+				player := state.Turn
+				hash = RunMoveForHash(state, &m, hash)
+				state.Turn = (player + 1) % 2
+				if want := Hash(state); hash != want {
+					t.Fatalf("%v after %v from %v: incremental hash %x, want %x", fen, state.UCIMove(m), before, hash, want)
+				}
+				if !hasKing(state, state.Turn) {
+					break
+				}
+			}
+		}
+	}
+}
+
+// checkMakeUnmake makes and unmakes every move of the player to move as the search does, with every promotion, and
+// checks the hash after the move and the state and its hash after it is unmade: the en passant square and the castling
+// rights of double pushes and king and rook moves are put back
+func checkMakeUnmake(t *testing.T, state *game.State, moves []game.Move, hash uint64) {
+	t.Helper()
+	fen := state.FEN()
+	player := state.Turn
+	for _, m := range moves {
+		converts := []game.PieceType{m.ConvertType}
+		if m.IsConversion {
+			converts = []game.PieceType{game.Queen, game.Rook, game.Bishop, game.Knight}
+		}
+		for _, convert := range converts {
+			m.ConvertType = convert
+			if m.Capture != nil && state.Board[m.Capture.X][m.Capture.Y].Type == game.King {
+				continue
+			}
+			after, undo := makeMove(state, &m, hash)
+			state.Turn = (player + 1) % 2
+			if want := Hash(state); after != want {
+				t.Fatalf("%v after %v: incremental hash %x, want %x", fen, state.UCIMove(m), after, want)
+			}
+			state.Turn = player
+			unmakeMove(state, &m, undo)
+			if state.FEN() != fen || Hash(state) != hash {
+				t.Fatalf("%v: unmaking %v left %v", fen, state.UCIMove(m), state.FEN())
+			}
+		}
+	}
+}
+
+func hasKing(state *game.State, player game.Player) bool {
+	for i := 0; i <= 7; i++ {
+		for j := 0; j <= 7; j++ {
+			if piece := state.Board[i][j]; piece != nil && piece.Type == game.King && piece.Owner == player {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,209 @@
+package engine
+
+import (
+	"bytes"
+	"chess/game"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// The network has 768 inputs per perspective, one for every (own or opponent) piece type on every square,
+// with the board flipped for black so both perspectives share the weights. The inputs feed a hidden layer
+// (the accumulator) that only changes by a few columns per move, and the output neuron reads the clipped
+// hidden layers of the side to move and the other side.
+//
+// Weight file layout, little endian:
+//
+//	magic "NNUE", uint32 version (2), uint32 hidden size
+//	int16 feature weights [768][hidden]
+//	int16 feature biases [hidden]
+//	int16 output weights [2][hidden], side to move first
+//	int32 output bias
+//
+// The feature of a piece on a square is (color*6 + piece)*64 + square: color is 0 for the pieces of the perspective
+// and 1 for the opponent ones, piece is 0 to 5 for pawn, knight, bishop, rook, queen and king and the square is 0 (a1)
+// to 63 (h8), flipped vertically (square ^ 56) for the black perspective. Version 1 files had the pieces in the order
+// of game.PieceType.
+const (
+	nnueMagic      string = "NNUE"
+	nnueVersion    uint32 = 2
+	numFeatures    int    = 768
+	maxHiddenSize  uint32 = 4096
+	nnueActivation int    = 255 // quantization of the clipped hidden layer
+	nnueOutput     int    = 64  // quantization of the output weights
+	nnueScale      int    = 400 // output to centipawns
+)
+
+type network struct {
+	path           string
+	hidden         int
+	featureWeights []int16
+	featureBiases  []int16
+	outputWeights  []int16
+	outputBias     int32
+}
+
+func loadNetwork(path string) (*network, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	r := bytes.NewReader(data)
+	header := struct {
+		Magic   [4]byte
+		Version uint32
+		Hidden  uint32
+	}{}
+	if err := binary.Read(r, binary.LittleEndian, &header); err != nil {
+		return nil, fmt.Errorf("%v: %v", path, err)
+	}
+	if string(header.Magic[:]) != nnueMagic || header.Version != nnueVersion {
+		return nil, fmt.Errorf("%v: not a version %v network file", path, nnueVersion)
+	}
+	if header.Hidden == 0 || header.Hidden > maxHiddenSize {
+		return nil, fmt.Errorf("%v: bad hidden layer size %v", path, header.Hidden)
+	}
+	hidden := int(header.Hidden)
+	net := &network{
+		path:           path,
+		hidden:         hidden,
+		featureWeights: make([]int16, numFeatures*hidden),
+		featureBiases:  make([]int16, hidden),
+		outputWeights:  make([]int16, 2*hidden),
+	}
+	for _, v := range []any{net.featureWeights, net.featureBiases, net.outputWeights, &net.outputBias} {
+		if err := binary.Read(r, binary.LittleEndian, v); err != nil {
+			return nil, fmt.Errorf("%v: %v", path, err)
+		}
+	}
+	if r.Len() != 0 {
+		return nil, errors.New(path + ": trailing data after the network")
+	}
+	return net, nil
+}
+
+func (net *network) Name() string {
+	return "nnue"
+}
+
+func (net *network) Evaluate(state *game.State) int {
+	return net.newAccumulator(state).evaluate(state.Turn)
+}
+
+func (net *network) newAccumulator(state *game.State) *accumulatorStack {
+	acc := &accumulatorStack{net: net, starter: state.Starter}
+	acc.refresh(state)
+	return acc
+}
+
+// whiteSquare is the index of pos counting from a1 as seen by white, pos depends on who started at the bottom of the board
+func whiteSquare(starter game.Player, pos game.Pos) int {
+	if starter == game.Black {
+		return pos.X*8 + 7 - pos.Y
+	}
+	return (7-pos.X)*8 + pos.Y
+}
+
+// nnuePieceIndex is the standard order of the pieces in the features
+var nnuePieceIndex [6]int = [6]int{game.Pawn: 0, game.Knight: 1, game.Bishop: 2, game.Rook: 3, game.Queen: 4, game.King: 5}
+
+func featureIndex(perspective game.Player, piece game.Piece, sq int) int {
+	color := 0
+	if piece.Owner != perspective {
+		color = 1
+	}
+	if perspective == game.Black {
+		sq ^= 56
+	}
+	return (color*6+nnuePieceIndex[piece.Type])*64 + sq
+}
+
+// accumulatorStack holds the hidden layer of both perspectives for every ply of the search
+type accumulatorStack struct {
+	net     *network
+	starter game.Player
+	stack   [][2][]int16
+	top     int
+}
+
+func (acc *accumulatorStack) refresh(state *game.State) {
+	acc.top = 0
+	if len(acc.stack) == 0 {
+		acc.grow()
+	}
+	for _, p := range game.Players {
+		copy(acc.stack[0][p], acc.net.featureBiases)
+	}
+	for i := 0; i <= 7; i++ {
+		for j := 0; j <= 7; j++ {
+			if state.Board[i][j] != nil {
+				acc.update(*state.Board[i][j], game.Pos{X: i, Y: j}, 1)
+			}
+		}
+	}
+}
+
+func (acc *accumulatorStack) grow() {
+	acc.stack = append(acc.stack, [2][]int16{make([]int16, acc.net.hidden), make([]int16, acc.net.hidden)})
+}
+
+func (acc *accumulatorStack) update(piece game.Piece, pos game.Pos, sign int16) {
+	sq := whiteSquare(acc.starter, pos)
+	for _, p := range game.Players {
+		values := acc.stack[acc.top][p]
+		i := featureIndex(p, piece, sq) * acc.net.hidden
+		weights := acc.net.featureWeights[i : i+acc.net.hidden]
+		for h := range values {
+			values[h] += sign * weights[h]
+		}
+	}
+}
+
+// push applies m to a new accumulator on top of the stack, it is called before the move is run on state
+func (acc *accumulatorStack) push(state *game.State, m *game.Move) {
+	if acc.top+1 == len(acc.stack) {
+		acc.grow()
+	}
+	for _, p := range game.Players {
+		copy(acc.stack[acc.top+1][p], acc.stack[acc.top][p])
+	}
+	acc.top++
+	moved := *state.Board[m.Start.X][m.Start.Y]
+	if m.Capture != nil {
+		acc.update(*state.Board[m.Capture.X][m.Capture.Y], *m.Capture, -1)
+	}
+	acc.update(moved, m.Start, -1)
+	if m.IsConversion && m.ConvertType != game.NilPiece {
+		moved.Type = m.ConvertType
+	}
+	acc.update(moved, m.End, 1)
+}
+
+func (acc *accumulatorStack) pop() {
+	acc.top--
+}
+
+// evaluate runs the output layer for the side to move stm and returns the score from the pov of white
+func (acc *accumulatorStack) evaluate(stm game.Player) int {
+	net := acc.net
+	out := int(net.outputBias)
+	for i, p := range []game.Player{stm, (stm + 1) % 2} {
+		weights := net.outputWeights[i*net.hidden : (i+1)*net.hidden]
+		for h, v := range acc.stack[acc.top][p] {
+			a := int(v)
+			if a < 0 {
+				a = 0
+			} else if a > nnueActivation {
+				a = nnueActivation
+			}
+			out += a * int(weights[h])
+		}
+	}
+	ev := out * nnueScale / (nnueActivation * nnueOutput)
+	if stm == game.Black {
+		return -ev
+	}
+	return ev
+}
@@ -0,0 +1,202 @@
+package engine
+
+import (
+	"bytes"
+	"chess/game"
+	"encoding/binary"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestFeatureIndex checks the features of the file format: pieces in the order P, N, B, R, Q, K and squares from a1
+func TestFeatureIndex(t *testing.T) {
+	tests := []struct {
+		perspective game.Player
+		piece       game.Piece
+		square      int
+		feature     int
+	}{
+		{game.White, game.Piece{Type: game.Pawn, Owner: game.White}, 8, 8},              // a2
+		{game.White, game.Piece{Type: game.Knight, Owner: game.White}, 6, 64 + 6},       // g1
+		{game.White, game.Piece{Type: game.Queen, Owner: game.White}, 3, 4*64 + 3},      // d1
+		{game.White, game.Piece{Type: game.King, Owner: game.Black}, 60, (6+5)*64 + 60}, // e8
+		{game.Black, game.Piece{Type: game.King, Owner: game.Black}, 60, 5*64 + 4},      // e8, flipped to e1
+		{game.Black, game.Piece{Type: game.Rook, Owner: game.White}, 0, (6+3)*64 + 56},  // a1, flipped to a8
+		{game.Black, game.Piece{Type: game.Bishop, Owner: game.Black}, 58, 2*64 + 2},    // c8, flipped to c1
+		{game.White, game.Piece{Type: game.Pawn, Owner: game.Black}, 55, 6*64 + 55},     // h7
+	}
+	for _, test := range tests {
+		if feature := featureIndex(test.perspective, test.piece, test.square); feature != test.feature {
+			t.Errorf("%v %v on %v for %v: feature %v, want %v", game.PlayerToString[test.piece.Owner],
+				game.PieceTypeToString[test.piece.Type], test.square, game.PlayerToString[test.perspective], feature, test.feature)
+		}
+	}
+}
+
+// testNetwork returns a network file with small random weights, big enough for the hidden layer to clip both ways
+func testNetwork(hidden uint32, seed int64) []byte {
+	random := rand.New(rand.NewSource(seed))
+	weights := func(n int) []int16 {
+		w := make([]int16, n)
+		for i := range w {
+			w[i] = int16(random.Intn(161) - 80)
+		}
+		return w
+	}
+	var buf bytes.Buffer
+	buf.WriteString(nnueMagic)
+	for _, v := range []any{nnueVersion, hidden, weights(numFeatures * int(hidden)), weights(int(hidden)), weights(2 * int(hidden)), int32(random.Intn(2001) - 1000)} {
+		binary.Write(&buf, binary.LittleEndian, v)
+	}
+	return buf.Bytes()
+}
+
+func writeTestNetwork(t *testing.T, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "test.nnue")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadNetwork(t *testing.T) {
+	data := testNetwork(8, 1)
+	net, err := loadNetwork(writeTestNetwork(t, data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if net.hidden != 8 || len(net.featureWeights) != numFeatures*8 || len(net.featureBiases) != 8 || len(net.outputWeights) != 16 {
+		t.Errorf("loaded a network of hidden size %v with %v, %v and %v weights", net.hidden, len(net.featureWeights),
+			len(net.featureBiases), len(net.outputWeights))
+	}
+	if first := int16(binary.LittleEndian.Uint16(data[12:])); net.featureWeights[0] != first {
+		t.Errorf("first feature weight %v, want %v", net.featureWeights[0], first)
+	}
+	if last := int32(binary.LittleEndian.Uint32(data[len(data)-4:])); net.outputBias != last {
+		t.Errorf("output bias %v, want %v", net.outputBias, last)
+	}
+
+	header := func(magic string, version, hidden uint32) []byte {
+		b := append([]byte(magic), make([]byte, 8)...)
+		binary.LittleEndian.PutUint32(b[4:], version)
+		binary.LittleEndian.PutUint32(b[8:], hidden)
+		return b
+	}
+	bad := []struct {
+		name string
+		data []byte
+	}{
+		{"truncated header", data[:10]},
+		{"truncated weights", data[:len(data)/2]},
+		{"truncated output bias", data[:len(data)-2]},
+		{"trailing data", append(append([]byte{}, data...), 0, 0)},
+		{"hidden size too big for the file", append(header(nnueMagic, nnueVersion, 16), data[12:]...)},
+		{"hidden size too small for the file", append(header(nnueMagic, nnueVersion, 4), data[12:]...)},
+		{"hidden size 0", header(nnueMagic, nnueVersion, 0)},
+		{"hidden size over the limit", append(header(nnueMagic, nnueVersion, maxHiddenSize+1), data[12:]...)},
+		{"bad magic", append(header("NNUF", nnueVersion, 8), data[12:]...)},
+		{"old version", append(header(nnueMagic, 1, 8), data[12:]...)},
+	}
+	for _, test := range bad {
+		if _, err := loadNetwork(writeTestNetwork(t, test.data)); err == nil {
+			t.Errorf("%v: loaded without an error", test.name)
+		}
+	}
+}
+
+// TestAccumulator plays random games with a small network, pushing every move on the accumulator as the search does,
+// and checks the accumulator and the evaluation against the ones refreshed from the board after every move made and
+// unmade, with every capture and promotion of the positions on the way
+func TestAccumulator(t *testing.T) {
+	initZobrist()
+	net, err := loadNetwork(writeTestNetwork(t, testNetwork(8, 2)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fens := []string{
+		game.StartFEN,
+		"r1bqk2r/pppp1ppp/2n2n2/2b1p3/2B1P3/2N2N2/PPPP1PPP/R1BQK2R w KQkq - 0 1",
+		"1n2k3/1P4P1/8/2pP4/8/8/1p4p1/4K1N1 w - c6 0 1",
+	}
+	random := rand.New(rand.NewSource(1))
+	for _, fen := range fens {
+		for g := 0; g < 5; g++ {
+			state, err := game.NewStateFromFEN(fen)
+			if err != nil {
+				t.Fatal(err)
+			}
+			acc := net.newAccumulator(state)
+			played := []game.Move{}
+			undos := []moveUndo{}
+			for ply := 0; ply < 80; ply++ {
+				moves := getEngineMoves(state, state.Turn)
+				checkPushPop(t, net, acc, state, moves)
+				if len(moves) == 0 {
+					break
+				}
+				m := moves[random.Intn(len(moves))]
+				if m.Capture != nil && state.Board[m.Capture.X][m.Capture.Y].Type == game.King {
+					break
+				}
+				acc.push(state, &m)
+				_, undo := makeMove(state, &m, 0)
+				state.Turn = (state.Turn + 1) % 2
+				checkAccumulator(t, net, acc, state, "after "+state.UCIMove(m))
+				played = append(played, m)
+				undos = append(undos, undo)
+			}
+			for i := len(played) - 1; i >= 0; i-- {
+				state.Turn = (state.Turn + 1) % 2
+				unmakeMove(state, &played[i], undos[i])
+				acc.pop()
+				checkAccumulator(t, net, acc, state, "unmaking "+state.UCIMove(played[i]))
+			}
+			if state.FEN() != fen {
+				t.Fatalf("unmaking the game from %v left %v", fen, state.FEN())
+			}
+		}
+	}
+}
+
+// checkPushPop pushes and pops every move of the player to move, with every promotion
+func checkPushPop(t *testing.T, net *network, acc *accumulatorStack, state *game.State, moves []game.Move) {
+	t.Helper()
+	player := state.Turn
+	for _, m := range moves {
+		if m.Capture != nil && state.Board[m.Capture.X][m.Capture.Y].Type == game.King {
+			continue
+		}
+		converts := []game.PieceType{m.ConvertType}
+		if m.IsConversion {
+			converts = []game.PieceType{game.Queen, game.Rook, game.Bishop, game.Knight}
+		}
+		for _, convert := range converts {
+			m.ConvertType = convert
+			acc.push(state, &m)
+			_, undo := makeMove(state, &m, 0)
+			state.Turn = (player + 1) % 2
+			checkAccumulator(t, net, acc, state, "after "+state.UCIMove(m))
+			state.Turn = player
+			unmakeMove(state, &m, undo)
+			acc.pop()
+			checkAccumulator(t, net, acc, state, "unmaking "+state.UCIMove(m))
+		}
+	}
+}
+
+func checkAccumulator(t *testing.T, net *network, acc *accumulatorStack, state *game.State, what string) {
+	t.Helper()
+	fresh := net.newAccumulator(state)
+	for _, p := range game.Players {
+		if !reflect.DeepEqual(acc.stack[acc.top][p], fresh.stack[0][p]) {
+			t.Fatalf("%v %v: %v accumulator %v, want %v", state.FEN(), what, game.PlayerToString[p], acc.stack[acc.top][p], fresh.stack[0][p])
+		}
+	}
+	if ev, want := acc.evaluate(state.Turn), net.Evaluate(state); ev != want {
+		t.Fatalf("%v %v: evaluation %v, want %v", state.FEN(), what, ev, want)
+	}
+}
@@ -0,0 +1,209 @@
+package engine
+
+import (
+	"chess/util"
+	"errors"
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const MaxMultiPV int = 64
+
+type Options struct {
+	Threads   int
+	HashMB    int
+	MoveTime  time.Duration
+	MultiPV   int    // number of best moves the search reports, each with its own score and line
+	ParamFile string // json or toml file of evaluation weights, the defaults are used when empty
+	UseNNUE   bool   // evaluate with the network in EvalFile instead of the hand crafted evaluation
+	EvalFile  string
+	BookFile  string // polyglot (.bin) book or opening lines, the built in lines are used when empty
+	BookDepth int    // plies from the start of the game to play book moves for, 0 turns the book off
+	// percentage of the weight of the most played book move other moves may fall short of and still be played, 0 only plays the most played one
+	BookVariety int
+	SyzygyPath  string // directories with syzygy tables, separated like PATH
+	// remaining depth a search node needs for the tables to be probed, probing every node near the leaves is slow
+	SyzygyProbeDepth int
+	Syzygy50MoveRule bool // score cursed wins and blessed losses as draws, from a halfmove clock of zero
+	SkillLevel       int  // 1 to MaxSkill, lower levels search less and pick weaker moves
+	LimitStrength    bool // play at the level of Elo instead of SkillLevel
+	Elo              int
+	Personality      string // name of one of the Personalities, it changes the weights of the parameter file
+}
+
+var (
+	DefaultOptions Options = Options{
+		Threads:          runtime.NumCPU(),
+		HashMB:           64,
+		MoveTime:         time.Second * 5,
+		MultiPV:          1,
+		BookDepth:        16,
+		BookVariety:      50,
+		SyzygyProbeDepth: 1,
+		Syzygy50MoveRule: true,
+		SkillLevel:       MaxSkill,
+		Elo:              1500,
+		Personality:      DefaultPersonality,
+	}
+	options Options = DefaultOptions
+)
+
+func GetOptions() Options {
+	return options
+}
+
+func SetOptions(o Options) error {
+	if o.ParamFile != options.ParamFile || o.Personality != options.Personality {
+		personality, err := FindPersonality(o.Personality)
+		if err != nil {
+			return err
+		}
+		p := DefaultParams()
+		if o.ParamFile != "" {
+			if p, err = LoadParams(o.ParamFile); err != nil {
+				return err
+			}
+		}
+		personality.adjust(p)
+		SetParams(p)
+	}
+	if o.UseNNUE != options.UseNNUE || (o.UseNNUE && o.EvalFile != options.EvalFile) {
+		var e Evaluator = classical{}
+		if o.UseNNUE {
+			if o.EvalFile == "" {
+				return errors.New("nnue needs a network file")
+			}
+			net, err := loadNetwork(o.EvalFile)
+			if err != nil {
+				return err
+			}
+			e = net
+		}
+		setEvaluator(e)
+	}
+	if book == nil || o.BookFile != options.BookFile {
+		b, err := loadBook(o.BookFile)
+		if err != nil {
+			return err
+		}
+		book = b
+	}
+	if o.SyzygyPath != options.SyzygyPath {
+		syzygy = nil
+		if o.SyzygyPath != "" {
+			tb, err := loadTablebases(o.SyzygyPath)
+			if err != nil {
+				return err
+			}
+			syzygy = tb
+			fmt.Printf("syzygy: %v tables, up to %v pieces\n", tb.count, tb.maxPieces)
+		}
+		if tt != nil {
+			tt.clear()
+		}
+	}
+	resize := o.HashMB != options.HashMB
+	options = o
+	if options.Threads < 1 {
+		options.Threads = 1
+	}
+	if resize && tt != nil {
+		tt = newTranspositionTable(options.HashMB)
+	}
+	return nil
+}
+
+// SetOption sets a single option by its (case insensitive) name, as used by the command line and UCI.
+func SetOption(name string, value string) error {
+	o := options
+	switch strings.ToLower(name) {
+	case "threads":
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		o.Threads = n
+	case "hash":
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		o.HashMB = n
+	case "movetime":
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		o.MoveTime = time.Duration(n) * time.Millisecond
+	case "multipv":
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		o.MultiPV = util.Max(1, util.Min(n, MaxMultiPV))
+	case "paramfile":
+		o.ParamFile = value
+	case "use nnue", "usennue":
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		o.UseNNUE = b
+	case "evalfile":
+		o.EvalFile = value
+	case "bookfile":
+		o.BookFile = value
+	case "bookdepth":
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		o.BookDepth = n
+	case "bookvariety":
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		o.BookVariety = util.Max(0, util.Min(n, 100))
+	case "syzygypath":
+		o.SyzygyPath = value
+	case "syzygyprobedepth":
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		o.SyzygyProbeDepth = n
+	case "syzygy50moverule":
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		o.Syzygy50MoveRule = b
+	case "skill level", "skilllevel":
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		o.SkillLevel = util.Max(1, util.Min(n, MaxSkill))
+	case "uci_limitstrength", "limitstrength":
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		o.LimitStrength = b
+	case "uci_elo", "elo":
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		o.Elo = util.Max(MinElo, util.Min(n, MaxElo))
+	case "personality":
+		o.Personality = value
+	default:
+		return fmt.Errorf("unknown option %v", name)
+	}
+	return SetOptions(o)
+}
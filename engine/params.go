@@ -0,0 +1,419 @@
+package engine
+
+import (
+	"chess/game"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+// PieceMap is a map by piece type that is written to json with the piece names as keys
+type PieceMap[T any] map[game.PieceType]T
+
+func (m PieceMap[T]) MarshalJSON() ([]byte, error) {
+	named := map[string]T{}
+	for t, v := range m {
+		named[game.PieceTypeToString[t]] = v
+	}
+	return json.Marshal(named)
+}
+
+func (m *PieceMap[T]) UnmarshalJSON(data []byte) error {
+	named := map[string]T{}
+	if err := json.Unmarshal(data, &named); err != nil {
+		return err
+	}
+	if *m == nil {
+		*m = PieceMap[T]{}
+	}
+	for name, v := range named {
+		found := false
+		for t, s := range game.PieceTypeToString {
+			if s == name {
+				(*m)[t] = v
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("unknown piece type %q", name)
+		}
+	}
+	return nil
+}
+
+// Params holds all the evaluation weights, in centipawns. Penalties are positive and subtracted.
+// Tables by rank are indexed by the rank counted from the side of the piece, piece square tables are from the pov of the starter
+type Params struct {
+	PieceValues         PieceMap[int]
+	PieceValuesEndGame  PieceMap[int]
+	PieceSquares        PieceMap[[][]int]
+	PieceSquaresEndGame PieceMap[[][]int]
+
+	BlockedPawn              int
+	BlockedPawnEndGame       int
+	DoubledPawn              int
+	DoubledPawnEndGame       int
+	IsolatedPawn             int
+	IsolatedPawnEndGame      int
+	BackwardPawn             int
+	BackwardPawnEndGame      int
+	PassedPawn               []int
+	PassedPawnEndGame        []int
+	CandidatePawn            []int
+	CandidatePawnEndGame     []int
+	ConnectedPawn            []int
+	ConnectedPawnEndGame     []int
+	PhalanxPawn              []int
+	PhalanxPawnEndGame       []int
+	BlockedPassedPawnPercent int // part of the passed pawn bonus lost when the square in front is occupied
+
+	MobilityBaseline PieceMap[int] `tune:"-"` // mobility is counted relative to a typical number of safe squares for the piece
+	Mobility         PieceMap[int]
+	MobilityEndGame  PieceMap[int]
+
+	KingAttackWeight  PieceMap[int]
+	KingDangerDivisor int `tune:"-"` // king danger is the square of the attack units divided by this
+	MaxKingDanger     int
+	KingDangerEndGame int // per attack unit
+	PawnShield        int
+	PawnShieldFar     int
+	MissingPawnShield int
+	KingSemiOpenFile  int
+	KingOpenFile      int // on top of the semi open penalty when there are no pawns at all on the file
+
+	BishopPair              int
+	BishopPairEndGame       int
+	RookOpenFile            int
+	RookOpenFileEndGame     int
+	RookSemiOpenFile        int
+	RookSemiOpenFileEndGame int
+	RookSeventhRank         int
+	RookSeventhRankEndGame  int
+	KnightOutpost           int
+	KnightOutpostEndGame    int
+	HangingPiece            int
+	HangingPieceEndGame     int
+	ThreatByPawn            int
+	ThreatByPawnEndGame     int
+}
+
+var params *Params = DefaultParams()
+
+func DefaultParams() *Params {
+	return &Params{
+		PieceValues: PieceMap[int]{
+			game.Pawn:   100,
+			game.Knight: 320,
+			game.Bishop: 330,
+			game.Rook:   500,
+			game.Queen:  900,
+			game.King:   100000,
+		},
+		PieceValuesEndGame: PieceMap[int]{
+			game.Pawn:   120,
+			game.Knight: 310,
+			game.Bishop: 340,
+			game.Rook:   530,
+			game.Queen:  950,
+			game.King:   100000,
+		},
+		PieceSquares: PieceMap[[][]int]{
+			game.Pawn: {{0, 0, 0, 0, 0, 0, 0, 0},
+				{50, 50, 50, 50, 50, 50, 50, 50},
+				{10, 10, 20, 30, 30, 20, 10, 10},
+				{5, 5, 10, 25, 25, 10, 5, 5},
+				{0, 0, 0, 20, 20, 0, 0, 0},
+				{5, -5, -10, 0, 0, -10, -5, 5},
+				{5, 10, 10, -20, -20, 10, 10, 5},
+				{0, 0, 0, 0, 0, 0, 0, 0}},
+			game.Knight: {{-50, -40, -30, -30, -30, -30, -40, -50},
+				{-40, -20, 0, 0, 0, 0, -20, -40},
+				{-30, 0, 10, 15, 15, 10, 0, -30},
+				{-30, 5, 15, 20, 20, 15, 5, -30},
+				{-30, 0, 15, 20, 20, 15, 0, -30},
+				{-30, 5, 10, 15, 15, 10, 5, -30},
+				{-40, -20, 0, 5, 5, 0, -20, -40},
+				{-50, -40, -30, -30, -30, -30, -40, -50}},
+			game.Bishop: {{-20, -10, -10, -10, -10, -10, -10, -20},
+				{-10, 0, 0, 0, 0, 0, 0, -10},
+				{-10, 0, 5, 10, 10, 5, 0, -10},
+				{-10, 5, 5, 10, 10, 5, 5, -10},
+				{-10, 0, 10, 10, 10, 10, 0, -10},
+				{-10, 10, 10, 10, 10, 10, 10, -10},
+				{-10, 5, 0, 0, 0, 0, 5, -10},
+				{-20, -10, -10, -10, -10, -10, -10, -20}},
+			game.Rook: {{0, 0, 0, 0, 0, 0, 0, 0},
+				{5, 10, 10, 10, 10, 10, 10, 5},
+				{-5, 0, 0, 0, 0, 0, 0, -5},
+				{-5, 0, 0, 0, 0, 0, 0, -5},
+				{-5, 0, 0, 0, 0, 0, 0, -5},
+				{-5, 0, 0, 0, 0, 0, 0, -5},
+				{-5, 0, 0, 0, 0, 0, 0, -5},
+				{0, 0, 0, 5, 5, 0, 0, 0}},
+			game.Queen: {{-20, -10, -10, -5, -5, -10, -10, -20},
+				{-10, 0, 0, 0, 0, 0, 0, -10},
+				{-10, 0, 5, 5, 5, 5, 0, -10},
+				{-5, 0, 5, 5, 5, 5, 0, -5},
+				{0, 0, 5, 5, 5, 5, 0, -5},
+				{-10, 5, 5, 5, 5, 5, 0, -10},
+				{-10, 0, 5, 0, 0, 0, 0, -10},
+				{-20, -10, -10, -5, -5, -10, -10, -20}},
+			game.King: {{-30, -40, -40, -50, -50, -40, -40, -30},
+				{-30, -40, -40, -50, -50, -40, -40, -30},
+				{-30, -40, -40, -50, -50, -40, -40, -30},
+				{-30, -40, -40, -50, -50, -40, -40, -30},
+				{-20, -30, -30, -40, -40, -30, -30, -20},
+				{-10, -20, -20, -20, -20, -20, -20, -10},
+				{20, 20, 0, 0, 0, 0, 20, 20},
+				{20, 30, 10, 0, 0, 10, 30, 20}},
+		},
+		PieceSquaresEndGame: PieceMap[[][]int]{
+			game.Pawn: {{0, 0, 0, 0, 0, 0, 0, 0},
+				{90, 90, 90, 90, 90, 90, 90, 90},
+				{55, 55, 55, 55, 55, 55, 55, 55},
+				{30, 30, 30, 30, 30, 30, 30, 30},
+				{15, 15, 15, 15, 15, 15, 15, 15},
+				{5, 5, 5, 5, 5, 5, 5, 5},
+				{0, 0, 0, 0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0, 0, 0, 0}},
+			game.Knight: {{-50, -40, -30, -30, -30, -30, -40, -50},
+				{-40, -20, -5, 0, 0, -5, -20, -40},
+				{-30, -5, 10, 15, 15, 10, -5, -30},
+				{-30, 0, 15, 20, 20, 15, 0, -30},
+				{-30, 0, 15, 20, 20, 15, 0, -30},
+				{-30, -5, 10, 15, 15, 10, -5, -30},
+				{-40, -20, -5, 0, 0, -5, -20, -40},
+				{-50, -40, -30, -30, -30, -30, -40, -50}},
+			game.Bishop: {{-15, -10, -10, -10, -10, -10, -10, -15},
+				{-10, 0, 0, 0, 0, 0, 0, -10},
+				{-10, 0, 5, 10, 10, 5, 0, -10},
+				{-10, 0, 10, 15, 15, 10, 0, -10},
+				{-10, 0, 10, 15, 15, 10, 0, -10},
+				{-10, 0, 5, 10, 10, 5, 0, -10},
+				{-10, 0, 0, 0, 0, 0, 0, -10},
+				{-15, -10, -10, -10, -10, -10, -10, -15}},
+			game.Rook: {{5, 5, 5, 5, 5, 5, 5, 5},
+				{10, 10, 10, 10, 10, 10, 10, 10},
+				{0, 0, 0, 0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0, 0, 0, 0},
+				{-5, 0, 0, 0, 0, 0, 0, -5}},
+			game.Queen: {{-20, -10, -10, -5, -5, -10, -10, -20},
+				{-10, 0, 5, 5, 5, 5, 0, -10},
+				{-10, 5, 10, 10, 10, 10, 5, -10},
+				{-5, 5, 10, 15, 15, 10, 5, -5},
+				{-5, 5, 10, 15, 15, 10, 5, -5},
+				{-10, 5, 10, 10, 10, 10, 5, -10},
+				{-10, 0, 5, 5, 5, 5, 0, -10},
+				{-20, -10, -10, -5, -5, -10, -10, -20}},
+			game.King: {{-50, -40, -30, -20, -20, -30, -40, -50},
+				{-30, -20, -10, 0, 0, -10, -20, -30},
+				{-30, -10, 20, 30, 30, 20, -10, -30},
+				{-30, -10, 30, 40, 40, 30, -10, -30},
+				{-30, -10, 30, 40, 40, 30, -10, -30},
+				{-30, -10, 20, 30, 30, 20, -10, -30},
+				{-30, -30, 0, 0, 0, 0, -30, -30},
+				{-50, -30, -30, -30, -30, -30, -30, -50}},
+		},
+
+		BlockedPawn:              50,
+		BlockedPawnEndGame:       30,
+		DoubledPawn:              50,
+		DoubledPawnEndGame:       60,
+		IsolatedPawn:             15,
+		IsolatedPawnEndGame:      20,
+		BackwardPawn:             10,
+		BackwardPawnEndGame:      15,
+		PassedPawn:               []int{0, 5, 10, 15, 30, 50, 80, 0},
+		PassedPawnEndGame:        []int{0, 10, 15, 25, 45, 70, 110, 0},
+		CandidatePawn:            []int{0, 2, 5, 8, 12, 20, 0, 0},
+		CandidatePawnEndGame:     []int{0, 5, 8, 12, 20, 30, 0, 0},
+		ConnectedPawn:            []int{0, 2, 4, 6, 10, 20, 35, 0},
+		ConnectedPawnEndGame:     []int{0, 2, 4, 6, 12, 25, 40, 0},
+		PhalanxPawn:              []int{0, 2, 3, 5, 8, 15, 25, 0},
+		PhalanxPawnEndGame:       []int{0, 1, 2, 4, 6, 12, 20, 0},
+		BlockedPassedPawnPercent: 50,
+
+		MobilityBaseline: PieceMap[int]{game.Knight: 4, game.Bishop: 6, game.Rook: 7, game.Queen: 13},
+		Mobility:         PieceMap[int]{game.Knight: 4, game.Bishop: 5, game.Rook: 2, game.Queen: 1},
+		MobilityEndGame:  PieceMap[int]{game.Knight: 4, game.Bishop: 5, game.Rook: 5, game.Queen: 2},
+
+		KingAttackWeight:  PieceMap[int]{game.Knight: 2, game.Bishop: 2, game.Rook: 3, game.Queen: 5},
+		KingDangerDivisor: 4,
+		MaxKingDanger:     500,
+		KingDangerEndGame: 1,
+		PawnShield:        10,
+		PawnShieldFar:     5,
+		MissingPawnShield: 15,
+		KingSemiOpenFile:  15,
+		KingOpenFile:      10,
+
+		BishopPair:              30,
+		BishopPairEndGame:       50,
+		RookOpenFile:            25,
+		RookOpenFileEndGame:     10,
+		RookSemiOpenFile:        10,
+		RookSemiOpenFileEndGame: 5,
+		RookSeventhRank:         20,
+		RookSeventhRankEndGame:  30,
+		KnightOutpost:           25,
+		KnightOutpostEndGame:    15,
+		HangingPiece:            30,
+		HangingPieceEndGame:     20,
+		ThreatByPawn:            40,
+		ThreatByPawnEndGame:     30,
+	}
+}
+
+// isTOML is true for a parameter file in toml, the others are json
+func isTOML(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".toml")
+}
+
+// LoadParams reads a parameter file in json, or in toml when it ends in .toml. Weights missing from the file keep
+// their default value
+func LoadParams(path string) (*Params, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if isTOML(path) {
+		// the values of the keys are the ones of the json file
+		values, err := parseTOML(data)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %v", path, err)
+		}
+		if data, err = json.Marshal(values); err != nil {
+			return nil, err
+		}
+	}
+	p := DefaultParams()
+	if err := json.Unmarshal(data, p); err != nil {
+		return nil, fmt.Errorf("%v: %v", path, err)
+	}
+	if err := p.check(); err != nil {
+		return nil, fmt.Errorf("%v: %v", path, err)
+	}
+	return p, nil
+}
+
+// check compares the tables of p to the default ones: a weight by rank needs a value for each of the 8 ranks and a
+// piece square table 8 rows of 8 squares for every piece, the evaluation indexes them without checking
+func (p *Params) check() error {
+	defaults := reflect.ValueOf(DefaultParams()).Elem()
+	v := reflect.ValueOf(p).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		name := v.Type().Field(i).Name
+		switch value := v.Field(i).Interface().(type) {
+		case []int:
+			if want := defaults.Field(i).Len(); len(value) != want {
+				return fmt.Errorf("%v has %v values, want %v", name, len(value), want)
+			}
+		case PieceMap[[][]int]:
+			for _, t := range game.PieceTypes {
+				table := value[t]
+				if len(table) != 8 {
+					return fmt.Errorf("%v[%v] has %v rows, want 8", name, game.PieceTypeToString[t], len(table))
+				}
+				for r := range table {
+					if len(table[r]) != 8 {
+						return fmt.Errorf("%v[%v] row %v has %v squares, want 8", name, game.PieceTypeToString[t], r, len(table[r]))
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Save writes a parameter file in json, or in toml when path ends in .toml
+func (p *Params) Save(path string) error {
+	if isTOML(path) {
+		return os.WriteFile(path, p.toml(), 0644)
+	}
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+func (p *Params) Copy() (*Params, error) {
+	copied := DefaultParams()
+	data, err := json.Marshal(p)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, copied); err != nil {
+		return nil, err
+	}
+	return copied, nil
+}
+
+// Weight is a single tunable number of a parameter set
+type Weight struct {
+	Name string
+	Get  func() int
+	Set  func(int)
+}
+
+func pointerWeight(name string, w *int) Weight {
+	return Weight{name, func() int { return *w }, func(v int) { *w = v }}
+}
+
+// Weights returns all the tunable weights of p, fields tagged tune:"-" and the king value are left out
+func (p *Params) Weights() []Weight {
+	weights := []Weight{}
+	v := reflect.ValueOf(p).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if field.Tag.Get("tune") == "-" {
+			continue
+		}
+		switch value := v.Field(i).Addr().Interface().(type) {
+		case *int:
+			weights = append(weights, pointerWeight(field.Name, value))
+		case *[]int:
+			for j := range *value {
+				weights = append(weights, pointerWeight(fmt.Sprintf("%v[%v]", field.Name, j), &(*value)[j]))
+			}
+		case *PieceMap[int]:
+			for _, t := range game.PieceTypes {
+				if _, ok := (*value)[t]; !ok || t == game.King {
+					continue
+				}
+				m, t := *value, t
+				weights = append(weights, Weight{fmt.Sprintf("%v[%v]", field.Name, game.PieceTypeToString[t]), func() int { return m[t] }, func(v int) { m[t] = v }})
+			}
+		case *PieceMap[[][]int]:
+			for _, t := range game.PieceTypes {
+				table := (*value)[t]
+				for r := range table {
+					for c := range table[r] {
+						weights = append(weights, pointerWeight(fmt.Sprintf("%v[%v][%v][%v]", field.Name, game.PieceTypeToString[t], r, c), &table[r][c]))
+					}
+				}
+			}
+		}
+	}
+	return weights
+}
+
+func GetParams() *Params {
+	return params
+}
+
+// SetParams replaces the evaluation weights, the cached evaluations are cleared since they were computed with the old ones
+func SetParams(p *Params) {
+	params = p
+	if tt != nil {
+		tt.clear()
+		transpositionEvals.clear()
+		pawnTable.clear()
+	}
+}
@@ -0,0 +1,98 @@
+package engine
+
+import (
+	"chess/game"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSaveLoadParams(t *testing.T) {
+	p := DefaultParams()
+	p.BishopPair = 42
+	p.PassedPawn[3] = -7
+	p.PieceValues[game.Knight] = 333
+	p.PieceSquaresEndGame[game.King][2][5] = 99
+	for _, name := range []string{"params.json", "params.toml"} {
+		path := filepath.Join(t.TempDir(), name)
+		if err := p.Save(path); err != nil {
+			t.Fatal(err)
+		}
+		loaded, err := LoadParams(path)
+		if err != nil {
+			t.Fatalf("%v: %v", name, err)
+		}
+		if !reflect.DeepEqual(loaded, p) {
+			t.Errorf("%v: the loaded parameters differ from the saved ones", name)
+		}
+	}
+}
+
+func TestLoadParamsTOML(t *testing.T) {
+	data := `# a few weights, the others keep their default
+BishopPair = 45 # bonus
+PassedPawn = [
+  0, 6, 12, 18,
+  32, 55, 90, 0, # trailing comma
+]
+
+[PieceValues]
+Knight = 325
+Bishop = 1_000
+
+[PieceSquares]
+Rook = [[0, 0, 0, 0, 0, 0, 0, 0], [1, 1, 1, 1, 1, 1, 1, 1], [0, 0, 0, 0, 0, 0, 0, 0], [0, 0, 0, 0, 0, 0, 0, 0],
+  [0, 0, 0, 0, 0, 0, 0, 0], [0, 0, 0, 0, 0, 0, 0, 0], [0, 0, 0, 0, 0, 0, 0, 0], [-1, 0, 0, 0, 0, 0, 0, -1]]
+`
+	path := filepath.Join(t.TempDir(), "params.toml")
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	p, err := LoadParams(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := DefaultParams()
+	want.BishopPair = 45
+	want.PassedPawn = []int{0, 6, 12, 18, 32, 55, 90, 0}
+	want.PieceValues[game.Knight] = 325
+	want.PieceValues[game.Bishop] = 1000
+	want.PieceSquares[game.Rook] = [][]int{{0, 0, 0, 0, 0, 0, 0, 0}, {1, 1, 1, 1, 1, 1, 1, 1}, {0, 0, 0, 0, 0, 0, 0, 0},
+		{0, 0, 0, 0, 0, 0, 0, 0}, {0, 0, 0, 0, 0, 0, 0, 0}, {0, 0, 0, 0, 0, 0, 0, 0}, {0, 0, 0, 0, 0, 0, 0, 0},
+		{-1, 0, 0, 0, 0, 0, 0, -1}}
+	if !reflect.DeepEqual(p, want) {
+		t.Errorf("loaded %+v, want %+v", p, want)
+	}
+}
+
+func TestLoadParamsInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		err  string
+	}{
+		{"params.json", `{"PassedPawn": [1, 2, 3]}`, "PassedPawn has 3 values"},
+		{"params.json", `{"PieceSquares": {"Pawn": [[1, 2]]}}`, "PieceSquares[Pawn] has 1 rows"},
+		{"params.json", `{"PieceValues": {"Wizard": 1}}`, "unknown piece type"},
+		{"params.toml", "PassedPawn = [1, 2, 3]", "PassedPawn has 3 values"},
+		{"params.toml", "[PieceSquares]\nKing = [[1, 2, 3, 4, 5, 6, 7, 8]]", "PieceSquares[King] has 1 rows"},
+		{"params.toml", "BishopPair = thirty", "line 1: bad integer"},
+		{"params.toml", "BishopPair = 30\nBishopPair = 40", "line 2: key BishopPair defined twice"},
+		{"params.toml", "PassedPawn = [1, 2", "line 1: unclosed array"},
+		{"params.toml", "\n[PieceValues\nPawn = 1", "line 2: bad table"},
+		{"params.toml", "BishopPair", "line 1: expected key = value"},
+		{"params.toml", "BishopPair = 30 40", "line 1: bad integer"},
+		{"params.toml", "PassedPawn = [1, 2] 3", "line 1: unexpected"},
+	}
+	for _, test := range tests {
+		path := filepath.Join(t.TempDir(), test.name)
+		if err := os.WriteFile(path, []byte(test.data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadParams(path); err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%v %q: error %v, want %q", test.name, test.data, err, test.err)
+		}
+	}
+}
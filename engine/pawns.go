@@ -0,0 +1,192 @@
+package engine
+
+import (
+	"chess/game"
+	"math/bits"
+	"sync/atomic"
+)
+
+var pawnTable *pawnCache
+
+func pawnDir(state *game.State, player game.Player) int {
+	if player == state.Starter {
+		return -1
+	}
+	return 1
+}
+
+func relativeRank(state *game.State, player game.Player, row int) int {
+	if player == state.Starter {
+		return 7 - row
+	}
+	return row
+}
+
+// evalPawns returns the pawn structure evaluation from the pov of white and the squares (bit row*8+col) of all passed pawns,
+// it only depends on the pawns so it is cached by the pawn key unless cache is nil
+func evalPawns(state *game.State, pawnKey uint64, cache *pawnCache) (int, int, uint64) {
+	if cache != nil {
+		if mg, eg, passed, ok := cache.probe(pawnKey); ok {
+			return mg, eg, passed
+		}
+	}
+	var pawns [2][8][8]bool
+	for i := 0; i <= 7; i++ {
+		for j := 0; j <= 7; j++ {
+			if state.Board[i][j] != nil && state.Board[i][j].Type == game.Pawn {
+				pawns[state.Board[i][j].Owner][i][j] = true
+			}
+		}
+	}
+	whiteMg, whiteEg, whitePassed := evalPawnStructure(state, game.White, &pawns)
+	blackMg, blackEg, blackPassed := evalPawnStructure(state, game.Black, &pawns)
+	mg, eg, passed := whiteMg-blackMg, whiteEg-blackEg, whitePassed|blackPassed
+	if cache != nil {
+		cache.store(pawnKey, mg, eg, passed)
+	}
+	return mg, eg, passed
+}
+
+func evalPawnStructure(state *game.State, player game.Player, pawns *[2][8][8]bool) (int, int, uint64) {
+	var mg, eg int = 0, 0
+	var passed uint64 = 0
+	oppPlayer := (player + 1) % 2
+	dir := pawnDir(state, player)
+	own, opp := &pawns[player], &pawns[oppPlayer]
+	for j := 0; j <= 7; j++ {
+		numPawns := 0
+		for i := 0; i <= 7; i++ {
+			if !own[i][j] {
+				continue
+			}
+			numPawns++
+			rank := relativeRank(state, player, i)
+			isolated := true
+			supporters := 0 // own pawns on the adjacent files that are not ahead
+			sentries := 0   // opponent pawns on the adjacent files that are ahead
+			supported, phalanx, stopAttacked := false, false, false
+			for _, col := range []int{j - 1, j + 1} {
+				if col < 0 || col > 7 {
+					continue
+				}
+				for row := 0; row <= 7; row++ {
+					if own[row][col] {
+						isolated = false
+						if (row-i)*dir <= 0 {
+							supporters++
+						}
+					}
+					if opp[row][col] && (row-i)*dir > 0 {
+						sentries++
+					}
+				}
+				if game.OnBoard(game.Pos{X: i - dir, Y: col}) && own[i-dir][col] {
+					supported = true
+				}
+				if own[i][col] {
+					phalanx = true
+				}
+				if game.OnBoard(game.Pos{X: i + 2*dir, Y: col}) && opp[i+2*dir][col] {
+					stopAttacked = true
+				}
+			}
+			opposed := false
+			for row := 0; row <= 7; row++ {
+				if opp[row][j] && (row-i)*dir > 0 {
+					opposed = true
+				}
+			}
+
+			if isolated {
+				mg -= params.IsolatedPawn
+				eg -= params.IsolatedPawnEndGame
+			} else if supporters == 0 && stopAttacked {
+				mg -= params.BackwardPawn
+				eg -= params.BackwardPawnEndGame
+			}
+			if supported {
+				mg += params.ConnectedPawn[rank]
+				eg += params.ConnectedPawnEndGame[rank]
+			}
+			if phalanx {
+				mg += params.PhalanxPawn[rank]
+				eg += params.PhalanxPawnEndGame[rank]
+			}
+			if !opposed && sentries == 0 {
+				mg += params.PassedPawn[rank]
+				eg += params.PassedPawnEndGame[rank]
+				passed |= 1 << (i*8 + j)
+			} else if !opposed && supporters >= sentries {
+				mg += params.CandidatePawn[rank]
+				eg += params.CandidatePawnEndGame[rank]
+			}
+		}
+		if numPawns >= 2 { //doubled
+			mg -= params.DoubledPawn
+			eg -= params.DoubledPawnEndGame
+		}
+	}
+	return mg, eg, passed
+}
+
+// evalPassedPawnBlockage takes back part of the passed pawn bonus for the passed pawns of player that have a piece in front of them.
+// It depends on the pieces so it is not part of the cached pawn evaluation
+func evalPassedPawnBlockage(state *game.State, player game.Player, passed uint64) (int, int) {
+	var mg, eg int = 0, 0
+	for passed != 0 {
+		sq := bits.TrailingZeros64(passed)
+		passed &= passed - 1
+		i, j := sq/8, sq%8
+		front := i + pawnDir(state, player)
+		if state.Board[i][j].Owner != player || front < 0 || front > 7 || state.Board[front][j] == nil {
+			continue
+		}
+		rank := relativeRank(state, player, i)
+		mg -= params.PassedPawn[rank] * params.BlockedPassedPawnPercent / 100
+		eg -= params.PassedPawnEndGame[rank] * params.BlockedPassedPawnPercent / 100
+	}
+	return mg, eg
+}
+
+// same lock-free scheme as the transposition table, the key is xored with both data words
+type pawnEntry struct {
+	key    uint64
+	score  uint64
+	passed uint64
+}
+
+type pawnCache struct {
+	entries []pawnEntry
+	mask    uint64
+}
+
+func newPawnCache(numEntries uint64) *pawnCache {
+	return &pawnCache{entries: make([]pawnEntry, numEntries), mask: numEntries - 1}
+}
+
+func (cache *pawnCache) clear() {
+	for i := range cache.entries {
+		atomic.StoreUint64(&cache.entries[i].key, 0)
+		atomic.StoreUint64(&cache.entries[i].score, 0)
+		atomic.StoreUint64(&cache.entries[i].passed, 0)
+	}
+}
+
+func (cache *pawnCache) probe(hash uint64) (int, int, uint64, bool) {
+	entry := &cache.entries[hash&cache.mask]
+	key := atomic.LoadUint64(&entry.key)
+	score := atomic.LoadUint64(&entry.score)
+	passed := atomic.LoadUint64(&entry.passed)
+	if key^score^passed != hash {
+		return 0, 0, 0, false
+	}
+	return int(int32(uint32(score))), int(int32(uint32(score >> 32))), passed, true
+}
+
+func (cache *pawnCache) store(hash uint64, mg int, eg int, passed uint64) {
+	entry := &cache.entries[hash&cache.mask]
+	score := uint64(uint32(int32(mg))) | uint64(uint32(int32(eg)))<<32
+	atomic.StoreUint64(&entry.key, hash^score^passed)
+	atomic.StoreUint64(&entry.score, score)
+	atomic.StoreUint64(&entry.passed, passed)
+}
@@ -0,0 +1,115 @@
+package engine
+
+import (
+	"chess/game"
+	"fmt"
+	"strings"
+)
+
+// Personality is a playing style: changes to the evaluation weights and a contempt, what the engine takes off the score
+// of a draw for its own side so it avoids draws (or seeks them when negative)
+type Personality struct {
+	Name        string
+	Description string
+	Contempt    int
+	adjust      func(p *Params)
+}
+
+// Personalities are in the order the ui lists them, the first is the plain evaluation
+var Personalities []Personality = []Personality{
+	{Name: "balanced", Description: "the plain evaluation", adjust: func(p *Params) {}},
+	{Name: "aggressive", Description: "attacks the king and avoids trades", Contempt: 30, adjust: func(p *Params) {
+		scalePieceMap(p.KingAttackWeight, 3, 2)
+		p.MaxKingDanger = p.MaxKingDanger * 3 / 2
+		scalePieceMap(p.Mobility, 3, 2)
+		p.PawnShield /= 2
+		p.PawnShieldFar /= 2
+		p.MissingPawnShield /= 2
+		scaleMaterial(p, 9, 10, game.Pawn)
+	}},
+	{Name: "positional", Description: "cares for the pawns and the squares of the pieces", Contempt: 10, adjust: func(p *Params) {
+		for _, w := range []*int{&p.DoubledPawn, &p.IsolatedPawn, &p.BackwardPawn, &p.KnightOutpost, &p.BishopPair, &p.RookOpenFile, &p.RookSemiOpenFile} {
+			*w = *w * 3 / 2
+		}
+		scaleSlice(p.PassedPawn, 5, 4)
+		scaleSlice(p.ConnectedPawn, 3, 2)
+		scalePieceMap(p.Mobility, 5, 4)
+		scalePieceSquares(p.PieceSquares, 3, 2)
+		scalePieceSquares(p.PieceSquaresEndGame, 5, 4)
+	}},
+	{Name: "materialistic", Description: "grabs material and trusts it over activity", adjust: func(p *Params) {
+		scalePieceMap(p.Mobility, 1, 2)
+		scalePieceMap(p.KingAttackWeight, 2, 3)
+		p.HangingPiece *= 2
+		p.HangingPieceEndGame *= 2
+		p.ThreatByPawn = p.ThreatByPawn * 3 / 2
+		scaleMaterial(p, 6, 5, game.Pawn, game.Knight, game.Bishop, game.Rook, game.Queen)
+		scalePieceSquares(p.PieceSquares, 2, 3)
+		scalePieceSquares(p.PieceSquaresEndGame, 2, 3)
+	}},
+	{Name: "defensive", Description: "keeps the king safe and is happy with a draw", Contempt: -20, adjust: func(p *Params) {
+		p.PawnShield *= 2
+		p.PawnShieldFar *= 2
+		p.MissingPawnShield *= 2
+		p.KingSemiOpenFile *= 2
+		p.KingOpenFile *= 2
+		p.MaxKingDanger = p.MaxKingDanger * 3 / 2
+		scalePieceMap(p.KingAttackWeight, 3, 4)
+		scaleTable(p.PieceSquares[game.King], 2, 1)
+	}},
+}
+
+// DefaultPersonality is the name of the plain evaluation
+const DefaultPersonality string = "balanced"
+
+// FindPersonality looks a personality up by its (case insensitive) name
+func FindPersonality(name string) (Personality, error) {
+	for _, p := range Personalities {
+		if strings.EqualFold(p.Name, name) {
+			return p, nil
+		}
+	}
+	return Personality{}, fmt.Errorf("unknown personality %v", name)
+}
+
+func scalePieceMap(m PieceMap[int], num int, den int) {
+	for t, v := range m {
+		m[t] = v * num / den
+	}
+}
+
+// scaleMaterial changes the middle and end game values of the pieces of types
+func scaleMaterial(p *Params, num int, den int, types ...game.PieceType) {
+	for _, t := range types {
+		p.PieceValues[t] = p.PieceValues[t] * num / den
+		p.PieceValuesEndGame[t] = p.PieceValuesEndGame[t] * num / den
+	}
+}
+
+func scalePieceSquares(m PieceMap[[][]int], num int, den int) {
+	for _, table := range m {
+		scaleTable(table, num, den)
+	}
+}
+
+func scaleTable(table [][]int, num int, den int) {
+	for _, row := range table {
+		scaleSlice(row, num, den)
+	}
+}
+
+func scaleSlice(s []int, num int, den int) {
+	for i := range s {
+		s[i] = s[i] * num / den
+	}
+}
+
+// drawScore is the score of a draw from the pov of pov: the contempt is taken off for the side the search is for and
+// given to its opponent. The evaluations stay free of it, the search scores its draws with it: stalemates, captures
+// down to material that can't mate and the draws of the tablebases
+func (s *search) drawScore(pov game.Player) int {
+	if pov != s.player {
+		return s.contempt
+	}
+	return -s.contempt
+}
@@ -0,0 +1,321 @@
+package engine
+
+import (
+	"chess/game"
+	"chess/util"
+	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// search runs one or more workers on their own copy of the state, sharing the transposition table (lazy smp)
+type search struct {
+	player   game.Player
+	start    time.Time
+	stop     int32
+	limits   Limits
+	moveTime time.Duration
+	multiPV  int
+	skill    int
+	contempt int // contempt of the personality, see drawScore
+	report   func(Info)
+	workers  []*searchWorker
+
+	ponderHitOnce sync.Once
+	ponderHit     time.Time
+}
+
+type searchWorker struct {
+	id      int
+	s       *search
+	state   *game.State
+	nodes   uint64
+	depth   int // last completed depth
+	best    *game.Move
+	ev      int
+	lines   []Line            // of the last completed depth, best first
+	history [][]Line          // the lines of every completed depth
+	acc     *accumulatorStack // nil unless the evaluator is incremental
+}
+
+func newSearch(state *game.State, player game.Player, threads int, limits Limits, report func(Info)) *search {
+	skill := skillLevel()
+	limits = skillLimits(limits, skill)
+	s := &search{player: player, start: time.Now(), limits: limits, moveTime: limits.moveTime(), multiPV: util.Max(options.MultiPV, 1), skill: skill, report: report}
+	if skill < MaxSkill {
+		s.multiPV = util.Max(s.multiPV, skillLines)
+	}
+	if personality, err := FindPersonality(options.Personality); err == nil {
+		s.contempt = personality.Contempt
+	}
+	for i := 0; i < util.Max(threads, 1); i++ {
+		w := &searchWorker{id: i, s: s, state: state.Copy()}
+		w.state.Turn = player
+		if e, ok := evaluator.(incrementalEvaluator); ok {
+			w.acc = e.newAccumulator(w.state)
+		}
+		s.workers = append(s.workers, w)
+	}
+	return s
+}
+
+func (s *search) stopped() bool {
+	return atomic.LoadInt32(&s.stop) != 0
+}
+
+// limitReached is true once the search is told to stop or has used its time or nodes, searches until stopped
+// and pondering searches have no time limit
+func (s *search) limitReached() bool {
+	select {
+	case <-s.limits.Stop:
+		return true
+	default:
+	}
+	if s.limits.Nodes > 0 && s.nodes() >= s.limits.Nodes {
+		return true
+	}
+	if s.limits.Infinite {
+		return false
+	}
+	start := s.start
+	if s.limits.Ponder != nil {
+		select {
+		case <-s.limits.Ponder:
+		default:
+			return false
+		}
+		s.ponderHitOnce.Do(func() {
+			s.ponderHit = time.Now()
+		})
+		start = s.ponderHit
+	}
+	return time.Since(start) >= s.moveTime
+}
+
+func (s *search) nodes() uint64 {
+	var total uint64 = 0
+	for _, w := range s.workers {
+		total += atomic.LoadUint64(&w.nodes)
+	}
+	return total
+}
+
+// run searches until the main worker reaches the limits, then stops the helpers and returns the lines of the deepest result,
+// with the line the skill level picks first
+func (s *search) run() []Line {
+	var wg sync.WaitGroup
+	for _, w := range s.workers[1:] {
+		wg.Add(1)
+		go func(w *searchWorker) {
+			defer wg.Done()
+			w.iterate()
+		}(w)
+	}
+	s.workers[0].iterate()
+	atomic.StoreInt32(&s.stop, 1)
+	wg.Wait()
+
+	var best *searchWorker
+	for _, w := range s.workers {
+		if w.best == nil {
+			continue
+		}
+		if best == nil || w.depth > best.depth || (w.depth == best.depth && w.ev > best.ev) {
+			best = w
+		}
+	}
+	if best == nil {
+		return nil
+	}
+	return pickSkillLine(s.workers[0].state, s.player, best.lines, s.workers[0].history, s.skill, rand.New(rand.NewSource(time.Now().UnixNano())))
+}
+
+func (w *searchWorker) iterate() {
+	player := w.s.player
+	depth := startDepth + w.id%2 // helpers on odd threads search one ply ahead of the others
+	moves := getEngineMoves(w.state, player)
+	for !w.s.limitReached() && (w.s.limits.Depth == 0 || depth <= w.s.limits.Depth) {
+		currStart := time.Now()
+		currNodes := w.s.nodes()
+		// every line searches the moves left out of the lines before it, so the best moves end up in front in order
+		lines := []Line{}
+		for pv := 0; pv < util.Min(w.s.multiPV, len(moves)); pv++ {
+			best, moveI, ev := w.searchRoot(moves[pv:], player, depth, pv)
+			if w.s.stopped() || best == nil {
+				return
+			}
+			bestMove := *best
+			copy(moves[pv+1:pv+moveI+1], moves[pv:pv+moveI])
+			moves[pv] = bestMove
+			lines = append(lines, Line{Move: bestMove, Score: ev})
+		}
+		if len(lines) == 0 {
+			return
+		}
+		for i := range lines {
+			lines[i].PV = w.pv(lines[i].Move, depth)
+		}
+		w.lines, w.best, w.ev, w.depth = lines, &lines[0].Move, lines[0].Score, depth
+		w.history = append(w.history, lines)
+		if w.id == 0 {
+			if w.s.report != nil {
+				w.s.report(Info{Depth: depth, Nodes: w.s.nodes(), Time: time.Since(w.s.start), Lines: lines})
+			} else {
+				fmt.Printf("depth: %v, best: %v, kilo-nodes per second: %v\n", depth, w.best, float64(w.s.nodes()-currNodes)/time.Since(currStart).Seconds()/1000)
+			}
+		}
+		if isMateScore(w.ev) {
+			break
+		}
+		depth++
+	}
+}
+
+// searchRoot searches the root moves in a window around the score of line pv at the last depth, widening it until
+// the score falls inside
+func (w *searchWorker) searchRoot(moves []game.Move, player game.Player, depth int, pv int) (*game.Move, int, int) {
+	if pv >= len(w.lines) {
+		return w.getBestMove(moves, player, depth, 0, -infinity, infinity, Hash(w.state))
+	}
+	ev := w.lines[pv].Score
+	for window := 50; !w.s.stopped(); window *= 2 {
+		min, max := ev-window, ev+window
+		if window > 1000 {
+			min, max = -infinity, infinity
+		}
+		best, moveI, searched := w.getBestMove(moves, player, depth, 0, min, max, Hash(w.state))
+		if best == nil || (searched > min && searched < max) || (min == -infinity && max == infinity) {
+			return best, moveI, searched
+		}
+		ev = searched
+	}
+	return nil, -1, 0
+}
+
+// pv follows the transposition table from the root through m, it ends early where an entry was overwritten.
+// It stops before a move that leaves the king attacked or captures it, so it only has legal moves
+func (w *searchWorker) pv(m game.Move, depth int) []game.Move {
+	state := w.state.Copy()
+	player := w.s.player
+	state.Turn = player
+	hash := Hash(state)
+	pv := []game.Move{}
+	for len(pv) < depth {
+		if (m.Capture != nil && state.Board[m.Capture.X][m.Capture.Y].Type == game.King) || (len(pv) > 0 && state.LeavesKingAttacked(m, player)) {
+			break
+		}
+		pv = append(pv, m)
+		hash = RunMoveForHash(state, &m, hash)
+		player = (player + 1) % 2
+		state.Turn = player
+		entry, ok := tt.probe(hash)
+		if !ok || entry.move == noMove {
+			break
+		}
+		found := false
+		for _, next := range getEngineMoves(state, player) {
+			if encodeMove(&next) == entry.move {
+				m, found = next, true
+				break
+			}
+		}
+		if !found {
+			break
+		}
+	}
+	return pv
+}
+
+func (w *searchWorker) getBestMove(moves []game.Move, player game.Player, depth int, ply int, min, max int, currHash uint64) (*game.Move, int, int) {
+	nodes := atomic.AddUint64(&w.nodes, 1)
+	if w.id == 0 && nodes&1023 == 0 && w.best != nil && w.s.limitReached() {
+		atomic.StoreInt32(&w.s.stop, 1)
+	}
+	if w.s.stopped() {
+		return nil, -1, 0
+	}
+	state := w.state
+	state.Turn = player
+	origMin := min
+	if entry, ok := tt.probe(currHash); ok {
+		if ply > 0 && entry.depth >= depth {
+			ev := scoreFromTT(entry.eval, ply)
+			if entry.flag == ttExact || (entry.flag == ttLower && ev >= max) || (entry.flag == ttUpper && ev <= min) {
+				return nil, -1, ev
+			}
+		}
+		if ply > 0 {
+			orderTTMove(moves, entry.move)
+		}
+	}
+	if ply > 0 && depth >= options.SyzygyProbeDepth {
+		if ev, flag, ok := probeSearch(state, player, ply); ok {
+			if flag == ttExact { // draws, cursed wins and blessed losses included
+				ev += w.s.drawScore(player)
+			}
+			if flag == ttExact || (flag == ttLower && ev >= max) || (flag == ttUpper && ev <= min) {
+				tt.store(currHash, ttData{eval: scoreToTT(ev, ply), depth: depth, flag: flag, move: noMove})
+				return nil, -1, ev
+			}
+		}
+	}
+	bestI := -1
+	bestEval := -infinity
+	for i, m := range moves {
+		if m.Capture != nil && state.Board[m.Capture.X][m.Capture.Y].Type == game.King {
+			return &moves[i], i, mateScore - ply
+		}
+		oldHash := currHash
+
+		if w.acc != nil {
+			w.acc.push(state, &m)
+		}
+		currHash, undo := makeMove(state, &m, currHash)
+		state.Turn = (player + 1) % 2
+		var ev int
+		// a capture down to material neither side can mate with is a draw, unless it leaves the king to be captured
+		if m.Capture != nil && state.InsufficientMaterial(game.White) && state.InsufficientMaterial(game.Black) && !state.InCheck(player) {
+			ev = w.s.drawScore(player)
+		} else if depth == 1 {
+			ev = evalState(state, player, currHash, w.acc)
+		} else {
+			_, _, ev = w.getBestMove(getEngineMoves(state, (player+1)%2), (player+1)%2, depth-1, ply+1, -max, -min, currHash)
+			ev = -ev
+		}
+		state.Turn = player
+		unmakeMove(state, &m, undo)
+		if w.acc != nil {
+			w.acc.pop()
+		}
+		currHash = oldHash
+		if w.s.stopped() {
+			return nil, -1, 0
+		}
+		if ev > bestEval {
+			bestEval = ev
+			bestI = i
+		}
+		min = util.Max(min, bestEval)
+
+		if min >= max {
+			break
+		}
+	}
+	if bestI == -1 {
+		return nil, -1, -infinity
+	}
+	// every move loses the king, it is a stalemate when the king isn't attacked now
+	if bestEval == ply+1-mateScore && !state.InCheck(player) && len(state.LegalMoves(player)) == 0 {
+		bestEval = w.s.drawScore(player)
+	}
+	flag := ttExact
+	if bestEval <= origMin {
+		flag = ttUpper
+	} else if bestEval >= max {
+		flag = ttLower
+	}
+	tt.store(currHash, ttData{eval: scoreToTT(bestEval, ply), depth: depth, flag: flag, move: encodeMove(&moves[bestI])})
+	return &moves[bestI], bestI, bestEval
+}
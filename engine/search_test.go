@@ -0,0 +1,42 @@
+package engine
+
+import (
+	"chess/game"
+	"testing"
+)
+
+// TestDrawScore searches positions the search scores as draws, with the contempt of the player the search is for
+func TestDrawScore(t *testing.T) {
+	if transpositionEvals == nil {
+		Init()
+	}
+	tests := []struct {
+		name string
+		fen  string
+		draw bool
+	}{
+		{"stalemate", "7k/5Q2/6K1/8/8/8/8/8 b - - 0 1", true},
+		{"capture to KvK", "8/8/8/8/8/1k6/8/Kn6 w - - 0 1", true},
+		{"mate, capturing the queen leaves KvK with the king attacked", "7k/6Q1/6K1/8/8/8/8/8 b - - 0 1", false},
+	}
+	for _, test := range tests {
+		for _, contempt := range []int{0, 30, -20} {
+			NewGame()
+			state, err := game.NewStateFromFEN(test.fen)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s := newSearch(state, state.Turn, 1, Limits{Depth: 2}, nil)
+			s.contempt = contempt
+			w := s.workers[0]
+			_, _, ev := w.getBestMove(getEngineMoves(w.state, state.Turn), state.Turn, 2, 0, -infinity, infinity, Hash(w.state))
+			want := 1 - mateScore
+			if test.draw {
+				want = -contempt
+			}
+			if ev != want {
+				t.Errorf("%v with contempt %v: score %v, want %v", test.name, contempt, ev, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package engine
+
+import (
+	"chess/game"
+	"chess/util"
+	"math/rand"
+)
+
+// Below the top skill level the engine plays weaker: it searches shallower and fewer nodes, picks at random among
+// the near best moves, and now and then plays the move of a shallow search that misses the tactics in the position
+const (
+	MaxSkill     int = 20
+	MinElo       int = 800
+	MaxElo       int = 2400 // the Elo of the top skill level
+	skillLines   int = 4    // lines a weakened search looks at to pick from
+	blunderDepth int = 2
+)
+
+// skillLevel is the level set by the options, from the Elo when the strength is limited
+func skillLevel() int {
+	if options.LimitStrength {
+		elo := util.Max(MinElo, util.Min(options.Elo, MaxElo))
+		return 1 + (elo-MinElo)*(MaxSkill-1)/(MaxElo-MinElo)
+	}
+	return util.Max(1, util.Min(options.SkillLevel, MaxSkill))
+}
+
+// skillLimits narrows limits to the depth and nodes of level
+func skillLimits(limits Limits, level int) Limits {
+	if level >= MaxSkill {
+		return limits
+	}
+	depth := 2 + level/3 // at depth 1 the search doesn't see a move leaves the king attacked
+	nodes := uint64(1000) << (level / 2)
+	if limits.Depth == 0 || limits.Depth > depth {
+		limits.Depth = depth
+	}
+	if limits.Nodes == 0 || limits.Nodes > nodes {
+		limits.Nodes = nodes
+	}
+	return limits
+}
+
+// pickSkillLine returns the lines with the one to play first. Every line is pushed up by a part of how much
+// worse it is and a random part of the spread of the scores, both larger at lower levels, and the line with the
+// highest pushed score is played. Lines that get mated and illegal moves are left out
+func pickSkillLine(state *game.State, player game.Player, lines []Line, history [][]Line, level int, rng *rand.Rand) []Line {
+	if level >= MaxSkill || len(lines) == 0 {
+		return lines
+	}
+	// the chance to play the move of the shallow search goes from 2% a move at level 19 to 38% at level 1
+	if len(history) >= blunderDepth && rng.Intn(100) < 2*(MaxSkill-level) {
+		lines = history[blunderDepth-1]
+	}
+	weakness := 120 - 2*level
+	top := lines[0].Score
+	delta := util.Min(top-lines[len(lines)-1].Score, params.PieceValues[game.Pawn])
+	best, bestValue := -1, -infinity
+	for i, line := range lines {
+		if (i > 0 && isMateScore(line.Score) && line.Score < 0) || state.LeavesKingAttacked(line.Move, player) {
+			continue
+		}
+		push := (weakness*util.Min(top-line.Score, 1000) + delta*rng.Intn(weakness)) / 128
+		if line.Score+push > bestValue {
+			best, bestValue = i, line.Score+push
+		}
+	}
+	if best == -1 {
+		return lines
+	}
+	picked := append([]Line{lines[best]}, lines[:best]...)
+	return append(picked, lines[best+1:]...)
+}
@@ -0,0 +1,787 @@
+package engine
+
+import (
+	"chess/util"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Syzygy tablebase files, decoded as described by their author (Ronald de Man) and as done by the probing code of Stockfish.
+// Squares are numbered from a1 = 0 to h8 = 63 as seen by white, pieces are 1-6 for the white pawn, knight, bishop, rook,
+// queen and king and 9-14 for the black ones. Files are read into memory the first time they are probed.
+
+type tbType int
+
+const (
+	tbWDL tbType = iota
+	tbDTZ
+)
+
+const (
+	tbFlagSTM         int = 1
+	tbFlagMapped      int = 2
+	tbFlagWinPlies    int = 4
+	tbFlagLossPlies   int = 8
+	tbFlagWide        int = 16
+	tbFlagSingleValue int = 128
+)
+
+const (
+	tbMaxPieces  int = 7
+	tbWhitePawn  int = 1
+	tbWhiteKing  int = 6
+	tbBlackPiece int = 8 // added to the white piece
+)
+
+var (
+	tbMagics    map[tbType][]byte = map[tbType][]byte{tbWDL: {0x71, 0xE8, 0x23, 0x5D}, tbDTZ: {0xD7, 0x66, 0x0C, 0xA5}}
+	tbSuffixes  map[tbType]string = map[tbType]string{tbWDL: ".rtbw", tbDTZ: ".rtbz"}
+	tbPieceChar string            = "KQRBNP"
+	tbWDLToMap  []int             = []int{1, 3, 0, 2, 0} // by wdl + 2, the order of the dtz value maps in the file
+
+	tbIndexOnce   sync.Once
+	mapB1H1H7     [64]int
+	mapA1D1D4     [64]int
+	mapKK         [10][64]int
+	binomial      [6][64]uint64
+	mapPawns      [64]int
+	leadPawnIdx   [6][64]uint64
+	leadPawnsSize [6][4]uint64
+)
+
+func offA1H8(sq int) int {
+	return sq>>3 - sq&7
+}
+
+// initTBIndexes builds the tables used to turn the piece squares into an index into a table
+func initTBIndexes() {
+	code := 0
+	for sq := 0; sq < 64; sq++ {
+		if offA1H8(sq) < 0 {
+			mapB1H1H7[sq] = code
+			code++
+		}
+	}
+	code = 0
+	diagonal := []int{}
+	for sq := 0; sq <= 27; sq++ { // a1 to d4
+		if offA1H8(sq) < 0 && sq&7 <= 3 {
+			mapA1D1D4[sq] = code
+			code++
+		} else if offA1H8(sq) == 0 && sq&7 <= 3 {
+			diagonal = append(diagonal, sq)
+		}
+	}
+	for _, sq := range diagonal {
+		mapA1D1D4[sq] = code
+		code++
+	}
+
+	// the two kings, the first in the a1-d1-d4 triangle and the second not above the diagonal if the first is on it
+	type bothOnDiagonal struct{ idx, sq int }
+	both := []bothOnDiagonal{}
+	code = 0
+	for idx := 0; idx < 10; idx++ {
+		for s1 := 0; s1 <= 27; s1++ {
+			if mapA1D1D4[s1] != idx || (idx == 0 && s1 != 1) { // b1 is mapped to 0
+				continue
+			}
+			for s2 := 0; s2 < 64; s2++ {
+				if util.Abs(s1&7-s2&7) <= 1 && util.Abs(s1>>3-s2>>3) <= 1 {
+					continue
+				} else if offA1H8(s1) == 0 && offA1H8(s2) > 0 {
+					continue
+				} else if offA1H8(s1) == 0 && offA1H8(s2) == 0 {
+					both = append(both, bothOnDiagonal{idx, s2})
+				} else {
+					mapKK[idx][s2] = code
+					code++
+				}
+			}
+		}
+	}
+	for _, b := range both {
+		mapKK[b.idx][b.sq] = code
+		code++
+	}
+
+	binomial[0][0] = 1
+	for n := 1; n < 64; n++ {
+		for k := 0; k < 6 && k <= n; k++ {
+			if k > 0 {
+				binomial[k][n] += binomial[k-1][n-1]
+			}
+			if k < n {
+				binomial[k][n] += binomial[k][n-1]
+			}
+		}
+	}
+
+	// mapPawns numbers a2-h7 so that the leading pawn, the one closest to the edge and then the lowest, has the highest value
+	available := 47
+	for count := 1; count <= 5; count++ {
+		for file := 0; file <= 3; file++ {
+			var idx uint64 = 0
+			for rank := 1; rank <= 6; rank++ {
+				sq := rank*8 + file
+				if count == 1 {
+					mapPawns[sq] = available
+					available--
+					mapPawns[sq^7] = available
+					available--
+				}
+				leadPawnIdx[count][sq] = idx
+				idx += binomial[count-1][mapPawns[sq]]
+			}
+			leadPawnsSize[count][file] = idx
+		}
+	}
+}
+
+type pairsData struct {
+	flags           int
+	pieces          [tbMaxPieces]int
+	groupIdx        [tbMaxPieces + 1]uint64
+	groupLen        [tbMaxPieces + 1]int
+	sizeofBlock     uint64
+	span            uint64
+	sparseIndex     int // offsets into the file
+	sparseIndexSize int
+	blockLength     int
+	blockLengthSize int
+	data            int
+	blocksNum       int
+	lowestSym       int
+	btree           int
+	base64          []uint64
+	symlen          []uint8
+	minSymLen       int
+	maxSymLen       int
+	mapIdx          [4]int // dtz only
+}
+
+type tbTable struct {
+	typ             tbType
+	path            string
+	key             string // material of the table, like KRvK, with white as the first side
+	key2            string // with the sides swapped
+	pieceCount      int
+	hasPawns        bool
+	hasUniquePieces bool
+	pawnCount       [2]int // the leading color first
+
+	once   sync.Once
+	err    error
+	buf    []byte
+	items  [2][4]pairsData // side to move, file of the leading pawn
+	dtzMap int
+}
+
+func (t *tbTable) get(stm int, file int) *pairsData {
+	sides := 1
+	if t.typ == tbWDL && t.key != t.key2 {
+		sides = 2
+	}
+	if !t.hasPawns {
+		file = 0
+	}
+	return &t.items[stm%sides][file]
+}
+
+// tablebases are all the tables found in SyzygyPath, by material key
+type tablebases struct {
+	tables    map[tbType]map[string]*tbTable
+	maxPieces int
+	count     int
+}
+
+var syzygy *tablebases
+
+// materialKey is the name of a table with these piece counts, white first
+func materialKey(counts *[2][6]int, white int) string {
+	var sb strings.Builder
+	for i, side := range []int{white, 1 - white} {
+		if i == 1 {
+			sb.WriteByte('v')
+		}
+		for t := 0; t < 6; t++ {
+			sb.WriteString(strings.Repeat(string(tbPieceChar[t]), counts[side][t]))
+		}
+	}
+	return sb.String()
+}
+
+// parseMaterial reads the piece counts of both sides from a table name, indexed like tbPieceChar
+func parseMaterial(name string) (*[2][6]int, bool) {
+	sides := strings.Split(name, "v")
+	if len(sides) != 2 {
+		return nil, false
+	}
+	counts := &[2][6]int{}
+	for i, side := range sides {
+		if !strings.HasPrefix(side, "K") {
+			return nil, false
+		}
+		for _, c := range side {
+			t := strings.IndexRune(tbPieceChar, c)
+			if t == -1 {
+				return nil, false
+			}
+			counts[i][t]++
+		}
+		if counts[i][0] != 1 {
+			return nil, false
+		}
+	}
+	return counts, true
+}
+
+func newTBTable(typ tbType, path string, name string) (*tbTable, bool) {
+	counts, ok := parseMaterial(name)
+	if !ok {
+		return nil, false
+	}
+	t := &tbTable{typ: typ, path: path, key: materialKey(counts, 0), key2: materialKey(counts, 1)}
+	pawns := [2]int{counts[0][5], counts[1][5]}
+	for side := 0; side <= 1; side++ {
+		for i := 0; i < 6; i++ {
+			t.pieceCount += counts[side][i]
+			if i != 0 && counts[side][i] == 1 {
+				t.hasUniquePieces = true
+			}
+		}
+	}
+	t.hasPawns = pawns[0]+pawns[1] > 0
+	// with pawns on both sides the side with fewer pawns leads, it compresses better
+	if pawns[1] == 0 || (pawns[0] > 0 && pawns[1] >= pawns[0]) {
+		t.pawnCount = pawns
+	} else {
+		t.pawnCount = [2]int{pawns[1], pawns[0]}
+	}
+	return t, t.pieceCount <= tbMaxPieces
+}
+
+// loadTablebases finds the tables in the directories of path, separated like PATH
+func loadTablebases(path string) (*tablebases, error) {
+	tbIndexOnce.Do(initTBIndexes)
+	tb := &tablebases{tables: map[tbType]map[string]*tbTable{tbWDL: {}, tbDTZ: {}}}
+	for _, dir := range filepath.SplitList(path) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			for typ, suffix := range tbSuffixes {
+				name := entry.Name()
+				if entry.IsDir() || !strings.HasSuffix(name, suffix) {
+					continue
+				}
+				t, ok := newTBTable(typ, filepath.Join(dir, name), strings.TrimSuffix(name, suffix))
+				if !ok {
+					continue
+				}
+				if _, exists := tb.tables[typ][t.key]; exists {
+					continue
+				}
+				tb.tables[typ][t.key] = t
+				tb.tables[typ][t.key2] = t
+				if typ == tbWDL {
+					tb.count++
+					tb.maxPieces = util.Max(tb.maxPieces, t.pieceCount)
+				}
+			}
+		}
+	}
+	return tb, nil
+}
+
+// load reads the file and its headers the first time the table is probed
+func (t *tbTable) load() error {
+	t.once.Do(func() {
+		buf, err := os.ReadFile(t.path)
+		if err != nil {
+			t.err = err
+			return
+		}
+		if len(buf) < 5 || string(buf[:4]) != string(tbMagics[t.typ]) {
+			t.err = fmt.Errorf("%v: not a syzygy table", t.path)
+			return
+		}
+		t.buf = buf
+		defer func() { // a corrupt file reads out of range
+			if r := recover(); r != nil {
+				t.buf = nil
+				t.err = fmt.Errorf("%v: corrupt table: %v", t.path, r)
+			}
+		}()
+		t.err = t.setup()
+	})
+	return t.err
+}
+
+func (t *tbTable) setup() error {
+	data := 4
+	flags := int(t.buf[data])
+	if (flags&2 != 0) != t.hasPawns || (t.typ == tbWDL && (flags&1 != 0) != (t.key != t.key2)) {
+		return fmt.Errorf("%v: table does not match its name", t.path)
+	}
+	data++
+	sides := 1
+	if t.typ == tbWDL && t.key != t.key2 {
+		sides = 2
+	}
+	maxFile := 0
+	if t.hasPawns {
+		maxFile = 3
+	}
+	pp := t.hasPawns && t.pawnCount[1] > 0 // pawns on both sides
+	for f := 0; f <= maxFile; f++ {
+		order := [2][2]int{{int(t.buf[data] & 0xF), 0xF}, {int(t.buf[data] >> 4), 0xF}}
+		if pp {
+			order[0][1] = int(t.buf[data+1] & 0xF)
+			order[1][1] = int(t.buf[data+1] >> 4)
+			data++
+		}
+		data++
+		for k := 0; k < t.pieceCount; k++ {
+			for i := 0; i < sides; i++ {
+				if i == 0 {
+					t.items[i][f].pieces[k] = int(t.buf[data] & 0xF)
+				} else {
+					t.items[i][f].pieces[k] = int(t.buf[data] >> 4)
+				}
+			}
+			data++
+		}
+		for i := 0; i < sides; i++ {
+			t.setGroups(&t.items[i][f], order[i], f)
+		}
+	}
+	data += data & 1
+	for f := 0; f <= maxFile; f++ {
+		for i := 0; i < sides; i++ {
+			data = t.setSizes(&t.items[i][f], data)
+		}
+	}
+	if t.typ == tbDTZ {
+		t.dtzMap = data
+		for f := 0; f <= maxFile; f++ {
+			d := &t.items[0][f]
+			if d.flags&tbFlagMapped == 0 {
+				continue
+			}
+			if d.flags&tbFlagWide != 0 {
+				data += data & 1
+				for i := 0; i < 4; i++ {
+					d.mapIdx[i] = (data-t.dtzMap)/2 + 1
+					data += 2*int(binary.LittleEndian.Uint16(t.buf[data:])) + 2
+				}
+			} else {
+				for i := 0; i < 4; i++ {
+					d.mapIdx[i] = data - t.dtzMap + 1
+					data += int(t.buf[data]) + 1
+				}
+			}
+		}
+		data += data & 1
+	}
+	for f := 0; f <= maxFile; f++ {
+		for i := 0; i < sides; i++ {
+			t.items[i][f].sparseIndex = data
+			data += t.items[i][f].sparseIndexSize * 6
+		}
+	}
+	for f := 0; f <= maxFile; f++ {
+		for i := 0; i < sides; i++ {
+			t.items[i][f].blockLength = data
+			data += t.items[i][f].blockLengthSize * 2
+		}
+	}
+	for f := 0; f <= maxFile; f++ {
+		for i := 0; i < sides; i++ {
+			d := &t.items[i][f]
+			if d.blocksNum > 0 {
+				data = (data + 0x3F) &^ 0x3F
+			}
+			d.data = data
+			data += d.blocksNum * int(d.sizeofBlock)
+		}
+	}
+	if data > len(t.buf) {
+		return fmt.Errorf("%v: table is truncated", t.path)
+	}
+	return nil
+}
+
+// setGroups splits the pieces into the groups that are encoded together, in the order of the file. An index is
+// g1 * N(g2) * N(g3) + g2 * N(g3) + g3 where N(g) is the number of ways the pieces of group g can be placed
+func (t *tbTable) setGroups(d *pairsData, order [2]int, file int) {
+	n := 0
+	firstLen := 2
+	if t.hasPawns {
+		firstLen = 0
+	} else if t.hasUniquePieces {
+		firstLen = 3
+	}
+	d.groupLen[n] = 1
+	for i := 1; i < t.pieceCount; i++ {
+		firstLen--
+		if firstLen > 0 || d.pieces[i] == d.pieces[i-1] {
+			d.groupLen[n]++
+		} else {
+			n++
+			d.groupLen[n] = 1
+		}
+	}
+	n++
+	d.groupLen[n] = 0
+
+	pp := t.hasPawns && t.pawnCount[1] > 0
+	next := 1
+	freeSquares := 64 - d.groupLen[0]
+	if pp {
+		next = 2
+		freeSquares -= d.groupLen[1]
+	}
+	var idx uint64 = 1
+	for k := 0; next < n || k == order[0] || k == order[1]; k++ {
+		if k == order[0] { // leading pawns or pieces
+			d.groupIdx[0] = idx
+			if t.hasPawns {
+				idx *= leadPawnsSize[d.groupLen[0]][file]
+			} else if t.hasUniquePieces {
+				idx *= 31332
+			} else {
+				idx *= 462
+			}
+		} else if k == order[1] { // remaining pawns
+			d.groupIdx[1] = idx
+			idx *= binomial[d.groupLen[1]][48-d.groupLen[0]]
+		} else { // remaining pieces
+			d.groupIdx[next] = idx
+			idx *= binomial[d.groupLen[next]][freeSquares]
+			freeSquares -= d.groupLen[next]
+			next++
+		}
+	}
+	d.groupIdx[n] = idx
+}
+
+func (t *tbTable) setSizes(d *pairsData, data int) int {
+	buf := t.buf
+	d.flags = int(buf[data])
+	data++
+	if d.flags&tbFlagSingleValue != 0 {
+		d.minSymLen = int(buf[data]) // the value
+		return data + 1
+	}
+	n := 0
+	for d.groupLen[n] != 0 {
+		n++
+	}
+	tbSize := d.groupIdx[n]
+	d.sizeofBlock = 1 << buf[data]
+	d.span = 1 << buf[data+1]
+	d.sparseIndexSize = int((tbSize + d.span - 1) / d.span)
+	padding := int(buf[data+2])
+	d.blocksNum = int(binary.LittleEndian.Uint32(buf[data+3:]))
+	d.blockLengthSize = d.blocksNum + padding
+	d.maxSymLen = int(buf[data+7])
+	d.minSymLen = int(buf[data+8])
+	data += 9
+	d.lowestSym = data
+	d.base64 = make([]uint64, d.maxSymLen-d.minSymLen+1)
+
+	// canonical huffman code, longer symbols have lower values so base64[i] >= base64[i+1]
+	lowestSym := func(i int) uint64 {
+		return uint64(binary.LittleEndian.Uint16(buf[d.lowestSym+2*i:]))
+	}
+	for i := len(d.base64) - 2; i >= 0; i-- {
+		d.base64[i] = (d.base64[i+1] + lowestSym(i) - lowestSym(i+1)) / 2
+	}
+	for i := range d.base64 {
+		d.base64[i] <<= 64 - i - d.minSymLen
+	}
+	data += len(d.base64) * 2
+	d.symlen = make([]uint8, binary.LittleEndian.Uint16(buf[data:]))
+	data += 2
+	d.btree = data
+
+	// recursive pairing, every symbol stands for a pair of symbols
+	visited := make([]bool, len(d.symlen))
+	for s := range d.symlen {
+		if !visited[s] {
+			d.symlen[s] = t.setSymlen(d, s, visited)
+		}
+	}
+	return data + len(d.symlen)*3 + len(d.symlen)&1
+}
+
+func (t *tbTable) setSymlen(d *pairsData, s int, visited []bool) uint8 {
+	visited[s] = true
+	left, right := t.pair(d, s)
+	if right == 0xFFF {
+		return 0
+	}
+	if !visited[left] {
+		d.symlen[left] = t.setSymlen(d, left, visited)
+	}
+	if !visited[right] {
+		d.symlen[right] = t.setSymlen(d, right, visited)
+	}
+	return d.symlen[left] + d.symlen[right] + 1
+}
+
+// pair is the left and right symbol of s, 12 bits each, a leaf stores its value as the left symbol
+func (t *tbTable) pair(d *pairsData, s int) (int, int) {
+	lr := t.buf[d.btree+3*s:]
+	return int(lr[1]&0xF)<<8 | int(lr[0]), int(lr[2])<<4 | int(lr[1]>>4)
+}
+
+// decompress returns the value stored at idx
+func (t *tbTable) decompress(d *pairsData, idx uint64) int {
+	if d.flags&tbFlagSingleValue != 0 {
+		return d.minSymLen
+	}
+	buf := t.buf
+
+	// the sparse index points into the block lengths every span values, from there walk the blocks to the one holding idx
+	k := idx / d.span
+	entry := buf[d.sparseIndex+6*int(k):]
+	block := int(binary.LittleEndian.Uint32(entry))
+	offset := int(binary.LittleEndian.Uint16(entry[4:]))
+	offset += int(idx%d.span) - int(d.span/2)
+	blockLength := func(b int) int {
+		return int(binary.LittleEndian.Uint16(buf[d.blockLength+2*b:]))
+	}
+	for offset < 0 {
+		block--
+		offset += blockLength(block) + 1
+	}
+	for offset > blockLength(block) {
+		offset -= blockLength(block) + 1
+		block++
+	}
+
+	ptr := d.data + block*int(d.sizeofBlock)
+	buf64 := binary.BigEndian.Uint64(buf[ptr:])
+	ptr += 8
+	buf64Size := 64
+	var sym int
+	for {
+		l := 0
+		for buf64 < d.base64[l] {
+			l++
+		}
+		sym = int((buf64-d.base64[l])>>(64-l-d.minSymLen)) + int(binary.LittleEndian.Uint16(buf[d.lowestSym+2*l:]))
+		if offset < int(d.symlen[sym])+1 {
+			break
+		}
+		offset -= int(d.symlen[sym]) + 1
+		l += d.minSymLen
+		buf64 <<= l
+		buf64Size -= l
+		if buf64Size <= 32 {
+			buf64Size += 32
+			buf64 |= uint64(binary.BigEndian.Uint32(buf[ptr:])) << (64 - buf64Size)
+			ptr += 4
+		}
+	}
+
+	// expand the symbol to the value at offset
+	for d.symlen[sym] != 0 {
+		left, right := t.pair(d, sym)
+		if offset < int(d.symlen[left])+1 {
+			sym = left
+		} else {
+			offset -= int(d.symlen[left]) + 1
+			sym = right
+		}
+	}
+	left, _ := t.pair(d, sym)
+	return left
+}
+
+// tbPiece is a piece on a square, both as in the tables
+type tbPiece struct {
+	sq    int
+	piece int
+}
+
+// probe finds the value of the position with stm to move, pieces are all the pieces of the position by ascending square.
+// With flip the colors are swapped and the board mirrored to match the table. ok is false for a dtz table that
+// only stores the other side to move
+func (t *tbTable) probe(pieces []tbPiece, stm int, flip bool, wdl int) (int, bool) {
+	d, tbFile, idx := t.index(pieces, stm, flip)
+	if t.typ == tbDTZ && d.flags&tbFlagSTM != stm && !(t.key == t.key2 && !t.hasPawns) {
+		return 0, false
+	}
+	value := t.decompress(d, idx)
+	if t.typ == tbWDL {
+		return value - 2, true
+	}
+	return t.mapScore(tbFile, value, wdl), true
+}
+
+// index is the part of the table holding the position, the file of its leading pawn and the index of the position in it
+func (t *tbTable) index(pieces []tbPiece, stm int, flip bool) (*pairsData, int, uint64) {
+	squares := make([]int, 0, tbMaxPieces)
+	codes := make([]int, 0, tbMaxPieces)
+	flipColor, flipSquares := 0, 0
+	if flip {
+		flipColor, flipSquares = tbBlackPiece, 56
+	}
+	leadPawnsCount := 0
+	tbFile := 0
+	others := pieces
+	if t.hasPawns {
+		// the pawns of the color of the first piece of the tables lead
+		leadPiece := t.items[0][0].pieces[0] ^ flipColor
+		others = []tbPiece{}
+		for _, p := range pieces {
+			if p.piece == leadPiece {
+				squares = append(squares, p.sq^flipSquares)
+				codes = append(codes, p.piece^flipColor)
+			} else {
+				others = append(others, p)
+			}
+		}
+		leadPawnsCount = len(squares)
+		best := 0
+		for i := 1; i < leadPawnsCount; i++ {
+			if mapPawns[squares[i]] > mapPawns[squares[best]] {
+				best = i
+			}
+		}
+		squares[0], squares[best] = squares[best], squares[0]
+		tbFile = squares[0] & 7
+		if tbFile > 3 {
+			tbFile = (squares[0] ^ 7) & 7
+		}
+	}
+	for _, p := range others {
+		squares = append(squares, p.sq^flipSquares)
+		codes = append(codes, p.piece^flipColor)
+	}
+	size := len(squares)
+	d := t.get(stm, tbFile)
+
+	// order the pieces as in the table
+	for i := leadPawnsCount; i < size-1; i++ {
+		for j := i + 1; j < size; j++ {
+			if d.pieces[i] == codes[j] {
+				codes[i], codes[j] = codes[j], codes[i]
+				squares[i], squares[j] = squares[j], squares[i]
+				break
+			}
+		}
+	}
+	if squares[0]&7 > 3 {
+		for i := range squares {
+			squares[i] ^= 7
+		}
+	}
+
+	var idx uint64
+	if t.hasPawns {
+		idx = leadPawnIdx[leadPawnsCount][squares[0]]
+		lead := squares[1:leadPawnsCount]
+		sort.SliceStable(lead, func(i, j int) bool {
+			return mapPawns[lead[i]] < mapPawns[lead[j]]
+		})
+		for i := 1; i < leadPawnsCount; i++ {
+			idx += binomial[i][mapPawns[squares[i]]]
+		}
+	} else {
+		if squares[0]>>3 > 3 {
+			for i := range squares {
+				squares[i] ^= 56
+			}
+		}
+		// the first piece of the leading group off the a1-h8 diagonal goes below it
+		for i := 0; i < d.groupLen[0]; i++ {
+			if offA1H8(squares[i]) == 0 {
+				continue
+			}
+			if offA1H8(squares[i]) > 0 {
+				for j := i; j < size; j++ {
+					squares[j] = ((squares[j] >> 3) | (squares[j] << 3)) & 63
+				}
+			}
+			break
+		}
+		if t.hasUniquePieces {
+			adjust1, adjust2 := 0, 0
+			if squares[1] > squares[0] {
+				adjust1 = 1
+			}
+			if squares[2] > squares[0] {
+				adjust2++
+			}
+			if squares[2] > squares[1] {
+				adjust2++
+			}
+			rank := func(sq int) int { return sq >> 3 }
+			if offA1H8(squares[0]) != 0 {
+				idx = uint64((mapA1D1D4[squares[0]]*63+squares[1]-adjust1)*62 + squares[2] - adjust2)
+			} else if offA1H8(squares[1]) != 0 {
+				idx = uint64((6*63+rank(squares[0])*28+mapB1H1H7[squares[1]])*62 + squares[2] - adjust2)
+			} else if offA1H8(squares[2]) != 0 {
+				idx = uint64(6*63*62 + 4*28*62 + rank(squares[0])*7*28 + (rank(squares[1])-adjust1)*28 + mapB1H1H7[squares[2]])
+			} else {
+				idx = uint64(6*63*62 + 4*28*62 + 4*7*28 + rank(squares[0])*7*6 + (rank(squares[1])-adjust1)*6 + rank(squares[2]) - adjust2)
+			}
+		} else {
+			idx = uint64(mapKK[mapA1D1D4[squares[0]]][squares[1]])
+		}
+	}
+
+	// the remaining groups, each by its squares in ascending order, mapped down past the squares of the groups before it
+	idx *= d.groupIdx[0]
+	start := d.groupLen[0]
+	remainingPawns := t.hasPawns && t.pawnCount[1] > 0
+	for next := 1; d.groupLen[next] != 0; next++ {
+		group := squares[start : start+d.groupLen[next]]
+		sort.Ints(group)
+		var n uint64 = 0
+		for i, sq := range group {
+			adjust := 0
+			for _, s := range squares[:start] {
+				if sq > s {
+					adjust++
+				}
+			}
+			if remainingPawns {
+				adjust += 8
+			}
+			n += binomial[i+1][sq-adjust]
+		}
+		remainingPawns = false
+		idx += n * d.groupIdx[next]
+		start += d.groupLen[next]
+	}
+	return d, tbFile, idx
+}
+
+// mapScore turns a dtz table value into plies
+func (t *tbTable) mapScore(file int, value int, wdl int) int {
+	d := t.get(0, file)
+	if d.flags&tbFlagMapped != 0 {
+		i := d.mapIdx[tbWDLToMap[wdl+2]] + value
+		if d.flags&tbFlagWide != 0 {
+			value = int(binary.LittleEndian.Uint16(t.buf[t.dtzMap+2*i:]))
+		} else {
+			value = int(t.buf[t.dtzMap+i])
+		}
+	}
+	if (wdl == tbWin && d.flags&tbFlagWinPlies == 0) || (wdl == tbLoss && d.flags&tbFlagLossPlies == 0) ||
+		wdl == tbCursedWin || wdl == tbBlessedLoss {
+		value *= 2
+	}
+	return value + 1
+}
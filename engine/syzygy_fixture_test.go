@@ -0,0 +1,682 @@
+package engine
+
+import (
+	"chess/game"
+	"chess/util"
+	"container/heap"
+	"encoding/binary"
+	"flag"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// The tables of testdata/syzygy are written by TestWriteSyzygyFixture: the endgames of a king and a queen, rook or pawn
+// against the king are solved backwards from the mates, and compressed as the probing code reads them. Their wins are
+// all within the 50 move rule, the dtz tables store white to move in plies
+
+var updateSyzygy = flag.Bool("update-syzygy", false, "write the syzygy tables of testdata/syzygy")
+
+const (
+	fxUnknown int8 = 3 // not solved yet
+	fxIllegal int8 = 4
+
+	fxBlockLog int = 6  // 64 byte blocks
+	fxSpanLog  int = 10 // a sparse index entry every 1024 values
+)
+
+// fxTable is the solution of a king and a white piece against the king, by fxIndex. Squares are as in the tables,
+// a1 is 0 and white moves up the board
+type fxTable struct {
+	name  string
+	piece int    // table code of the white piece
+	wdl   []int8 // for the side to move
+	dtz   []int  // plies to the next capture or pawn move or mate, of the wins and losses
+	mated []bool
+}
+
+// fxMove goes to the position next of the same table, or out of it to a result for the side to move then when next is -1
+type fxMove struct {
+	next    int
+	result  int8
+	zeroing bool
+}
+
+func fxIndex(wk int, bk int, sq int, stm int) int {
+	return stm<<18 | wk<<12 | bk<<6 | sq
+}
+
+func fxSquares(i int) (wk int, bk int, sq int, stm int) {
+	return i >> 12 & 63, i >> 6 & 63, i & 63, i >> 18
+}
+
+func fxAdjacent(a int, b int) bool {
+	return util.Abs(a&7-b&7) <= 1 && util.Abs(a>>3-b>>3) <= 1
+}
+
+// fxAttacks is true when the white piece on sq attacks target, a piece on block is in the way
+func fxAttacks(piece int, sq int, target int, block int) bool {
+	df, dr := target&7-sq&7, target>>3-sq>>3
+	if piece == tbWhitePawn {
+		return dr == 1 && util.Abs(df) == 1
+	}
+	if (df == 0 && dr == 0) || !(df == 0 || dr == 0 || (piece == tbPieceCodes[game.Queen] && util.Abs(df) == util.Abs(dr))) {
+		return false
+	}
+	step := sign(dr)*8 + sign(df)
+	for s := sq + step; s != target; s += step {
+		if s == block {
+			return false
+		}
+	}
+	return true
+}
+
+func (t *fxTable) legal(wk int, bk int, sq int, stm int) bool {
+	if wk == bk || wk == sq || bk == sq || fxAdjacent(wk, bk) {
+		return false
+	}
+	if t.piece == tbWhitePawn && (sq>>3 == 0 || sq>>3 == 7) {
+		return false
+	}
+	return stm == 1 || !fxAttacks(t.piece, sq, bk, wk)
+}
+
+func fxKingSteps(sq int) []int {
+	steps := []int{}
+	for dr := -1; dr <= 1; dr++ {
+		for df := -1; df <= 1; df++ {
+			r, f := sq>>3+dr, sq&7+df
+			if (dr != 0 || df != 0) && r >= 0 && r <= 7 && f >= 0 && f <= 7 {
+				steps = append(steps, r*8+f)
+			}
+		}
+	}
+	return steps
+}
+
+// moves are the legal moves of the position, promotions end in the tables solved before
+func (t *fxTable) moves(wk int, bk int, sq int, stm int, promotions map[int]*fxTable) []fxMove {
+	moves := []fxMove{}
+	if stm == 1 {
+		for _, to := range fxKingSteps(bk) {
+			if to == wk || fxAdjacent(to, wk) {
+				continue
+			}
+			if to == sq {
+				moves = append(moves, fxMove{next: -1, result: int8(tbDraw), zeroing: true})
+			} else if !fxAttacks(t.piece, sq, to, wk) {
+				moves = append(moves, fxMove{next: fxIndex(wk, to, sq, 0)})
+			}
+		}
+		return moves
+	}
+	for _, to := range fxKingSteps(wk) {
+		if to != sq && !fxAdjacent(to, bk) {
+			moves = append(moves, fxMove{next: fxIndex(to, bk, sq, 1)})
+		}
+	}
+	if t.piece != tbWhitePawn {
+		for _, dr := range []int{-1, 0, 1} {
+			for _, df := range []int{-1, 0, 1} {
+				if (dr == 0 && df == 0) || (t.piece != tbPieceCodes[game.Queen] && dr != 0 && df != 0) {
+					continue
+				}
+				for r, f := sq>>3+dr, sq&7+df; r >= 0 && r <= 7 && f >= 0 && f <= 7 && r*8+f != wk && r*8+f != bk; r, f = r+dr, f+df {
+					moves = append(moves, fxMove{next: fxIndex(wk, bk, r*8+f, 1)})
+				}
+			}
+		}
+		return moves
+	}
+	to := sq + 8
+	if to == wk || to == bk {
+		return moves
+	}
+	if to>>3 == 7 {
+		for _, p := range []game.PieceType{game.Queen, game.Rook, game.Bishop, game.Knight} {
+			result := tbDraw
+			if promoted, ok := promotions[tbPieceCodes[p]]; ok {
+				result = int(promoted.wdl[fxIndex(wk, bk, to, 1)])
+			}
+			moves = append(moves, fxMove{next: -1, result: int8(result), zeroing: true})
+		}
+		return moves
+	}
+	moves = append(moves, fxMove{next: fxIndex(wk, bk, to, 1), zeroing: true})
+	if sq>>3 == 1 && to+8 != wk && to+8 != bk {
+		moves = append(moves, fxMove{next: fxIndex(wk, bk, to+8, 1), zeroing: true})
+	}
+	return moves
+}
+
+func (t *fxTable) result(m fxMove) int8 {
+	if m.next == -1 {
+		return m.result
+	}
+	return t.wdl[m.next]
+}
+
+// solveFixture finds the wins and losses by going over the positions until none changes, then the dtz of every
+// win and loss by rounds: a win takes the quickest way to a zeroing move or mate, a loss the slowest
+func solveFixture(test *testing.T, name string, piece int, promotions map[int]*fxTable) *fxTable {
+	n := 2 << 18
+	t := &fxTable{name: name, piece: piece, wdl: make([]int8, n), dtz: make([]int, n), mated: make([]bool, n)}
+	moves := make([][]fxMove, n)
+	for i := range t.wdl {
+		wk, bk, sq, stm := fxSquares(i)
+		if !t.legal(wk, bk, sq, stm) {
+			t.wdl[i] = fxIllegal
+			continue
+		}
+		t.wdl[i] = fxUnknown
+		moves[i] = t.moves(wk, bk, sq, stm, promotions)
+		if len(moves[i]) == 0 {
+			t.wdl[i] = int8(tbDraw)
+			if stm == 1 && fxAttacks(piece, sq, bk, wk) {
+				t.wdl[i], t.mated[i] = int8(tbLoss), true
+			}
+		}
+	}
+	for changed := true; changed; {
+		changed = false
+		for i, v := range t.wdl {
+			if v != fxUnknown {
+				continue
+			}
+			win, allWins := false, true
+			for _, m := range moves[i] {
+				r := t.result(m)
+				win = win || r == int8(tbLoss)
+				allWins = allWins && r == int8(tbWin)
+			}
+			if win {
+				t.wdl[i], changed = int8(tbWin), true
+			} else if allWins {
+				t.wdl[i], changed = int8(tbLoss), true
+			}
+		}
+	}
+	left := 0
+	for i, v := range t.wdl {
+		if v == fxUnknown {
+			t.wdl[i] = int8(tbDraw)
+		}
+		if v == int8(tbWin) || v == int8(tbLoss) {
+			left++
+		}
+	}
+	for level := 1; left > 0; level++ {
+		if level > 256 {
+			test.Fatalf("%v: %v wins and losses without a dtz", name, left)
+		}
+		for i, v := range t.wdl {
+			if t.dtz[i] != 0 || (v != int8(tbWin) && v != int8(tbLoss)) {
+				continue
+			}
+			found := false
+			if v == int8(tbWin) {
+				for _, m := range moves[i] {
+					if t.result(m) != int8(tbLoss) {
+						continue
+					}
+					if level == 1 && (m.zeroing || t.mated[m.next]) { // a non zeroing move stays in the table
+						found = true
+					} else if level > 1 && !m.zeroing && t.dtz[m.next] == level-1 {
+						found = true
+					}
+				}
+			} else if t.mated[i] {
+				found = level == 1
+			} else {
+				longest := 0
+				for _, m := range moves[i] {
+					d := 1
+					if !m.zeroing {
+						d = t.dtz[m.next] + 1
+						if t.dtz[m.next] == 0 || t.dtz[m.next] == level {
+							d = 0 // not known before this round
+						}
+					}
+					if d == 0 {
+						longest = 0
+						break
+					}
+					longest = util.Max(longest, d)
+				}
+				found = longest == level
+			}
+			if found {
+				t.dtz[i] = level
+				left--
+			}
+		}
+	}
+	return t
+}
+
+// fxPart is a compressed part of a table: the sizes with the symbols, the sparse index, the block lengths and the blocks
+type fxPart struct {
+	sizes     []byte
+	sparse    []byte
+	lengths   []byte
+	blocks    []byte
+	blocksNum int
+}
+
+type fxSymbol struct {
+	left, right int
+	values      int
+}
+
+// fxHuffman is a heap of trees of symbols by weight
+type fxHuffman []fxHuffmanNode
+
+type fxHuffmanNode struct {
+	weight, id  int
+	left, right int // -1 for a symbol
+}
+
+func (h fxHuffman) Len() int { return len(h) }
+func (h fxHuffman) Less(i, j int) bool {
+	return h[i].weight < h[j].weight || (h[i].weight == h[j].weight && h[i].id < h[j].id)
+}
+func (h fxHuffman) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *fxHuffman) Push(x interface{}) { *h = append(*h, x.(fxHuffmanNode)) }
+func (h *fxHuffman) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// codeLengths are the huffman code lengths of the symbols, 0 for the ones with no weight
+func codeLengths(weights []int) []int {
+	nodes := []fxHuffmanNode{}
+	h := &fxHuffman{}
+	for _, w := range weights {
+		if w > 0 {
+			nodes = append(nodes, fxHuffmanNode{w, len(nodes), -1, -1})
+			heap.Push(h, nodes[len(nodes)-1])
+		}
+	}
+	symbols := []int{}
+	for s, w := range weights {
+		if w > 0 {
+			symbols = append(symbols, s)
+		}
+	}
+	for h.Len() > 1 {
+		a, b := heap.Pop(h).(fxHuffmanNode), heap.Pop(h).(fxHuffmanNode)
+		nodes = append(nodes, fxHuffmanNode{a.weight + b.weight, len(nodes), a.id, b.id})
+		heap.Push(h, nodes[len(nodes)-1])
+	}
+	lengths := make([]int, len(weights))
+	var walk func(id int, depth int)
+	walk = func(id int, depth int) {
+		if nodes[id].left == -1 {
+			lengths[symbols[id]] = depth
+			return
+		}
+		walk(nodes[id].left, depth+1)
+		walk(nodes[id].right, depth+1)
+	}
+	walk(len(nodes)-1, 0)
+	return lengths
+}
+
+// fxEncode compresses the values of a part: runs of symbols are paired into new symbols, the symbols get a canonical
+// huffman code with the longer codes on the lower symbols and the codes are packed into blocks of whole symbols
+func fxEncode(t *testing.T, values []int, flags int) fxPart {
+	same := true
+	for _, v := range values {
+		same = same && v == values[0]
+	}
+	if same {
+		return fxPart{sizes: []byte{byte(flags | tbFlagSingleValue), byte(values[0])}}
+	}
+	symbols := []fxSymbol{}
+	leaves := map[int]int{}
+	seq := make([]int, len(values))
+	for i, v := range values {
+		s, ok := leaves[v]
+		if !ok {
+			s = len(symbols)
+			leaves[v] = s
+			symbols = append(symbols, fxSymbol{v, 0xFFF, 1})
+		}
+		seq[i] = s
+	}
+	for len(symbols) < 0xFFF {
+		counts := map[[2]int]int{}
+		for i := 0; i+1 < len(seq); i++ {
+			a, b := seq[i], seq[i+1]
+			if symbols[a].values+symbols[b].values <= 256 {
+				counts[[2]int{a, b}]++
+				if a == b {
+					i++
+				}
+			}
+		}
+		best, bestCount := [2]int{}, 0
+		for pair, count := range counts {
+			if count > bestCount || (count == bestCount && (pair[0] < best[0] || (pair[0] == best[0] && pair[1] < best[1]))) {
+				best, bestCount = pair, count
+			}
+		}
+		if bestCount < 8 {
+			break
+		}
+		s := len(symbols)
+		symbols = append(symbols, fxSymbol{best[0], best[1], symbols[best[0]].values + symbols[best[1]].values})
+		j := 0
+		for i := 0; i < len(seq); i++ {
+			if i+1 < len(seq) && seq[i] == best[0] && seq[i+1] == best[1] {
+				seq[j] = s
+				i++
+			} else {
+				seq[j] = seq[i]
+			}
+			j++
+		}
+		seq = seq[:j]
+	}
+
+	weights := make([]int, len(symbols))
+	for _, s := range seq {
+		weights[s]++
+	}
+	if weights[seq[0]] == len(seq) { // a second code to have a tree
+		weights[(seq[0]+1)%len(symbols)] = 1
+	}
+	lengths := codeLengths(weights)
+	order := make([]int, len(symbols))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := lengths[order[i]], lengths[order[j]]
+		return a > b && b != 0 || a != 0 && b == 0
+	})
+	newID := make([]int, len(symbols))
+	minLen, maxLen := 64, 0
+	for i, s := range order {
+		newID[s] = i
+		if lengths[s] > 0 {
+			minLen, maxLen = util.Min(minLen, lengths[s]), util.Max(maxLen, lengths[s])
+		}
+	}
+	if maxLen > 32 {
+		t.Fatalf("code length %v", maxLen)
+	}
+	counts := make([]int, maxLen+1)
+	for _, l := range lengths {
+		counts[l]++
+	}
+	lowest := make([]int, maxLen-minLen+1)
+	base := make([]uint64, maxLen-minLen+1)
+	for i := len(base) - 2; i >= 0; i-- {
+		lowest[i] = lowest[i+1] + counts[minLen+i+1]
+		if (base[i+1]+uint64(counts[minLen+i+1]))%2 != 0 {
+			t.Fatal("incomplete huffman code")
+		}
+		base[i] = (base[i+1] + uint64(counts[minLen+i+1])) / 2
+	}
+	code := func(s int) uint64 {
+		i := lengths[s] - minLen
+		return base[i] + uint64(newID[s]-lowest[i])
+	}
+
+	// the blocks hold whole symbols, the sparse index points at the middle of every span of values
+	blockBits := 8 << fxBlockLog
+	part := fxPart{}
+	starts := []int{}
+	block := make([]byte, 1<<fxBlockLog)
+	bits, start, count := 0, 0, 0
+	flush := func() {
+		part.blocks = append(part.blocks, block...)
+		part.lengths = binary.LittleEndian.AppendUint16(part.lengths, uint16(count-1))
+		starts = append(starts, start)
+		block = make([]byte, 1<<fxBlockLog)
+		start += count
+		bits, count = 0, 0
+	}
+	for _, s := range seq {
+		l := lengths[s]
+		if bits+l > blockBits || count+symbols[s].values > 0x10000 {
+			flush()
+		}
+		c := code(s)
+		for b := l - 1; b >= 0; b-- {
+			if c>>b&1 == 1 {
+				block[bits>>3] |= 0x80 >> (bits & 7)
+			}
+			bits++
+		}
+		count += symbols[s].values
+	}
+	flush()
+	part.blocksNum = len(starts)
+	span := 1 << fxSpanLog
+	for k := 0; k < (len(values)+span-1)/span; k++ {
+		target := k*span + span/2
+		b := sort.Search(len(starts), func(i int) bool { return starts[i] > target }) - 1
+		if target-starts[b] > 0xFFFF {
+			t.Fatalf("sparse index offset %v", target-starts[b])
+		}
+		part.sparse = binary.LittleEndian.AppendUint32(part.sparse, uint32(b))
+		part.sparse = binary.LittleEndian.AppendUint16(part.sparse, uint16(target-starts[b]))
+	}
+
+	sizes := []byte{byte(flags), byte(fxBlockLog), byte(fxSpanLog), 0}
+	sizes = binary.LittleEndian.AppendUint32(sizes, uint32(part.blocksNum))
+	sizes = append(sizes, byte(maxLen), byte(minLen))
+	for _, l := range lowest {
+		sizes = binary.LittleEndian.AppendUint16(sizes, uint16(l))
+	}
+	sizes = binary.LittleEndian.AppendUint16(sizes, uint16(len(symbols)))
+	for _, s := range order {
+		left, right := symbols[s].left, symbols[s].right
+		if right != 0xFFF {
+			left, right = newID[left], newID[right]
+		}
+		sizes = append(sizes, byte(left), byte(left>>8&0xF|right<<4), byte(right>>4))
+	}
+	if len(symbols)%2 == 1 {
+		sizes = append(sizes, 0)
+	}
+	part.sizes = sizes
+	return part
+}
+
+// pieces are the pieces of a position in table form by ascending square
+func (t *fxTable) pieces(wk int, bk int, sq int) []tbPiece {
+	pieces := []tbPiece{{wk, tbWhiteKing}, {bk, tbWhiteKing + tbBlackPiece}, {sq, t.piece}}
+	sort.Slice(pieces, func(i, j int) bool { return pieces[i].sq < pieces[j].sq })
+	return pieces
+}
+
+// value is the value the table of typ stores for position i, ok is false when it may hold any value
+func (t *fxTable) value(typ tbType, i int) (int, bool) {
+	if t.wdl[i] == fxIllegal {
+		return 0, false
+	}
+	if typ == tbWDL {
+		return int(t.wdl[i]) + 2, true
+	}
+	if t.dtz[i] == 0 {
+		return 0, false
+	}
+	return t.dtz[i] - 1, true
+}
+
+// file is the table of typ in the format of setup: the header with the pieces, the sizes of every part, then the
+// sparse indexes, the block lengths and the blocks of the parts
+func (t *fxTable) file(test *testing.T, typ tbType) []byte {
+	tb, _ := newTBTable(typ, "", t.name)
+	sides, maxFile, flags := 1, 0, 1
+	if typ == tbWDL {
+		sides = 2
+	}
+	if tb.hasPawns {
+		maxFile = 3
+		flags |= 2
+	}
+	order := []int{t.piece, tbWhiteKing, tbWhiteKing + tbBlackPiece}
+	buf := append(append([]byte{}, tbMagics[typ]...), byte(flags))
+	for f := 0; f <= maxFile; f++ {
+		buf = append(buf, 0)
+		for _, p := range order {
+			buf = append(buf, byte(p|p<<4))
+		}
+		for i := 0; i < 2; i++ {
+			copy(tb.items[i][f].pieces[:], order)
+			tb.setGroups(&tb.items[i][f], [2]int{0, 0xF}, f)
+		}
+	}
+	if len(buf)%2 == 1 {
+		buf = append(buf, 0)
+	}
+
+	parts := [2][4]fxPart{}
+	for f := 0; f <= maxFile; f++ {
+		for side := 0; side < sides; side++ {
+			d := &tb.items[side][f]
+			n := 0
+			for d.groupLen[n] != 0 {
+				n++
+			}
+			values := make([]int, d.groupIdx[n])
+			for i := range values {
+				values[i] = -1
+			}
+			for i := range t.wdl {
+				wk, bk, sq, stm := fxSquares(i)
+				v, ok := t.value(typ, i)
+				if !ok || stm != side {
+					continue
+				}
+				pd, file, idx := tb.index(t.pieces(wk, bk, sq), stm, false)
+				if pd != d || file != f {
+					continue
+				}
+				if values[idx] != -1 && values[idx] != v {
+					test.Fatalf("%v: positions with index %v have values %v and %v", t.name, idx, values[idx], v)
+				}
+				values[idx] = v
+			}
+			// the values nobody reads repeat the one before, they compress best that way
+			last := 0
+			for _, v := range values {
+				if v != -1 {
+					last = v
+					break
+				}
+			}
+			for i, v := range values {
+				if v == -1 {
+					values[i] = last
+				}
+				last = values[i]
+			}
+			partFlags := 0
+			if typ == tbDTZ {
+				partFlags = tbFlagWinPlies | tbFlagLossPlies // white to move
+			}
+			parts[side][f] = fxEncode(test, values, partFlags)
+			buf = append(buf, parts[side][f].sizes...)
+		}
+	}
+	if typ == tbDTZ && len(buf)%2 == 1 {
+		buf = append(buf, 0)
+	}
+	for f := 0; f <= maxFile; f++ {
+		for side := 0; side < sides; side++ {
+			buf = append(buf, parts[side][f].sparse...)
+		}
+	}
+	for f := 0; f <= maxFile; f++ {
+		for side := 0; side < sides; side++ {
+			buf = append(buf, parts[side][f].lengths...)
+		}
+	}
+	for f := 0; f <= maxFile; f++ {
+		for side := 0; side < sides; side++ {
+			if parts[side][f].blocksNum > 0 {
+				buf = append(buf, make([]byte, (64-len(buf)%64)%64)...)
+			}
+			buf = append(buf, parts[side][f].blocks...)
+		}
+	}
+	// the decoder reads up to 8 bytes past the last block
+	return append(buf, make([]byte, 8)...)
+}
+
+// TestWriteSyzygyFixture solves the endgames, writes their tables and reads every position back from them
+func TestWriteSyzygyFixture(t *testing.T) {
+	if !*updateSyzygy {
+		t.Skip("writes the tables of testdata/syzygy with -update-syzygy")
+	}
+	tbIndexOnce.Do(initTBIndexes)
+	queen := solveFixture(t, "KQvK", tbPieceCodes[game.Queen], nil)
+	rook := solveFixture(t, "KRvK", tbPieceCodes[game.Rook], nil)
+	pawn := solveFixture(t, "KPvK", tbWhitePawn, map[int]*fxTable{tbPieceCodes[game.Queen]: queen, tbPieceCodes[game.Rook]: rook})
+	// the longest mates are known, in 10 moves with the queen and 16 with the rook
+	for _, test := range []struct {
+		table *fxTable
+		plies int
+	}{{queen, 19}, {rook, 31}} {
+		longest := 0
+		for i, d := range test.table.dtz {
+			if _, _, _, stm := fxSquares(i); stm == 0 {
+				longest = util.Max(longest, d)
+			}
+		}
+		if longest != test.plies {
+			t.Fatalf("%v: longest win %v plies, want %v", test.table.name, longest, test.plies)
+		}
+	}
+
+	dir := filepath.Join("testdata", "syzygy")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	tables := []*fxTable{queen, rook, pawn}
+	for _, table := range tables {
+		for typ, suffix := range tbSuffixes {
+			if err := os.WriteFile(filepath.Join(dir, table.name+suffix), table.file(t, typ), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	tb, err := loadTablebases(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, table := range tables {
+		for typ := range tbSuffixes {
+			tbt := tb.tables[typ][table.name]
+			if err := tbt.load(); err != nil {
+				t.Fatal(err)
+			}
+			for i := range table.wdl {
+				wk, bk, sq, stm := fxSquares(i)
+				want, ok := table.value(typ, i)
+				if !ok || (typ == tbDTZ && stm != 0) {
+					continue
+				}
+				v, _ := tbt.probe(table.pieces(wk, bk, sq), stm, false, int(table.wdl[i]))
+				if typ == tbWDL {
+					v += 2
+				} else {
+					v--
+				}
+				if v != want {
+					t.Fatalf("%v%v: read %v for %v, want %v", table.name, tbSuffixes[typ], v, table.pieces(wk, bk, sq), want)
+				}
+			}
+		}
+	}
+}
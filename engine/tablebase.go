@@ -0,0 +1,351 @@
+package engine
+
+import (
+	"chess/game"
+)
+
+// win, draw and loss as stored in the tables, cursed wins and blessed losses are draws by the 50 move rule.
+// The state doesn't keep the halfmove clock, the probes take it as zero: a win within 100 plies of the next capture or
+// pawn move is a win even when the moves made since the last one leave fewer plies than that before the rule draws
+const (
+	tbLoss        int = -2
+	tbBlessedLoss int = -1
+	tbDraw        int = 0
+	tbCursedWin   int = 1
+	tbWin         int = 2
+)
+
+// tbWinScore is below the mate scores and above any evaluation
+const tbWinScore int = mateScore - 2*maxPly
+
+var tbPieceCodes map[game.PieceType]int = map[game.PieceType]int{
+	game.Pawn: 1, game.Knight: 2, game.Bishop: 3, game.Rook: 4, game.Queen: 5, game.King: 6,
+}
+
+// tbPosition is the state with the pieces in table form, ok is false if it has more pieces than the tables
+func tbPosition(state *game.State) ([]tbPiece, string, bool) {
+	pieces := make([]tbPiece, 0, tbMaxPieces)
+	counts := &[2][6]int{}
+	for sq := 0; sq < 64; sq++ {
+		pos := posFromWhiteSquare(state.Starter, sq)
+		piece := state.Board[pos.X][pos.Y]
+		if piece == nil {
+			continue
+		}
+		if len(pieces) == tbMaxPieces {
+			return nil, "", false
+		}
+		code := tbPieceCodes[piece.Type]
+		if piece.Owner == game.Black {
+			code += tbBlackPiece
+		}
+		pieces = append(pieces, tbPiece{sq, code})
+		counts[piece.Owner][6-code&7]++ // K Q R B N P
+	}
+	return pieces, materialKey(counts, 0), true
+}
+
+func posFromWhiteSquare(starter game.Player, sq int) game.Pos {
+	if starter == game.Black {
+		return game.Pos{X: sq >> 3, Y: 7 - sq&7}
+	}
+	return game.Pos{X: 7 - sq>>3, Y: sq & 7}
+}
+
+// probeTable looks up the state with player to move in the wdl or dtz table of its material, ok is false if there is no such table
+// and changeSTM is true if the dtz table only has the other side to move
+func (tb *tablebases) probeTable(typ tbType, state *game.State, player game.Player, wdl int) (value int, ok bool, changeSTM bool) {
+	pieces, key, ok := tbPosition(state)
+	if !ok {
+		return 0, false, false
+	}
+	if len(pieces) == 2 { // only the kings
+		return tbDraw, true, false
+	}
+	t, found := tb.tables[typ][key]
+	if !found || t.load() != nil {
+		return 0, false, false
+	}
+	// the tables have the stronger side as white, if both sides have the same pieces they only store white to move
+	flip := key != t.key || (t.key == t.key2 && player == game.Black)
+	stm := int(player)
+	if flip {
+		stm = 1 - stm
+	}
+	value, stored := t.probe(pieces, stm, flip, wdl)
+	return value, true, !stored
+}
+
+type tbUndo struct {
+	move          game.Move
+	captureType   game.PieceType
+	convertType   game.PieceType
+	passant       *game.Pos
+	canCastleLong map[game.Player]bool
+	canCastle     map[game.Player]bool
+}
+
+func tbDoMove(state *game.State, player game.Player, m game.Move) tbUndo {
+	u := tbUndo{move: m, captureType: game.NilPiece, convertType: game.NilPiece, passant: state.PassantPos,
+		canCastleLong: state.CanCastleLong, canCastle: state.CanCastleShort}
+	if m.Capture != nil {
+		u.captureType = state.Board[m.Capture.X][m.Capture.Y].Type
+	}
+	if m.IsConversion {
+		u.convertType = m.ConvertType
+	}
+	state.CanCastleLong = map[game.Player]bool{game.White: state.CanCastleLong[game.White], game.Black: state.CanCastleLong[game.Black]}
+	state.CanCastleShort = map[game.Player]bool{game.White: state.CanCastleShort[game.White], game.Black: state.CanCastleShort[game.Black]}
+	state.RunMove(m)
+	state.Turn = (player + 1) % 2
+	return u
+}
+
+func tbUndoMove(state *game.State, player game.Player, u tbUndo) {
+	state.Turn = player
+	state.ReverseMove(u.move, u.captureType, u.convertType)
+	state.PassantPos = u.passant
+	state.CanCastleLong = u.canCastleLong
+	state.CanCastleShort = u.canCastle
+}
+
+// tbLegalMoves are the legal moves of player, with all promotions
+func tbLegalMoves(state *game.State, player game.Player) []game.Move {
+	moves := []game.Move{}
+	for _, m := range state.GetMoves(player) {
+		convertTypes := []game.PieceType{m.ConvertType}
+		if m.IsConversion {
+			convertTypes = []game.PieceType{game.Queen, game.Rook, game.Bishop, game.Knight}
+		}
+		for _, t := range convertTypes {
+			m.ConvertType = t
+			u := tbDoMove(state, player, m)
+			if !state.InCheck(player) {
+				moves = append(moves, m)
+			}
+			tbUndoMove(state, player, u)
+		}
+	}
+	return moves
+}
+
+func isZeroing(state *game.State, m game.Move) bool {
+	return m.Capture != nil || state.Board[m.Start.X][m.Start.Y].Type == game.Pawn
+}
+
+// search resolves the positions the generator didn't store: the tables may hold any value for a position with a
+// winning capture (or pawn move, for dtz) and a position with a drawing capture is at least a draw.
+// zeroing is true when the best move is a capture or pawn move, dtz is not stored for these
+func (tb *tablebases) search(state *game.State, player game.Player, checkPawnMoves bool) (wdl int, zeroing bool, ok bool) {
+	moves := tbLegalMoves(state, player)
+	best := tbLoss
+	count := 0
+	for _, m := range moves {
+		if m.Capture == nil && (!checkPawnMoves || state.Board[m.Start.X][m.Start.Y].Type != game.Pawn) {
+			continue
+		}
+		count++
+		u := tbDoMove(state, player, m)
+		v, _, ok := tb.search(state, (player+1)%2, false)
+		tbUndoMove(state, player, u)
+		if !ok {
+			return tbDraw, false, false
+		}
+		if -v > best {
+			best = -v
+			if best >= tbWin {
+				return best, true, true
+			}
+		}
+	}
+	// when every move was searched the table isn't needed, it could even be wrong as it ignores en passant
+	noMoreMoves := count > 0 && count == len(moves)
+	value := best
+	if !noMoreMoves {
+		v, found, _ := tb.probeTable(tbWDL, state, player, tbDraw)
+		if !found {
+			return tbDraw, false, false
+		}
+		value = v
+	}
+	if best >= value {
+		return best, best > tbDraw || noMoreMoves, true
+	}
+	return value, false, true
+}
+
+func (tb *tablebases) probeWDL(state *game.State, player game.Player) (int, bool) {
+	wdl, _, ok := tb.search(state, player, false)
+	return wdl, ok
+}
+
+func dtzBeforeZeroing(wdl int) int {
+	switch wdl {
+	case tbWin:
+		return 1
+	case tbCursedWin:
+		return 101
+	case tbBlessedLoss:
+		return -101
+	case tbLoss:
+		return -1
+	}
+	return 0
+}
+
+func sign(x int) int {
+	if x > 0 {
+		return 1
+	} else if x < 0 {
+		return -1
+	}
+	return 0
+}
+
+// probeDTZ is the number of plies to the next capture or pawn move on the way to the result, positive when winning.
+// Cursed wins and blessed losses are 100 plies further
+func (tb *tablebases) probeDTZ(state *game.State, player game.Player) (int, bool) {
+	wdl, zeroing, ok := tb.search(state, player, true)
+	if !ok || wdl == tbDraw {
+		return 0, ok
+	}
+	if zeroing {
+		return dtzBeforeZeroing(wdl), true
+	}
+	dtz, found, changeSTM := tb.probeTable(tbDTZ, state, player, wdl)
+	if !found {
+		return 0, false
+	}
+	if !changeSTM {
+		if wdl == tbBlessedLoss || wdl == tbCursedWin {
+			dtz += 100
+		}
+		return dtz * sign(wdl), true
+	}
+
+	// the table only has the other side to move, take the best dtz after every move
+	minDTZ := 0xFFFF
+	for _, m := range tbLegalMoves(state, player) {
+		zeroing := isZeroing(state, m)
+		u := tbDoMove(state, player, m)
+		opp := (player + 1) % 2
+		if zeroing {
+			v, _, ok2 := tb.search(state, opp, false)
+			dtz, ok = -dtzBeforeZeroing(v), ok2
+		} else {
+			dtz, ok = tb.probeDTZ(state, opp)
+			dtz = -dtz
+		}
+		if dtz == 1 && state.InCheck(opp) && len(tbLegalMoves(state, opp)) == 0 {
+			minDTZ = 1
+		}
+		if !zeroing {
+			dtz += sign(dtz)
+		}
+		if dtz < minDTZ && sign(dtz) == sign(wdl) {
+			minDTZ = dtz
+		}
+		tbUndoMove(state, player, u)
+		if !ok {
+			return 0, false
+		}
+	}
+	if minDTZ == 0xFFFF {
+		return -1, true
+	}
+	return minDTZ, true
+}
+
+// wdlScore is the search score of a table result at ply
+func wdlScore(wdl int, ply int) int {
+	if !options.Syzygy50MoveRule {
+		wdl = sign(wdl) * tbWin
+	}
+	switch wdl {
+	case tbWin:
+		return tbWinScore - ply
+	case tbLoss:
+		return -tbWinScore + ply
+	}
+	return wdl // cursed wins and blessed losses are a bit better or worse than a draw
+}
+
+// probeSearch is the wdl probe done inside the search, with the bound it gives
+func probeSearch(state *game.State, player game.Player, ply int) (int, ttFlag, bool) {
+	if syzygy == nil || !tbFewPieces(state) {
+		return 0, ttExact, false
+	}
+	wdl, ok := syzygy.probeWDL(state, player)
+	if !ok {
+		return 0, ttExact, false
+	}
+	score := wdlScore(wdl, ply)
+	if score >= tbWinScore-maxPly {
+		return score, ttLower, true
+	} else if score <= -tbWinScore+maxPly {
+		return score, ttUpper, true
+	}
+	return score, ttExact, true
+}
+
+func tbFewPieces(state *game.State) bool {
+	count := 0
+	for i := 0; i <= 7; i++ {
+		for j := 0; j <= 7; j++ {
+			if state.Board[i][j] != nil {
+				count++
+			}
+		}
+	}
+	return count <= syzygy.maxPieces
+}
+
+// probeRoot picks the move that keeps the best result with the fewest plies to the next zeroing move when winning,
+// and the most when losing
+func probeRoot(state *game.State, player game.Player) (*game.Move, int, bool) {
+	if syzygy == nil || !tbFewPieces(state) {
+		return nil, 0, false
+	}
+	state = state.Copy()
+	state.Turn = player
+	opp := (player + 1) % 2
+	var best *game.Move
+	bestRank, bestDTZ := 0, 0
+	for _, m := range tbLegalMoves(state, player) {
+		var dtz int
+		ok := true
+		zeroing := isZeroing(state, m)
+		u := tbDoMove(state, player, m)
+		if zeroing {
+			var wdl int
+			wdl, ok = syzygy.probeWDL(state, opp)
+			dtz = dtzBeforeZeroing(-wdl)
+		} else {
+			dtz, ok = syzygy.probeDTZ(state, opp)
+			dtz = -dtz
+			dtz += sign(dtz)
+		}
+		if dtz == 2 && state.InCheck(opp) && len(tbLegalMoves(state, opp)) == 0 {
+			dtz = 1
+		}
+		tbUndoMove(state, player, u)
+		if !ok {
+			return nil, 0, false
+		}
+		// wins by the fewest plies, then draws, then losses by the most plies
+		rank := 0
+		if dtz > 0 {
+			rank = 1000 - dtz
+		} else if dtz < 0 {
+			rank = -1000 - dtz
+		}
+		if best == nil || rank > bestRank {
+			move := m
+			best, bestRank, bestDTZ = &move, rank, dtz
+		}
+	}
+	if best == nil {
+		return nil, 0, false
+	}
+	return best, bestDTZ, true
+}
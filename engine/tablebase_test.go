@@ -0,0 +1,133 @@
+package engine
+
+import (
+	"chess/game"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testTablebases loads the tables of testdata/syzygy, the ones with a king and a queen, rook or pawn against the king,
+// after the ones of SYZYGY_PATH when it is set
+func testTablebases(t *testing.T) (*tablebases, string) {
+	path := filepath.Join("testdata", "syzygy")
+	if env := os.Getenv("SYZYGY_PATH"); env != "" {
+		path = env + string(filepath.ListSeparator) + path
+	}
+	tb, err := loadTablebases(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"KQvK", "KRvK", "KPvK"} {
+		if tb.tables[tbWDL][key] == nil || tb.tables[tbDTZ][key] == nil {
+			t.Fatalf("no %v tables in %v", key, path)
+		}
+	}
+	return tb, path
+}
+
+func TestSyzygyProbe(t *testing.T) {
+	tb, path := testTablebases(t)
+	// wdl is for the side to move
+	tests := []struct {
+		fen string
+		wdl int
+	}{
+		{"4k3/8/8/8/8/8/8/4K2Q w - - 0 1", tbWin},
+		{"4k3/8/8/8/8/8/8/4K2Q b - - 0 1", tbLoss},
+		{"4k3/8/8/8/8/8/8/R3K3 w - - 0 1", tbWin},
+		{"4k3/8/8/8/8/8/8/R3K3 b - - 0 1", tbLoss},
+		{"8/8/8/8/8/8/kR6/4K3 b - - 0 1", tbDraw}, // the rook is lost
+		{"4k3/8/4K3/4P3/8/8/8/8 w - - 0 1", tbWin},
+		{"4k3/8/4K3/4P3/8/8/8/8 b - - 0 1", tbLoss},
+		{"8/4k3/8/4K3/4P3/8/8/8 w - - 0 1", tbDraw}, // the opposition
+		{"8/4k3/8/4K3/4P3/8/8/8 b - - 0 1", tbLoss},
+		{"k7/8/K7/P7/8/8/8/8 w - - 0 1", tbDraw}, // rook pawn with the king in the corner
+		{"k7/8/K7/P7/8/8/8/8 b - - 0 1", tbDraw},
+		{"4k3/8/8/3n4/8/8/8/3QK3 w - - 0 1", tbWin},
+		{"4k3/8/8/8/8/8/8/2B1KN2 w - - 0 1", tbWin},
+		{"4k3/8/8/8/8/8/8/1N2K1N1 w - - 0 1", tbDraw},
+		{"3rk3/8/8/8/8/8/8/3RK3 b - - 0 1", tbDraw},
+	}
+	for _, test := range tests {
+		state, err := game.NewStateFromFEN(test.fen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, key, _ := tbPosition(state)
+		if tb.tables[tbWDL][key] == nil {
+			t.Logf("%v: no %v table in %v", test.fen, key, path)
+			continue
+		}
+		// the tables are probed from the side of white whoever is at the bottom of the board
+		for _, s := range []*game.State{state, state.Rotated(game.Black)} {
+			wdl, ok := tb.probeWDL(s, s.Turn)
+			if !ok || wdl != test.wdl {
+				t.Errorf("%v (starter %v): wdl %v %v, want %v", test.fen, game.PlayerToString[s.Starter], wdl, ok, test.wdl)
+			}
+			if tb.tables[tbDTZ][key] == nil {
+				continue
+			}
+			if dtz, ok := tb.probeDTZ(s, s.Turn); !ok || sign(dtz) != sign(test.wdl) {
+				t.Errorf("%v (starter %v): dtz %v %v, want the sign of %v", test.fen, game.PlayerToString[s.Starter], dtz, ok, test.wdl)
+			}
+		}
+	}
+}
+
+func TestSyzygyDTZ(t *testing.T) {
+	tb, _ := testTablebases(t)
+	tests := []struct {
+		fen string
+		dtz int
+	}{
+		{"7k/8/6K1/8/8/8/8/Q7 w - - 0 1", 1},   // mate in one
+		{"Q6k/8/6K1/8/8/8/8/8 b - - 0 1", -1},  // mated
+		{"7k/8/6K1/8/8/8/8/1Q6 b - - 0 1", -2}, // mated next move
+		{"8/8/8/8/8/8/kR6/4K3 b - - 0 1", 0},   // the rook is lost
+		{"4k3/8/4K3/8/4P3/8/8/8 w - - 0 1", 1}, // the pawn moves to win
+	}
+	for _, test := range tests {
+		state, err := game.NewStateFromFEN(test.fen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range []*game.State{state, state.Rotated(game.Black)} {
+			if dtz, ok := tb.probeDTZ(s, s.Turn); !ok || dtz != test.dtz {
+				t.Errorf("%v (starter %v): dtz %v %v, want %v", test.fen, game.PlayerToString[s.Starter], dtz, ok, test.dtz)
+			}
+		}
+	}
+}
+
+// TestSyzygyRoot plays the tables from a won position until it mates, every move keeping the win with one ply less
+// to the mate as there are no captures or pawn moves in the way
+func TestSyzygyRoot(t *testing.T) {
+	tb, _ := testTablebases(t)
+	saved := syzygy
+	syzygy = tb
+	defer func() { syzygy = saved }()
+	state, err := game.NewStateFromFEN("8/8/8/4k3/8/8/8/R3K3 w - - 0 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	player := state.Turn
+	want, ok := tb.probeDTZ(state, player)
+	if !ok || want <= 0 {
+		t.Fatalf("dtz %v %v, want a win", want, ok)
+	}
+	for ; want > 0; want-- {
+		m, dtz, ok := probeRoot(state, player)
+		if !ok || m == nil {
+			t.Fatalf("%v: no move", state.FEN())
+		}
+		if player == game.White && dtz != want {
+			t.Fatalf("%v: %v with dtz %v, want %v", state.FEN(), state.UCIMove(*m), dtz, want)
+		}
+		tbDoMove(state, player, *m)
+		player = (player + 1) % 2
+	}
+	if !state.InCheck(player) || len(tbLegalMoves(state, player)) != 0 {
+		t.Errorf("%v: no mate at the end of the win", state.FEN())
+	}
+}
@@ -0,0 +1,164 @@
+package engine
+
+import (
+	"bytes"
+	"chess/game"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Parameter files in toml have the weights of Params as keys: the numbers and the weights by rank at the top, then a
+// table for every weight by piece, with the piece names as keys and the piece square tables as arrays of rows.
+// Only the part of toml these need is read: bare keys, integers, arrays and [tables], with # comments
+//
+//	BishopPair = 30
+//	PassedPawn = [0, 5, 10, 15, 30, 50, 80, 0]
+//
+//	[PieceValues]
+//	Pawn = 100
+
+// parseTOML reads a toml parameter file into the values of its keys, a table is a map of its keys
+func parseTOML(data []byte) (map[string]any, error) {
+	root := map[string]any{}
+	table := root
+	lines := strings.Split(string(data), "\n")
+	for i := 0; i < len(lines); i++ {
+		start := i + 1
+		line := stripComment(lines[i])
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && !strings.Contains(line, "=") {
+			name := strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(line, "["), "]"))
+			if !strings.HasSuffix(line, "]") || !isBareKey(name) {
+				return nil, fmt.Errorf("line %v: bad table %q", start, line)
+			}
+			if _, exists := root[name]; exists {
+				return nil, fmt.Errorf("line %v: table %v defined twice", start, name)
+			}
+			table = map[string]any{}
+			root[name] = table
+			continue
+		}
+		key, value, found := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !found || !isBareKey(key) {
+			return nil, fmt.Errorf("line %v: expected key = value", start)
+		}
+		value = strings.TrimSpace(value)
+		// an array goes on over the next lines until its brackets close
+		for strings.Count(value, "[") > strings.Count(value, "]") && i+1 < len(lines) {
+			i++
+			value += " " + stripComment(lines[i])
+		}
+		v, rest, err := parseTOMLValue(value)
+		if err != nil {
+			return nil, fmt.Errorf("line %v: %v", start, err)
+		}
+		if strings.TrimSpace(rest) != "" {
+			return nil, fmt.Errorf("line %v: unexpected %q after the value of %v", start, rest, key)
+		}
+		if _, exists := table[key]; exists {
+			return nil, fmt.Errorf("line %v: key %v defined twice", start, key)
+		}
+		table[key] = v
+	}
+	return root, nil
+}
+
+func stripComment(line string) string {
+	if i := strings.Index(line, "#"); i >= 0 {
+		line = line[:i]
+	}
+	return strings.TrimSpace(line)
+}
+
+func isBareKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for _, c := range key {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// parseTOMLValue reads an integer or an array of values from the start of s, and returns what follows it
+func parseTOMLValue(s string) (any, string, error) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "[") {
+		end := strings.IndexAny(s, ",]")
+		if end < 0 {
+			end = len(s)
+		}
+		n, err := strconv.ParseInt(strings.ReplaceAll(strings.TrimSpace(s[:end]), "_", ""), 10, 64)
+		if err != nil {
+			return nil, "", fmt.Errorf("bad integer %q", strings.TrimSpace(s[:end]))
+		}
+		return n, s[end:], nil
+	}
+	array := []any{}
+	s = strings.TrimSpace(s[1:])
+	for !strings.HasPrefix(s, "]") {
+		v, rest, err := parseTOMLValue(s)
+		if err != nil {
+			return nil, "", err
+		}
+		array = append(array, v)
+		s = strings.TrimSpace(rest)
+		if strings.HasPrefix(s, ",") {
+			s = strings.TrimSpace(s[1:])
+		} else if !strings.HasPrefix(s, "]") {
+			return nil, "", fmt.Errorf("unclosed array")
+		}
+	}
+	return array, s[1:], nil
+}
+
+// toml writes p as a toml parameter file, in the order of the fields of Params
+func (p *Params) toml() []byte {
+	var top, tables bytes.Buffer
+	v := reflect.ValueOf(p).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		name := v.Type().Field(i).Name
+		switch value := v.Field(i).Interface().(type) {
+		case int:
+			fmt.Fprintf(&top, "%v = %v\n", name, value)
+		case []int:
+			fmt.Fprintf(&top, "%v = %v\n", name, tomlArray(value))
+		case PieceMap[int]:
+			fmt.Fprintf(&tables, "\n[%v]\n", name)
+			for _, t := range game.PieceTypes {
+				if w, ok := value[t]; ok {
+					fmt.Fprintf(&tables, "%v = %v\n", game.PieceTypeToString[t], w)
+				}
+			}
+		case PieceMap[[][]int]:
+			fmt.Fprintf(&tables, "\n[%v]\n", name)
+			for _, t := range game.PieceTypes {
+				table, ok := value[t]
+				if !ok {
+					continue
+				}
+				fmt.Fprintf(&tables, "%v = [\n", game.PieceTypeToString[t])
+				for _, row := range table {
+					fmt.Fprintf(&tables, "  %v,\n", tomlArray(row))
+				}
+				fmt.Fprintln(&tables, "]")
+			}
+		}
+	}
+	return append(top.Bytes(), tables.Bytes()...)
+}
+
+func tomlArray(values []int) string {
+	s := make([]string, len(values))
+	for i, v := range values {
+		s[i] = strconv.Itoa(v)
+	}
+	return "[" + strings.Join(s, ", ") + "]"
+}
@@ -0,0 +1,120 @@
+package engine
+
+import (
+	"chess/game"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+)
+
+type evalTerm int
+
+const (
+	termMaterial evalTerm = iota
+	termPieceSquares
+	termPawns
+	termMobility
+	termKingSafety
+	termPieces
+	termThreats
+	numEvalTerms
+)
+
+var (
+	evalTermToString map[evalTerm]string = map[evalTerm]string{
+		termMaterial:     "Material",
+		termPieceSquares: "Piece squares",
+		termPawns:        "Pawns",
+		termMobility:     "Mobility",
+		termKingSafety:   "King safety",
+		termPieces:       "Pieces",
+		termThreats:      "Threats",
+	}
+	activityTerms map[evalTerm]func(*game.State, game.Player, *attackInfo) (int, int) = map[evalTerm]func(*game.State, game.Player, *attackInfo) (int, int){
+		termMobility:   evalMobility,
+		termKingSafety: evalKingSafety,
+		termPieces:     evalPieces,
+		termThreats:    evalThreats,
+	}
+)
+
+type TermScore struct {
+	MiddleGame int
+	EndGame    int
+}
+
+type TraceTerm struct {
+	Name  string
+	White TermScore
+	Black TermScore
+}
+
+// Trace is the breakdown of the evaluation of a state, all totals are from the pov of white
+type Trace struct {
+	Terms      []TraceTerm
+	Phase      int
+	MiddleGame int
+	EndGame    int // after the scale
+	Scale      int
+	Endgame    string // the known endgame or the reason for the scale
+	Score      int
+}
+
+type evalAccumulator struct {
+	mg    int
+	eg    int
+	trace *Trace
+}
+
+func (acc *evalAccumulator) add(term evalTerm, player game.Player, mg int, eg int) {
+	if player == game.White {
+		acc.mg += mg
+		acc.eg += eg
+	} else {
+		acc.mg -= mg
+		acc.eg -= eg
+	}
+	if acc.trace != nil {
+		score := &acc.trace.Terms[term].White
+		if player == game.Black {
+			score = &acc.trace.Terms[term].Black
+		}
+		score.MiddleGame += mg
+		score.EndGame += eg
+	}
+}
+
+func EvalTrace(state *game.State) *Trace {
+	trace := &Trace{}
+	for term := evalTerm(0); term < numEvalTerms; term++ {
+		trace.Terms = append(trace.Terms, TraceTerm{Name: evalTermToString[term]})
+	}
+	trace.MiddleGame, trace.EndGame, trace.Phase = evaluate(state, trace, nil)
+	trace.Score = taper(trace.MiddleGame, trace.EndGame, trace.Phase)
+	if ev, name, ok := probeEndgame(state); ok {
+		trace.Score, trace.Endgame = ev, name
+	}
+	return trace
+}
+
+func (trace *Trace) String() string {
+	var sb strings.Builder
+	w := tabwriter.NewWriter(&sb, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "Term\tWhite MG\tWhite EG\tBlack MG\tBlack EG\tTotal MG\tTotal EG\t")
+	for _, t := range trace.Terms {
+		fmt.Fprintf(w, "%v\t%.2f\t%.2f\t%.2f\t%.2f\t%.2f\t%.2f\t\n", t.Name, ScoreToPawns(t.White.MiddleGame), ScoreToPawns(t.White.EndGame),
+			ScoreToPawns(t.Black.MiddleGame), ScoreToPawns(t.Black.EndGame),
+			ScoreToPawns(t.White.MiddleGame-t.Black.MiddleGame), ScoreToPawns(t.White.EndGame-t.Black.EndGame))
+	}
+	fmt.Fprintf(w, "Total\t\t\t\t\t%.2f\t%.2f\t\n", ScoreToPawns(trace.MiddleGame), ScoreToPawns(trace.EndGame))
+	w.Flush()
+	fmt.Fprintf(&sb, "Phase: %v/%v\n", trace.Phase, maxPhase)
+	if trace.Scale != scaleNormal {
+		fmt.Fprintf(&sb, "End game scale: %v/%v\n", trace.Scale, scaleNormal)
+	}
+	if trace.Endgame != "" {
+		fmt.Fprintf(&sb, "Endgame: %v\n", trace.Endgame)
+	}
+	fmt.Fprintf(&sb, "Score: %.2f (white pov)\n", ScoreToPawns(trace.Score))
+	return sb.String()
+}
@@ -0,0 +1,159 @@
+package engine
+
+import (
+	"chess/game"
+	"sync/atomic"
+)
+
+type ttFlag uint8
+
+const (
+	ttExact ttFlag = iota
+	ttLower
+	ttUpper
+)
+
+const noMove uint16 = 0xFFFF
+
+// entries are shared between search threads without locks, the key is stored xored with the data
+// so a torn write is detected as a miss on probe
+type ttEntry struct {
+	key  uint64
+	data uint64
+}
+
+type transpositionTable struct {
+	entries []ttEntry
+	mask    uint64
+}
+
+type ttData struct {
+	eval  int
+	depth int
+	flag  ttFlag
+	move  uint16
+}
+
+func newTranspositionTable(sizeMB int) *transpositionTable {
+	numEntries := uint64(1)
+	for numEntries*2*16 <= uint64(sizeMB)*1024*1024 {
+		numEntries *= 2
+	}
+	return &transpositionTable{entries: make([]ttEntry, numEntries), mask: numEntries - 1}
+}
+
+func (table *transpositionTable) clear() {
+	for i := range table.entries {
+		atomic.StoreUint64(&table.entries[i].key, 0)
+		atomic.StoreUint64(&table.entries[i].data, 0)
+	}
+}
+
+func (table *transpositionTable) probe(hash uint64) (ttData, bool) {
+	entry := &table.entries[hash&table.mask]
+	key := atomic.LoadUint64(&entry.key)
+	data := atomic.LoadUint64(&entry.data)
+	if key^data != hash || data == 0 {
+		return ttData{}, false
+	}
+	return unpackTTData(data), true
+}
+
+func (table *transpositionTable) store(hash uint64, d ttData) {
+	entry := &table.entries[hash&table.mask]
+	old := atomic.LoadUint64(&entry.data)
+	if atomic.LoadUint64(&entry.key)^old == hash && unpackTTData(old).depth > d.depth && d.flag != ttExact {
+		return
+	}
+	data := packTTData(d)
+	atomic.StoreUint64(&entry.key, hash^data)
+	atomic.StoreUint64(&entry.data, data)
+}
+
+func packTTData(d ttData) uint64 {
+	return uint64(uint32(int32(d.eval))) | uint64(uint8(d.depth))<<32 | uint64(d.flag)<<40 | uint64(d.move)<<42 | 1<<63
+}
+
+func unpackTTData(data uint64) ttData {
+	return ttData{
+		eval:  int(int32(uint32(data))),
+		depth: int(uint8(data >> 32)),
+		flag:  ttFlag((data >> 40) & 3),
+		move:  uint16(data >> 42),
+	}
+}
+
+// mate and tablebase scores are stored relative to the node instead of the root, so they stay correct when the
+// position is reached at a different ply
+func scoreToTT(score int, ply int) int {
+	if score > tbWinScore-maxPly {
+		return score + ply
+	} else if score < -tbWinScore+maxPly {
+		return score - ply
+	}
+	return score
+}
+
+func scoreFromTT(score int, ply int) int {
+	if score > tbWinScore-maxPly {
+		return score - ply
+	} else if score < -tbWinScore+maxPly {
+		return score + ply
+	}
+	return score
+}
+
+func encodeMove(m *game.Move) uint16 {
+	if m == nil {
+		return noMove
+	}
+	return uint16(m.Start.X*8+m.Start.Y) | uint16(m.End.X*8+m.End.Y)<<6 | uint16(m.ConvertType+1)<<12
+}
+
+// moves the move matching the encoded tt move to the front, keeping the order of the others
+func orderTTMove(moves []game.Move, move uint16) {
+	if move == noMove {
+		return
+	}
+	for i := range moves {
+		if encodeMove(&moves[i]) == move {
+			m := moves[i]
+			copy(moves[1:i+1], moves[:i])
+			moves[0] = m
+			return
+		}
+	}
+}
+
+type evalCache struct {
+	entries []ttEntry
+	mask    uint64
+}
+
+func newEvalCache(numEntries uint64) *evalCache {
+	return &evalCache{entries: make([]ttEntry, numEntries), mask: numEntries - 1}
+}
+
+func (cache *evalCache) clear() {
+	for i := range cache.entries {
+		atomic.StoreUint64(&cache.entries[i].key, 0)
+		atomic.StoreUint64(&cache.entries[i].data, 0)
+	}
+}
+
+func (cache *evalCache) probe(hash uint64) (int, bool) {
+	entry := &cache.entries[hash&cache.mask]
+	key := atomic.LoadUint64(&entry.key)
+	data := atomic.LoadUint64(&entry.data)
+	if key^data != hash || data == 0 {
+		return 0, false
+	}
+	return int(int32(uint32(data))), true
+}
+
+func (cache *evalCache) store(hash uint64, ev int) {
+	entry := &cache.entries[hash&cache.mask]
+	data := uint64(uint32(int32(ev))) | 1<<63
+	atomic.StoreUint64(&entry.key, hash^data)
+	atomic.StoreUint64(&entry.data, data)
+}
@@ -0,0 +1,295 @@
+package epd
+
+import (
+	"bufio"
+	"chess/engine"
+	"chess/game"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// position is a test of a suite: the engine solves it when it plays one of the best moves (bm) and none of the
+// avoid moves (am)
+type position struct {
+	fen   string
+	id    string
+	theme string
+	bm    []string // uci moves
+	am    []string
+	skip  string // why the engine can't solve the position, castling as the best move
+	want  string // the bm and am operations as written
+}
+
+// result is how the engine did on a position
+type result struct {
+	solved bool
+	move   string // san
+	depth  int
+	took   time.Duration // time to solution, from the depth it found the move on and kept it
+}
+
+// numberRegexp is the number at the end of the id of a suite position ("WAC.001", "STS(v1.0) Undermine.001")
+var numberRegexp *regexp.Regexp = regexp.MustCompile(`[.\s]*\d+$`)
+
+// theme is the part of id before the position number, without the suite version of STS ids
+func theme(id string) string {
+	t := numberRegexp.ReplaceAllString(id, "")
+	if i := strings.LastIndex(t, ") "); strings.HasPrefix(t, "STS") && i != -1 {
+		t = t[i+2:]
+	}
+	return strings.TrimSpace(t)
+}
+
+// operations splits the operations after the fen at semicolons outside of quotes
+func operations(s string) [][]string {
+	ops := [][]string{}
+	op := []string{}
+	var word strings.Builder
+	quoted := false
+	endWord := func() {
+		if word.Len() > 0 {
+			op = append(op, word.String())
+			word.Reset()
+		}
+	}
+	for _, c := range s {
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case quoted:
+			word.WriteRune(c)
+		case c == ';':
+			endWord()
+			if len(op) > 0 {
+				ops = append(ops, op)
+			}
+			op = []string{}
+		case c == ' ' || c == '\t':
+			endWord()
+		default:
+			word.WriteRune(c)
+		}
+	}
+	endWord()
+	if len(op) > 0 {
+		ops = append(ops, op)
+	}
+	return ops
+}
+
+// parsePosition reads an epd line: the first four fields of a fen followed by operations ("bm Qg6; id \"WAC.001\";")
+func parsePosition(line string) (*position, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 4 {
+		return nil, errors.New("expected a fen followed by operations")
+	}
+	state, err := game.NewStateFromFEN(strings.Join(fields[:4], " "))
+	if err != nil {
+		return nil, err
+	}
+	// the engine can't castle, the position is searched without castling rights
+	for _, p := range game.Players {
+		state.CanCastleLong[p] = false
+		state.CanCastleShort[p] = false
+	}
+	pos := &position{fen: state.FEN()}
+	for _, op := range operations(strings.Join(fields[4:], " ")) {
+		switch op[0] {
+		case "id":
+			if len(op) > 1 {
+				pos.id = strings.Join(op[1:], " ")
+			}
+		case "bm", "am":
+			pos.want = strings.TrimSpace(pos.want + " " + strings.Join(op, " "))
+			for _, san := range op[1:] {
+				m, err := state.ParseSAN(san, state.Turn)
+				if errors.Is(err, game.ErrCastling) {
+					if op[0] == "bm" {
+						pos.skip = "castling"
+					}
+					continue
+				} else if err != nil {
+					return nil, err
+				}
+				if op[0] == "bm" {
+					pos.bm = append(pos.bm, state.UCIMove(m))
+				} else {
+					pos.am = append(pos.am, state.UCIMove(m))
+				}
+			}
+		}
+	}
+	if len(pos.bm) == 0 && len(pos.am) == 0 && pos.skip == "" {
+		return nil, errors.New("expected a bm or am operation")
+	}
+	pos.theme = theme(pos.id)
+	return pos, nil
+}
+
+// loadPositions reads the positions of an epd file, skipping empty lines and # comments
+func loadPositions(path string) ([]*position, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	positions := []*position{}
+	scanner := bufio.NewScanner(file)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		pos, err := parsePosition(line)
+		if err != nil {
+			return nil, fmt.Errorf("%v:%v: %v", path, lineNum, err)
+		}
+		if pos.id == "" {
+			pos.id = fmt.Sprintf("%v:%v", path, lineNum)
+		}
+		positions = append(positions, pos)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(positions) == 0 {
+		return nil, fmt.Errorf("%v: no positions", path)
+	}
+	return positions, nil
+}
+
+// solves reports if the uci move solves pos
+func (pos *position) solves(move string) bool {
+	for _, am := range pos.am {
+		if move == am {
+			return false
+		}
+	}
+	if len(pos.bm) == 0 {
+		return true
+	}
+	for _, bm := range pos.bm {
+		if move == bm {
+			return true
+		}
+	}
+	return false
+}
+
+// solve searches pos within limits, the time to solution is when the search last switched to a solving move
+func solve(pos *position, limits engine.Limits) result {
+	state, _ := game.NewStateFromFEN(pos.fen)
+	engine.NewGame()
+	r := result{}
+	start := time.Now()
+	lines := engine.Think(state.Copy(), state.Turn, limits, func(info engine.Info) {
+		if len(info.Lines) == 0 {
+			return
+		}
+		r.depth = info.Depth
+		solved := pos.solves(state.UCIMove(info.Lines[0].Move))
+		if solved && !r.solved {
+			r.took = info.Time
+		}
+		r.solved = solved
+	})
+	if len(lines) == 0 {
+		return result{move: "(none)"}
+	}
+	r.move = state.SAN(lines[0].Move, state.Turn)
+	if solved := pos.solves(state.UCIMove(lines[0].Move)); solved != r.solved {
+		r.solved, r.took = solved, time.Since(start)
+	}
+	return r
+}
+
+// Run is the epd command: chess epd [flags] <file>. It searches every position of the suite and reports the positions
+// solved, with the time to solution, in total and by theme
+func Run(args []string) error {
+	flags := flag.NewFlagSet("epd", flag.ContinueOnError)
+	moveTime := flags.Duration("movetime", time.Second, "time to search every position for")
+	depth := flags.Int("depth", 0, "depth to search every position to instead of a time")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: chess epd [flags] <file>")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errors.New("expected one epd file")
+	}
+	positions, err := loadPositions(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	// a weakened search or more lines would get in the way of the best move
+	opts := engine.GetOptions()
+	opts.MultiPV = 1
+	opts.SkillLevel = engine.MaxSkill
+	opts.LimitStrength = false
+	opts.BookDepth = 0
+	if err := engine.SetOptions(opts); err != nil {
+		return err
+	}
+	limits := engine.Limits{MoveTime: *moveTime}
+	if *depth > 0 {
+		limits = engine.Limits{Depth: *depth, Infinite: true}
+	}
+
+	type count struct {
+		solved int
+		total  int
+	}
+	themes := map[string]*count{}
+	total := count{}
+	var solvedTime time.Duration
+	for i, pos := range positions {
+		if themes[pos.theme] == nil {
+			themes[pos.theme] = &count{}
+		}
+		themes[pos.theme].total++
+		total.total++
+		if pos.skip != "" {
+			fmt.Printf("%v/%v %v: skipped (%v)\n", i+1, len(positions), pos.id, pos.skip)
+			continue
+		}
+		r := solve(pos, limits)
+		if r.solved {
+			themes[pos.theme].solved++
+			total.solved++
+			solvedTime += r.took
+			fmt.Printf("%v/%v %v: %v solved in %.2fs (depth %v)\n", i+1, len(positions), pos.id, r.move, r.took.Seconds(), r.depth)
+		} else {
+			fmt.Printf("%v/%v %v: %v failed, %v (depth %v)\n", i+1, len(positions), pos.id, r.move, pos.want, r.depth)
+		}
+	}
+
+	fmt.Println("===========================")
+	if len(themes) > 1 {
+		names := []string{}
+		for name := range themes {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			c := themes[name]
+			fmt.Printf("%-30v %4v/%-4v %5.1f%%\n", name, c.solved, c.total, float64(c.solved)/float64(c.total)*100)
+		}
+		fmt.Println("===========================")
+	}
+	fmt.Printf("Solved: %v/%v (%.1f%%)\n", total.solved, total.total, float64(total.solved)/float64(total.total)*100)
+	if total.solved > 0 {
+		fmt.Printf("Average time to solution: %.2fs\n", solvedTime.Seconds()/float64(total.solved))
+	}
+	return nil
+}
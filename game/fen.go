@@ -0,0 +1,208 @@
+package game
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const StartFEN string = "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"
+
+var (
+	pieceTypeToFEN map[PieceType]byte = map[PieceType]byte{King: 'k', Queen: 'q', Rook: 'r', Bishop: 'b', Knight: 'n', Pawn: 'p'}
+	fenToPieceType map[byte]PieceType = map[byte]PieceType{'k': King, 'q': Queen, 'r': Rook, 'b': Bishop, 'n': Knight, 'p': Pawn}
+)
+
+// PosToSquare returns the algebraic name of pos ("e4"), the board is read with the starter at the bottom
+func (state *State) PosToSquare(pos Pos) string {
+	if state.Starter == Black {
+		return fmt.Sprintf("%c%d", 'h'-pos.Y, pos.X+1)
+	}
+	return fmt.Sprintf("%c%d", 'a'+pos.Y, 8-pos.X)
+}
+
+func (state *State) SquareToPos(square string) (Pos, error) {
+	if len(square) != 2 || square[0] < 'a' || square[0] > 'h' || square[1] < '1' || square[1] > '8' {
+		return Pos{}, fmt.Errorf("invalid square %q", square)
+	}
+	file, rank := int(square[0]-'a'), int(square[1]-'1')
+	if state.Starter == Black {
+		return Pos{rank, 7 - file}, nil
+	}
+	return Pos{7 - rank, file}, nil
+}
+
+// NewStateFromFEN parses a FEN, white is the starter so it is at the bottom of the board
+func NewStateFromFEN(fen string) (*State, error) {
+	fields := strings.Fields(fen)
+	if len(fields) < 4 {
+		return nil, fmt.Errorf("invalid fen %q: expected at least 4 fields", fen)
+	}
+	state := &State{Turn: White, Starter: White, Winner: NilPlayer}
+	state.Board = make([][]*Piece, 8)
+	for i := 0; i <= 7; i++ {
+		state.Board[i] = make([]*Piece, 8)
+	}
+	rows := strings.Split(fields[0], "/")
+	if len(rows) != 8 {
+		return nil, fmt.Errorf("invalid fen %q: expected 8 ranks", fen)
+	}
+	for i, row := range rows {
+		j := 0
+		for _, c := range []byte(row) {
+			if c >= '1' && c <= '8' {
+				j += int(c - '0')
+				continue
+			}
+			owner := Black
+			if c >= 'A' && c <= 'Z' {
+				owner = White
+				c += 'a' - 'A'
+			}
+			t, ok := fenToPieceType[c]
+			if !ok || j > 7 {
+				return nil, fmt.Errorf("invalid fen %q: bad rank %q", fen, row)
+			}
+			state.Add(Pos{i, j}, Piece{t, owner})
+			j++
+		}
+		if j != 8 {
+			return nil, fmt.Errorf("invalid fen %q: bad rank %q", fen, row)
+		}
+	}
+	switch fields[1] {
+	case "w":
+		state.Turn = White
+	case "b":
+		state.Turn = Black
+	default:
+		return nil, fmt.Errorf("invalid fen %q: bad side to move", fen)
+	}
+	state.CanCastleLong = map[Player]bool{
+		White: strings.Contains(fields[2], "Q"),
+		Black: strings.Contains(fields[2], "q"),
+	}
+	state.CanCastleShort = map[Player]bool{
+		White: strings.Contains(fields[2], "K"),
+		Black: strings.Contains(fields[2], "k"),
+	}
+	if fields[3] != "-" {
+		target, err := state.SquareToPos(fields[3])
+		if err != nil {
+			return nil, fmt.Errorf("invalid fen %q: %v", fen, err)
+		}
+		// the fen has the square behind the pawn, PassantPos is the pawn itself
+		if target.X == 5 {
+			state.PassantPos = &Pos{target.X - 1, target.Y}
+		} else {
+			state.PassantPos = &Pos{target.X + 1, target.Y}
+		}
+	}
+	if len(fields) >= 6 {
+		fullMoves, err := strconv.Atoi(fields[5])
+		if err != nil || fullMoves < 1 {
+			return nil, fmt.Errorf("invalid fen %q: bad move number", fen)
+		}
+		state.Ply = (fullMoves - 1) * 2
+		if state.Turn == Black {
+			state.Ply++
+		}
+	}
+	return state, nil
+}
+
+func (state *State) FEN() string {
+	var sb strings.Builder
+	for r := 0; r <= 7; r++ {
+		empty := 0
+		for f := 0; f <= 7; f++ {
+			pos, _ := state.SquareToPos(fmt.Sprintf("%c%d", 'a'+f, 8-r))
+			piece := state.Board[pos.X][pos.Y]
+			if piece == nil {
+				empty++
+				continue
+			}
+			if empty > 0 {
+				sb.WriteByte(byte('0' + empty))
+				empty = 0
+			}
+			c := pieceTypeToFEN[piece.Type]
+			if piece.Owner == White {
+				c -= 'a' - 'A'
+			}
+			sb.WriteByte(c)
+		}
+		if empty > 0 {
+			sb.WriteByte(byte('0' + empty))
+		}
+		if r != 7 {
+			sb.WriteByte('/')
+		}
+	}
+	if state.Turn == Black {
+		sb.WriteString(" b ")
+	} else {
+		sb.WriteString(" w ")
+	}
+	castling := ""
+	if state.CanCastleShort[White] {
+		castling += "K"
+	}
+	if state.CanCastleLong[White] {
+		castling += "Q"
+	}
+	if state.CanCastleShort[Black] {
+		castling += "k"
+	}
+	if state.CanCastleLong[Black] {
+		castling += "q"
+	}
+	if castling == "" {
+		castling = "-"
+	}
+	sb.WriteString(castling)
+	if state.PassantPos != nil {
+		piece := state.Board[state.PassantPos.X][state.PassantPos.Y]
+		behind := Pos{state.PassantPos.X + 1, state.PassantPos.Y}
+		if piece != nil && piece.Owner != state.Starter {
+			behind = Pos{state.PassantPos.X - 1, state.PassantPos.Y}
+		}
+		sb.WriteString(" " + state.PosToSquare(behind))
+	} else {
+		sb.WriteString(" -")
+	}
+	fmt.Fprintf(&sb, " 0 %v", state.Ply/2+1)
+	return sb.String()
+}
+
+// Chess960FEN is the start position number n (0 to 959) of Chess960 by the numbering of Scharnagl, without castling
+// rights as castling isn't supported
+func Chess960FEN(n int) string {
+	rank := make([]byte, 8)
+	rank[n%4*2+1] = 'b' // light squared bishop on b, d, f or h
+	n /= 4
+	rank[n%4*2] = 'b'
+	n /= 4
+	place := func(piece byte, k int) { // on the k-th empty square
+		for i := range rank {
+			if rank[i] != 0 {
+				continue
+			}
+			if k == 0 {
+				rank[i] = piece
+				return
+			}
+			k--
+		}
+	}
+	place('q', n%6)
+	n /= 6
+	knights := [10][2]int{{0, 1}, {0, 2}, {0, 3}, {0, 4}, {1, 2}, {1, 3}, {1, 4}, {2, 3}, {2, 4}, {3, 4}}[n%10]
+	place('n', knights[1]) // the second first so the first keeps its index
+	place('n', knights[0])
+	place('r', 0)
+	place('k', 0)
+	place('r', 0)
+	black := string(rank)
+	return fmt.Sprintf("%v/pppppppp/8/8/8/8/PPPPPPPP/%v w - - 0 1", black, strings.ToUpper(black))
+}
@@ -0,0 +1,34 @@
+package game
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestChess960FEN(t *testing.T) {
+	// 518 is the standard start position, without the castling rights
+	want := strings.Replace(StartFEN, "KQkq", "-", 1)
+	if fen := Chess960FEN(518); fen != want {
+		t.Errorf("Chess960FEN(518) = %q, want %q", fen, want)
+	}
+	tests := []struct {
+		n    int
+		rank string
+	}{
+		{0, "BBQNNRKR"},
+		{1, "BQNBNRKR"},
+		{4, "QBBNNRKR"},
+		{16, "BBNQNRKR"},
+		{96, "BBQNRNKR"},
+		{959, "RKRNNQBB"},
+	}
+	for _, test := range tests {
+		fen := Chess960FEN(test.n)
+		if fields := strings.Split(strings.Fields(fen)[0], "/"); fields[7] != test.rank || fields[0] != strings.ToLower(test.rank) {
+			t.Errorf("Chess960FEN(%v) = %q, want %v", test.n, fen, test.rank)
+		}
+		if _, err := NewStateFromFEN(fen); err != nil {
+			t.Errorf("Chess960FEN(%v): %v", test.n, err)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package game
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Node is a position of a game record, reached by Move from its parent. The first child continues the line of the
+// node, the others are variations
+type Node struct {
+	Move     Move // the zero move at the root
+	SAN      string
+	State    *State // after the move, with Turn on the player to move next. Shared by the record, not to be changed
+	Hash     uint64
+	Time     time.Time // when the move was played
+	Comment  string
+	Parent   *Node
+	Children []*Node
+}
+
+// Game is the record of a game: the initial position, the moves played from it with their variations and the
+// position the record is at
+type Game struct {
+	Root    *Node
+	Current *Node
+	Result  string            // "1-0", "0-1", "1/2-1/2", or "*" while the game goes on
+	Reason  string            // how the game ended
+	Tags    map[string]string // pgn tags of the game, like the Variant of a game not of standard chess
+	hash    func(*State) uint64
+}
+
+// NewGame starts a record from a copy of start, hash keys the positions (engine.Hash), nil leaves the hashes zero
+func NewGame(start *State, hash func(*State) uint64) *Game {
+	root := &Node{State: start.Copy(), Time: time.Now()}
+	if hash != nil {
+		root.Hash = hash(root.State)
+	}
+	return &Game{Root: root, Current: root, Result: "*", Tags: map[string]string{}, hash: hash}
+}
+
+// End sets the result of the game, winner is Both for a draw
+func (g *Game) End(winner Player, reason string) {
+	switch winner {
+	case White:
+		g.Result = "1-0"
+	case Black:
+		g.Result = "0-1"
+	default:
+		g.Result = "1/2-1/2"
+	}
+	g.Reason = reason
+}
+
+// State is the position the record is at, a copy the caller may change
+func (g *Game) State() *State {
+	return g.Current.State.Copy()
+}
+
+// Ply is the number of moves from the initial position to the current one
+func (g *Game) Ply() int {
+	return g.Current.State.Ply - g.Root.State.Ply
+}
+
+// Play plays m from the current position and goes to it. A move already played from there is reused, another one
+// starts a variation
+func (g *Game) Play(m Move) *Node {
+	for _, child := range g.Current.Children {
+		if child.Move.Start == m.Start && child.Move.End == m.End && child.Move.ConvertType == m.ConvertType {
+			g.Current = child
+			return child
+		}
+	}
+	player := g.Current.State.Turn
+	node := &Node{Move: m, SAN: g.Current.State.SAN(m, player), State: g.Current.State.Copy(), Time: time.Now(), Parent: g.Current}
+	node.State.RunMove(m)
+	node.State.Turn = (player + 1) % 2
+	if g.hash != nil {
+		node.Hash = g.hash(node.State)
+	}
+	g.Current.Children = append(g.Current.Children, node)
+	g.Current = node
+	return node
+}
+
+// Back goes to the previous position, false at the initial one
+func (g *Game) Back() bool {
+	if g.Current.Parent == nil {
+		return false
+	}
+	g.Current = g.Current.Parent
+	return true
+}
+
+// Forward goes to the next position of the line, false at its end
+func (g *Game) Forward() bool {
+	if len(g.Current.Children) == 0 {
+		return false
+	}
+	g.Current = g.Current.Children[0]
+	return true
+}
+
+// GoTo goes back or forward along the line of the current position to ply, false when the line is shorter
+func (g *Game) GoTo(ply int) bool {
+	if ply < 0 {
+		return false
+	}
+	node := g.Current
+	for node.State.Ply-g.Root.State.Ply > ply {
+		node = node.Parent
+	}
+	for node.State.Ply-g.Root.State.Ply < ply {
+		if len(node.Children) == 0 {
+			return false
+		}
+		node = node.Children[0]
+	}
+	g.Current = node
+	return true
+}
+
+// Variation goes to the i-th move played from the current position, 0 continues the line
+func (g *Game) Variation(i int) bool {
+	if i < 0 || i >= len(g.Current.Children) {
+		return false
+	}
+	g.Current = g.Current.Children[i]
+	return true
+}
+
+// Promote makes the line of the current position the main line, moving it first among its siblings up to the root
+func (g *Game) Promote() {
+	for node := g.Current; node.Parent != nil; node = node.Parent {
+		siblings := node.Parent.Children
+		for i, sibling := range siblings {
+			if sibling == node {
+				copy(siblings[1:i+1], siblings[:i])
+				siblings[0] = node
+				break
+			}
+		}
+	}
+}
+
+// Delete removes the current position and the moves played from it, going back to the previous one
+func (g *Game) Delete() bool {
+	node := g.Current
+	if node.Parent == nil {
+		return false
+	}
+	siblings := node.Parent.Children
+	for i, sibling := range siblings {
+		if sibling == node {
+			node.Parent.Children = append(siblings[:i:i], siblings[i+1:]...)
+			break
+		}
+	}
+	g.Current = node.Parent
+	return true
+}
+
+// Moves are the nodes from the initial position to the current one, the root excluded
+func (g *Game) Moves() []*Node {
+	moves := []*Node{}
+	for node := g.Current; node.Parent != nil; node = node.Parent {
+		moves = append(moves, node)
+	}
+	for i, j := 0, len(moves)-1; i < j; i, j = i+1, j-1 {
+		moves[i], moves[j] = moves[j], moves[i]
+	}
+	return moves
+}
+
+// Repetitions counts the positions of the current line, the current one included, with the hash of the current one.
+// It needs the hash function of NewGame
+func (g *Game) Repetitions() int {
+	count := 0
+	for node := g.Current; node != nil; node = node.Parent {
+		if node.Hash == g.Current.Hash {
+			count++
+		}
+	}
+	return count
+}
+
+// Movetext writes the moves of the record in pgn, with the variations in parentheses and the comments in braces
+func (g *Game) Movetext() string {
+	tokens := []string{}
+	if g.Root.Comment != "" {
+		tokens = append(tokens, "{"+g.Root.Comment+"}")
+	}
+	tokens = appendLine(tokens, g.Root, true)
+	text := strings.Join(tokens, " ")
+	return strings.NewReplacer("( ", "(", " )", ")").Replace(text)
+}
+
+// appendLine writes the line that continues from node: its first child, the variations of that move, then the rest of
+// the line. The number of a black move is written when it starts a line or follows a variation or a comment
+func appendLine(tokens []string, node *Node, numbered bool) []string {
+	for len(node.Children) > 0 {
+		next := node.Children[0]
+		tokens = appendMove(tokens, next, numbered)
+		numbered = next.Comment != "" || len(node.Children) > 1
+		for _, variation := range node.Children[1:] {
+			tokens = append(tokens, "(")
+			tokens = appendMove(tokens, variation, true)
+			tokens = append(appendLine(tokens, variation, variation.Comment != ""), ")")
+		}
+		node = next
+	}
+	return tokens
+}
+
+func appendMove(tokens []string, node *Node, numbered bool) []string {
+	ply := node.Parent.State.Ply
+	if ply%2 == 0 {
+		tokens = append(tokens, fmt.Sprintf("%v.", ply/2+1))
+	} else if numbered {
+		tokens = append(tokens, fmt.Sprintf("%v...", ply/2+1))
+	}
+	tokens = append(tokens, node.SAN)
+	if node.Comment != "" {
+		tokens = append(tokens, "{"+node.Comment+"}")
+	}
+	return tokens
+}
@@ -0,0 +1,208 @@
+package game
+
+import (
+	"hash/fnv"
+	"strings"
+	"testing"
+)
+
+// fenHash keys a position by the fields of its fen that make it the same position, the move counters left out
+func fenHash(state *State) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(strings.Join(strings.Fields(state.FEN())[:4], " ")))
+	return h.Sum64()
+}
+
+func newTestGame(t *testing.T) *Game {
+	state, err := NewStateFromFEN(StartFEN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewGame(state, fenHash)
+}
+
+// play plays the moves in san from the current position of g
+func play(t *testing.T, g *Game, sans ...string) {
+	t.Helper()
+	for _, san := range sans {
+		state := g.Current.State
+		m, err := state.ParseSAN(san, state.Turn)
+		if err != nil {
+			t.Fatalf("%v: %v", san, err)
+		}
+		g.Play(m)
+	}
+}
+
+func checkAt(t *testing.T, g *Game, ply int, san string) {
+	t.Helper()
+	if g.Ply() != ply || g.Current.SAN != san {
+		t.Errorf("at ply %v after %q, want ply %v after %q", g.Ply(), g.Current.SAN, ply, san)
+	}
+}
+
+func TestPlay(t *testing.T) {
+	g := newTestGame(t)
+	play(t, g, "e4", "e5", "Nf3")
+	checkAt(t, g, 3, "Nf3")
+	if turn := g.State().Turn; turn != Black {
+		t.Errorf("%v to move after 2. Nf3", PlayerToString[turn])
+	}
+	node := g.Current
+	g.Back()
+	play(t, g, "Nf3")
+	if g.Current != node || len(node.Parent.Children) != 1 {
+		t.Errorf("playing a move again started a variation")
+	}
+	if g.State() == g.Current.State {
+		t.Errorf("State returned the state of the record, not a copy")
+	}
+	if g.Result != "*" {
+		t.Errorf("result %q of a game going on", g.Result)
+	}
+	g.End(Both, "agreed")
+	if g.Result != "1/2-1/2" || g.Reason != "agreed" {
+		t.Errorf("result %q, reason %q after a draw", g.Result, g.Reason)
+	}
+}
+
+func TestNavigation(t *testing.T) {
+	g := newTestGame(t)
+	if g.Back() || g.Forward() {
+		t.Errorf("moved in an empty record")
+	}
+	play(t, g, "e4", "e5", "Nf3", "Nc6")
+	if g.Forward() {
+		t.Errorf("went forward at the end of the line")
+	}
+	g.Back()
+	checkAt(t, g, 3, "Nf3")
+	g.Forward()
+	checkAt(t, g, 4, "Nc6")
+	if !g.GoTo(1) {
+		t.Fatalf("GoTo(1) failed")
+	}
+	checkAt(t, g, 1, "e4")
+	if !g.GoTo(3) {
+		t.Fatalf("GoTo(3) failed")
+	}
+	checkAt(t, g, 3, "Nf3")
+	if g.GoTo(5) || g.GoTo(-1) {
+		t.Errorf("went past the ends of the line")
+	}
+	checkAt(t, g, 3, "Nf3")
+	g.GoTo(0)
+	if g.Current != g.Root || g.Back() {
+		t.Errorf("GoTo(0) isn't at the root")
+	}
+	if moves := g.Moves(); len(moves) != 0 {
+		t.Errorf("%v moves at the root", len(moves))
+	}
+	g.GoTo(4)
+	sans := []string{}
+	for _, node := range g.Moves() {
+		sans = append(sans, node.SAN)
+	}
+	if s := strings.Join(sans, " "); s != "e4 e5 Nf3 Nc6" {
+		t.Errorf("moves %q", s)
+	}
+}
+
+func TestVariations(t *testing.T) {
+	g := newTestGame(t)
+	play(t, g, "e4", "e5", "Nf3", "Nc6")
+	g.GoTo(2)
+	play(t, g, "Bc4", "Nf6")
+	checkAt(t, g, 4, "Nf6")
+	g.GoTo(2)
+	if !g.Variation(1) {
+		t.Fatalf("Variation(1) failed")
+	}
+	checkAt(t, g, 3, "Bc4")
+	g.Back()
+	if g.Variation(2) || g.Variation(-1) {
+		t.Errorf("went to a variation that isn't there")
+	}
+	g.Variation(0)
+	checkAt(t, g, 3, "Nf3")
+
+	// promoting the variation from its last move makes it the line of the record
+	g.Back()
+	g.Variation(1)
+	g.Forward()
+	g.Promote()
+	g.GoTo(0)
+	g.GoTo(4)
+	checkAt(t, g, 4, "Nf6")
+	if want := "1. e4 e5 2. Bc4 (2. Nf3 Nc6) 2... Nf6"; g.Movetext() != want {
+		t.Errorf("movetext %q, want %q", g.Movetext(), want)
+	}
+
+	g.GoTo(3)
+	if !g.Delete() {
+		t.Fatalf("Delete failed")
+	}
+	checkAt(t, g, 2, "e5")
+	if len(g.Current.Children) != 1 || g.Current.Children[0].SAN != "Nf3" {
+		t.Errorf("the variation left isn't the first move")
+	}
+	if want := "1. e4 e5 2. Nf3 Nc6"; g.Movetext() != want {
+		t.Errorf("movetext %q, want %q", g.Movetext(), want)
+	}
+	g.GoTo(0)
+	if g.Delete() {
+		t.Errorf("deleted the root")
+	}
+}
+
+func TestMovetext(t *testing.T) {
+	g := newTestGame(t)
+	g.Root.Comment = "start"
+	play(t, g, "e4", "e5", "Nf3")
+	g.Current.Comment = "main"
+	play(t, g, "Nc6", "Nc3", "Nf6")
+	g.GoTo(2)
+	play(t, g, "Bc4", "Nf6")
+	g.Back()
+	play(t, g, "Bc5")
+	g.GoTo(2)
+	play(t, g, "f4")
+	want := "{start} 1. e4 e5 2. Nf3 {main} (2. Bc4 Nf6 (2... Bc5)) (2. f4) 2... Nc6 3. Nc3 Nf6"
+	if text := g.Movetext(); text != want {
+		t.Errorf("movetext\n%q, want\n%q", text, want)
+	}
+
+	// a black move that starts a variation is numbered
+	g.GoTo(1)
+	play(t, g, "c5")
+	if want := "{start} 1. e4 e5 (1... c5) 2. Nf3"; !strings.HasPrefix(g.Movetext(), want) {
+		t.Errorf("movetext %q, want it to start with %q", g.Movetext(), want)
+	}
+}
+
+func TestRepetitions(t *testing.T) {
+	g := newTestGame(t)
+	if n := g.Repetitions(); n != 1 {
+		t.Errorf("%v repetitions at the start", n)
+	}
+	play(t, g, "Nf3", "Nf6", "Ng1", "Ng8")
+	if n := g.Repetitions(); n != 2 {
+		t.Errorf("%v repetitions of the start position, want 2", n)
+	}
+	play(t, g, "Nf3")
+	if n := g.Repetitions(); n != 2 {
+		t.Errorf("%v repetitions after 3. Nf3, want 2", n)
+	}
+	play(t, g, "Nf6", "Ng1", "Ng8")
+	if n := g.Repetitions(); n != 3 {
+		t.Errorf("%v repetitions of the start position, want 3", n)
+	}
+	// positions of other lines don't count
+	g.GoTo(4)
+	play(t, g, "e4")
+	g.GoTo(0)
+	g.GoTo(8)
+	if n := g.Repetitions(); n != 3 {
+		t.Errorf("%v repetitions after a variation, want 3", n)
+	}
+}
@@ -0,0 +1,143 @@
+package game
+
+import (
+	"bufio"
+	"io"
+	"regexp"
+	"strings"
+)
+
+var (
+	tagRegexp      *regexp.Regexp = regexp.MustCompile(`^\[(\w+)\s+"((?:[^"\\]|\\.)*)"\s*\]`)
+	moveNumRegexp  *regexp.Regexp = regexp.MustCompile(`^\d+\.+`)
+	pgnResults     []string       = []string{"1-0", "0-1", "1/2-1/2", "*"}
+	pgnLineBufSize int            = 1024 * 1024
+)
+
+// PGN is one game of a pgn file, the moves are in SAN as written in the file
+type PGN struct {
+	Tags   map[string]string
+	Moves  []string
+	Result string
+}
+
+// PGNReader reads the games of a pgn file one by one, so large collections don't have to fit in memory
+type PGNReader struct {
+	scanner *bufio.Scanner
+	line    string // the first tag of the next game, read by the previous call to Next
+}
+
+func NewPGNReader(r io.Reader) *PGNReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), pgnLineBufSize)
+	return &PGNReader{scanner: scanner}
+}
+
+// Next returns the next game, or io.EOF when there are none left
+func (reader *PGNReader) Next() (*PGN, error) {
+	pgn := &PGN{Tags: map[string]string{}}
+	var movetext strings.Builder
+	hasMoves := false
+	line := reader.line
+	reader.line = ""
+	for {
+		if line == "" {
+			if !reader.scanner.Scan() {
+				break
+			}
+			line = strings.TrimSpace(reader.scanner.Text())
+		}
+		if strings.HasPrefix(line, "[") && !strings.HasPrefix(line, "[%") {
+			if hasMoves { // tags of the next game
+				reader.line = line
+				break
+			}
+			if m := tagRegexp.FindStringSubmatch(line); m != nil {
+				pgn.Tags[m[1]] = strings.ReplaceAll(m[2], `\"`, `"`)
+			}
+		} else if line != "" && !strings.HasPrefix(line, "%") {
+			hasMoves = true
+			movetext.WriteString(line)
+			movetext.WriteByte('\n')
+		}
+		line = ""
+	}
+	if err := reader.scanner.Err(); err != nil {
+		return nil, err
+	}
+	if !hasMoves && len(pgn.Tags) == 0 {
+		return nil, io.EOF
+	}
+	pgn.Moves, pgn.Result = parseMovetext(movetext.String())
+	if pgn.Result == "" {
+		pgn.Result = pgn.Tags["Result"]
+	}
+	return pgn, nil
+}
+
+// parseMovetext drops comments, variations, move numbers and annotations, leaving the moves and the result
+func parseMovetext(text string) ([]string, string) {
+	var sb strings.Builder
+	depth := 0
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case c == '{':
+			end := strings.IndexByte(text[i:], '}')
+			if end == -1 {
+				i = len(text)
+			} else {
+				i += end
+			}
+			sb.WriteByte(' ')
+		case c == ';' && depth == 0:
+			end := strings.IndexByte(text[i:], '\n')
+			if end == -1 {
+				i = len(text)
+			} else {
+				i += end
+			}
+			sb.WriteByte(' ')
+		case c == '(':
+			depth++
+		case c == ')':
+			if depth > 0 {
+				depth--
+			}
+			sb.WriteByte(' ')
+		case depth == 0:
+			sb.WriteByte(c)
+		}
+	}
+	moves := []string{}
+	result := ""
+	for _, token := range strings.Fields(sb.String()) {
+		token = moveNumRegexp.ReplaceAllString(token, "")
+		if token == "" || strings.HasPrefix(token, "$") {
+			continue
+		}
+		if isPGNResult(token) {
+			result = token
+			break
+		}
+		moves = append(moves, strings.TrimRight(token, "!?"))
+	}
+	return moves, result
+}
+
+func isPGNResult(token string) bool {
+	for _, r := range pgnResults {
+		if token == r {
+			return true
+		}
+	}
+	return false
+}
+
+// StartState is the position the game starts from, the FEN tag if there is one
+func (pgn *PGN) StartState() (*State, error) {
+	if fen, ok := pgn.Tags["FEN"]; ok {
+		return NewStateFromFEN(fen)
+	}
+	return NewStartState(White), nil
+}
@@ -0,0 +1,197 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	ErrCastling error = errors.New("castling is not supported")
+
+	sanToPieceType map[byte]PieceType = map[byte]PieceType{'K': King, 'Q': Queen, 'R': Rook, 'B': Bishop, 'N': Knight}
+)
+
+// ParseSAN finds the move of player written in standard algebraic notation ("Nbd7", "exd5", "e8=Q+")
+func (state *State) ParseSAN(san string, player Player) (Move, error) {
+	s := strings.TrimRight(san, "+#!?")
+	if strings.HasPrefix(s, "O-O") || strings.HasPrefix(s, "0-0") {
+		return Move{}, ErrCastling
+	}
+	convertType := NilPiece
+	if i := strings.IndexByte(s, '='); i != -1 && i == len(s)-2 {
+		t, ok := sanToPieceType[s[i+1]]
+		if !ok || t == King {
+			return Move{}, fmt.Errorf("invalid move %q", san)
+		}
+		convertType = t
+		s = s[:i]
+	}
+	pieceType := Pawn
+	if len(s) > 0 {
+		if t, ok := sanToPieceType[s[0]]; ok {
+			pieceType = t
+			s = s[1:]
+		}
+	}
+	s = strings.ReplaceAll(s, "x", "")
+	if len(s) < 2 || len(s) > 4 {
+		return Move{}, fmt.Errorf("invalid move %q", san)
+	}
+	end, err := state.SquareToPos(s[len(s)-2:])
+	if err != nil {
+		return Move{}, fmt.Errorf("invalid move %q", san)
+	}
+	from := s[:len(s)-2] // disambiguation, a file, a rank or both
+
+	var found []Move
+	for _, m := range state.GetMoves(player) {
+		piece := state.Board[m.Start.X][m.Start.Y]
+		if m.End != end || piece.Type != pieceType || !state.matchesSquare(m.Start, from) {
+			continue
+		}
+		if m.IsConversion != (convertType != NilPiece) {
+			continue
+		}
+		m.ConvertType = convertType
+		found = append(found, m)
+	}
+	if len(found) > 1 { // pseudo legal moves, drop the ones that leave the king attacked
+		legal := []Move{}
+		for _, m := range found {
+			if !state.LeavesKingAttacked(m, player) {
+				legal = append(legal, m)
+			}
+		}
+		found = legal
+	}
+	if len(found) == 0 {
+		return Move{}, fmt.Errorf("illegal move %q", san)
+	}
+	if len(found) > 1 {
+		return Move{}, fmt.Errorf("ambiguous move %q", san)
+	}
+	return found[0], nil
+}
+
+func (state *State) matchesSquare(pos Pos, s string) bool {
+	square := state.PosToSquare(pos)
+	for _, c := range []byte(s) {
+		if c >= 'a' && c <= 'h' {
+			if c != square[0] {
+				return false
+			}
+		} else if c >= '1' && c <= '8' {
+			if c != square[1] {
+				return false
+			}
+		} else {
+			return false
+		}
+	}
+	return true
+}
+
+// LeavesKingAttacked reports if after player runs m any opponent piece attacks its king
+func (state *State) LeavesKingAttacked(m Move, player Player) bool {
+	copied := state.Copy()
+	copied.RunMove(m)
+	return copied.InCheck(player)
+}
+
+// InCheck reports if any opponent piece attacks the king of player
+func (state *State) InCheck(player Player) bool {
+	attacks := state.GetAttacks((player + 1) % 2)
+	for i := 0; i <= 7; i++ {
+		for j := 0; j <= 7; j++ {
+			piece := state.Board[i][j]
+			if piece != nil && piece.Type == King && piece.Owner == player && attacks[i][j] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// InsufficientMaterial reports if player has no more than the king and a bishop or a knight, too little to mate with
+func (state *State) InsufficientMaterial(player Player) bool {
+	minors := 0
+	for i := 0; i <= 7; i++ {
+		for j := 0; j <= 7; j++ {
+			piece := state.Board[i][j]
+			if piece == nil || piece.Owner != player || piece.Type == King {
+				continue
+			}
+			if piece.Type != Bishop && piece.Type != Knight {
+				return false
+			}
+			minors++
+		}
+	}
+	return minors <= 1
+}
+
+// LegalMoves are the moves of GetMoves that don't leave the king of player attacked
+func (state *State) LegalMoves(player Player) []Move {
+	legal := []Move{}
+	for _, m := range state.GetMoves(player) {
+		if !state.LeavesKingAttacked(m, player) {
+			legal = append(legal, m)
+		}
+	}
+	return legal
+}
+
+// SAN writes the move m of player in standard algebraic notation, with the file or rank of the piece when another
+// one of its type can move to the same square, and + or # when it checks or mates
+func (state *State) SAN(m Move, player Player) string {
+	piece := state.Board[m.Start.X][m.Start.Y]
+	end := state.PosToSquare(m.End)
+	var sb strings.Builder
+	if piece.Type == Pawn {
+		if m.Capture != nil {
+			sb.WriteByte(state.PosToSquare(m.Start)[0])
+			sb.WriteByte('x')
+		}
+		sb.WriteString(end)
+		if m.IsConversion && m.ConvertType != NilPiece {
+			sb.WriteByte('=')
+			sb.WriteByte(pieceTypeToFEN[m.ConvertType] - 'a' + 'A')
+		}
+	} else {
+		sb.WriteByte(pieceTypeToFEN[piece.Type] - 'a' + 'A')
+		start := state.PosToSquare(m.Start)
+		sameFile, sameRank, others := false, false, false
+		for _, other := range state.LegalMoves(player) {
+			if other.End != m.End || other.Start == m.Start || state.Board[other.Start.X][other.Start.Y].Type != piece.Type {
+				continue
+			}
+			others = true
+			square := state.PosToSquare(other.Start)
+			sameFile = sameFile || square[0] == start[0]
+			sameRank = sameRank || square[1] == start[1]
+		}
+		if others && !sameFile {
+			sb.WriteByte(start[0])
+		} else if others && !sameRank {
+			sb.WriteByte(start[1])
+		} else if others {
+			sb.WriteString(start)
+		}
+		if m.Capture != nil {
+			sb.WriteByte('x')
+		}
+		sb.WriteString(end)
+	}
+	after := state.Copy()
+	after.RunMove(m)
+	opp := (player + 1) % 2
+	if after.InCheck(opp) {
+		if len(after.LegalMoves(opp)) == 0 {
+			sb.WriteByte('#')
+		} else {
+			sb.WriteByte('+')
+		}
+	}
+	return sb.String()
+}
@@ -81,7 +81,7 @@ func PrintBoard(board [][]*Piece) {
 
 func NewStartState(starter Player) *State {
 	nonStarter := (starter + 1) % 2
-	state := &State{Turn: starter}
+	state := &State{Turn: starter, Starter: starter}
 	state.Board = make([][]*Piece, 8)
 	for i := 0; i <= 7; i++ {
 		state.Board[i] = make([]*Piece, 8)
@@ -118,6 +118,7 @@ type State struct {
 	Starter        Player
 	IsGameEnd      bool
 	Winner         Player
+	Ply            int // half moves played, counted by RunMove and ReverseMove
 }
 
 func (state *State) Add(pos Pos, piece Piece) {
@@ -128,6 +129,51 @@ func (state *State) Remove(pos Pos) {
 	state.Board[pos.X][pos.Y] = nil
 }
 
+func (state *State) Copy() *State {
+	copied := &State{Turn: state.Turn, Starter: state.Starter, IsGameEnd: state.IsGameEnd, Winner: state.Winner, Ply: state.Ply}
+	copied.Board = make([][]*Piece, 8)
+	for i := 0; i <= 7; i++ {
+		copied.Board[i] = make([]*Piece, 8)
+		for j := 0; j <= 7; j++ {
+			if state.Board[i][j] != nil {
+				copied.Add(Pos{i, j}, *state.Board[i][j])
+			}
+		}
+	}
+	if state.PassantPos != nil {
+		copied.PassantPos = &Pos{state.PassantPos.X, state.PassantPos.Y}
+	}
+	copied.CanCastleLong = map[Player]bool{}
+	copied.CanCastleShort = map[Player]bool{}
+	for _, p := range Players {
+		copied.CanCastleLong[p] = state.CanCastleLong[p]
+		copied.CanCastleShort[p] = state.CanCastleShort[p]
+	}
+	return copied
+}
+
+// Rotated is a copy of state with starter at the bottom of the board, turned around when starter changes
+func (state *State) Rotated(starter Player) *State {
+	rotated := state.Copy()
+	rotated.Starter = starter
+	if starter == state.Starter {
+		return rotated
+	}
+	for i := 0; i <= 7; i++ {
+		for j := 0; j <= 7; j++ {
+			rotated.Board[i][j] = state.Board[7-i][7-j]
+			if rotated.Board[i][j] != nil {
+				piece := *rotated.Board[i][j]
+				rotated.Board[i][j] = &piece
+			}
+		}
+	}
+	if state.PassantPos != nil {
+		rotated.PassantPos = &Pos{7 - state.PassantPos.X, 7 - state.PassantPos.Y}
+	}
+	return rotated
+}
+
 func (state *State) RunMove(move Move) bool {
 	piece := state.Board[move.Start.X][move.Start.Y]
 	if piece.Type == King {
@@ -158,6 +204,7 @@ func (state *State) RunMove(move Move) bool {
 	if move.IsConversion && move.ConvertType != NilPiece {
 		state.Board[move.End.X][move.End.Y].Type = move.ConvertType
 	}
+	state.Ply++
 	return isGameEnd
 }
 
@@ -173,6 +220,7 @@ func (state *State) ReverseMove(move Move, captureType PieceType, convertType Pi
 	if move.IsConversion {
 		state.Board[move.Start.X][move.Start.Y].Type = Pawn
 	}
+	state.Ply--
 	//TODO:castling, cancastle...
 }
 
@@ -216,11 +264,70 @@ func GenMovesByDirs(state *State, start Pos, dirs []Pos, otherPlayer Player) []M
 	return moves
 }
 
-func (state *State) GetAttacks(player Player) [][]bool { //TODO: GET ATTACKS: FOR CASTLING
+var (
+	knightOffsets []Pos = []Pos{{1, 2}, {-1, 2}, {1, -2}, {-1, -2}, {2, 1}, {-2, 1}, {2, -1}, {-2, -1}}
+	kingOffsets   []Pos = []Pos{{1, 1}, {-1, -1}, {-1, 1}, {1, -1}, {1, 0}, {0, 1}, {-1, 0}, {0, -1}}
+	rookRays      []Pos = []Pos{{1, 0}, {0, 1}, {-1, 0}, {0, -1}}
+	bishopRays    []Pos = []Pos{{1, 1}, {-1, -1}, {-1, 1}, {1, -1}}
+	queenRays     []Pos = []Pos{{1, 1}, {-1, -1}, {-1, 1}, {1, -1}, {1, 0}, {0, 1}, {-1, 0}, {0, -1}}
+)
+
+// GetPieceAttacks returns the squares attacked (or defended) by the piece at pos, sliding pieces include the first blocker
+func (state *State) GetPieceAttacks(pos Pos) []Pos {
+	piece := state.Board[pos.X][pos.Y]
+	attacks := []Pos{}
+	if piece == nil {
+		return attacks
+	}
+	var offsets, rays []Pos
+	switch piece.Type {
+	case Pawn:
+		dir := 1
+		if piece.Owner == state.Starter {
+			dir = -1
+		}
+		offsets = []Pos{{dir, -1}, {dir, 1}}
+	case Knight:
+		offsets = knightOffsets
+	case King:
+		offsets = kingOffsets
+	case Rook:
+		rays = rookRays
+	case Bishop:
+		rays = bishopRays
+	case Queen:
+		rays = queenRays
+	}
+	for _, offset := range offsets {
+		if p := pos.Add(offset); OnBoard(p) {
+			attacks = append(attacks, p)
+		}
+	}
+	for _, ray := range rays {
+		for p := pos.Add(ray); OnBoard(p); p = p.Add(ray) {
+			attacks = append(attacks, p)
+			if state.Board[p.X][p.Y] != nil {
+				break
+			}
+		}
+	}
+	return attacks
+}
+
+func (state *State) GetAttacks(player Player) [][]bool {
 	attacks := make([][]bool, 8)
 	for i := 0; i <= 7; i++ {
 		attacks[i] = make([]bool, 8)
 	}
+	for i := 0; i <= 7; i++ {
+		for j := 0; j <= 7; j++ {
+			if state.Board[i][j] != nil && state.Board[i][j].Owner == player {
+				for _, p := range state.GetPieceAttacks(Pos{i, j}) {
+					attacks[p.X][p.Y] = true
+				}
+			}
+		}
+	}
 	return attacks
 }
 
@@ -0,0 +1,54 @@
+package game
+
+import (
+	"fmt"
+)
+
+// UCIMove writes m in the coordinate notation of uci ("e2e4", "e7e8q")
+func (state *State) UCIMove(m Move) string {
+	s := state.PosToSquare(m.Start) + state.PosToSquare(m.End)
+	if m.IsConversion && m.ConvertType != NilPiece {
+		s += string(pieceTypeToFEN[m.ConvertType])
+	}
+	return s
+}
+
+// ParseUCIMove finds the move of player written in coordinate notation, a promotion without a piece is to a queen
+func (state *State) ParseUCIMove(s string, player Player) (Move, error) {
+	if len(s) != 4 && len(s) != 5 {
+		return Move{}, fmt.Errorf("invalid move %q", s)
+	}
+	start, err := state.SquareToPos(s[:2])
+	if err != nil {
+		return Move{}, fmt.Errorf("invalid move %q", s)
+	}
+	end, err := state.SquareToPos(s[2:4])
+	if err != nil {
+		return Move{}, fmt.Errorf("invalid move %q", s)
+	}
+	convertType := NilPiece
+	if len(s) == 5 {
+		t, ok := fenToPieceType[s[4]]
+		if !ok || t == King || t == Pawn {
+			return Move{}, fmt.Errorf("invalid move %q", s)
+		}
+		convertType = t
+	}
+	piece := state.Board[start.X][start.Y]
+	if piece != nil && piece.Type == King && (start.Y-end.Y == 2 || end.Y-start.Y == 2) {
+		return Move{}, ErrCastling
+	}
+	for _, m := range state.GetMoves(player) {
+		if m.Start != start || m.End != end {
+			continue
+		}
+		if m.IsConversion {
+			m.ConvertType = Queen
+			if convertType != NilPiece {
+				m.ConvertType = convertType
+			}
+		}
+		return m, nil
+	}
+	return Move{}, fmt.Errorf("illegal move %q", s)
+}
@@ -2,13 +2,24 @@ package main
 
 import (
 	"chess/bench"
+	"chess/book"
+	"chess/clock"
 	"chess/deepcopy"
 	"chess/engine"
+	"chess/epd"
 	"chess/game"
+	"chess/match"
+	"chess/tune"
+	"chess/uci"
 	"chess/util"
+	"flag"
 	"fmt"
 	"image/color"
+	"math/rand"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
 
 	"github.com/veandco/go-sdl2/img"
 	"github.com/veandco/go-sdl2/sdl"
@@ -26,24 +37,403 @@ var (
 )
 
 var (
-	pieceImages map[game.Player]map[game.PieceType]*sdl.Texture
-	openSans    *ttf.Font
+	pieceImages   map[game.Player]map[game.PieceType]*sdl.Texture
+	openSans      *ttf.Font
+	openSansSmall *ttf.Font
 )
 
 const (
-	assetsFolder string = "assets"
+	assetsFolder    string  = "assets"
+	analysisPanelW  float32 = 360
+	analysisPVMoves int     = 8
+	levelMenuCols   int     = 5
+	boardButtonW    float32 = 80
+	boardButtonH    float32 = 32
+	clockW          float32 = 110
+	clockH          float32 = 36
+	menuLabelW      float32 = 150
+	menuRowH        float32 = 70
 )
 
+// rows of the new game screen
+const (
+	menuSide int = iota
+	menuOpponent
+	menuLevel
+	menuStyle
+	menuPosition
+	menuTime
+)
+
+// menuRow is a choice of the new game screen, one of its options is selected
+type menuRow struct {
+	name     string
+	options  []string
+	selected int
+}
+
+// timeControl is a time control of the new game screen, spec is for clock.Parse
+type timeControl struct {
+	name string
+	spec string
+}
+
+// timeControls are the time controls of the new game screen, the engine uses the MoveTime option when Unlimited.
+// d is a simple delay and b a Bronstein delay
+var timeControls []timeControl = []timeControl{{"Unlimited", ""}, {"1+0", "1+0"}, {"3+2", "3+2"}, {"15+10", "15+10"}, {"5 d3", "5d3"},
+	{"5 b3", "5b3"}, {"40/90+30", "40/90+30,30+30"}}
+
+// chess960 is the position of the new game screen and the pgn variant of its games, the castling moves of Chess960
+// aren't supported so the games are played without them
+const chess960 string = "Chess960 (no castling)"
+
 type UIState struct {
 	gameState        *game.State
-	selected         *game.Pos //selected, convertMenu are inverted from screen coordinates
+	engines          [2]bool                    // the players the engine plays, by game.Player
+	clock            *clock.Clock               // nil without a time control
+	clocks           map[*game.Node]clock.Clock // the clock after every move of the record, undo and redo set it back
+	record           *game.Game                 // the moves played, undo and redo move along it
+	selected         *game.Pos                  //selected, convertMenu are inverted from screen coordinates
 	convertMenu      *game.Pos
+	convertMove      game.Move // the promotion waiting for its piece to be picked in convertMenu
 	prevMoveStart    *game.Pos
 	prevMoveEnd      *game.Pos
 	isEngineThinking bool
+	engineStop       chan struct{} // closed to cancel the search for the move of the engine
+	level            int           // skill level of the engine
+	levelMenu        bool          // the level picker is open, toggled with L
+
+	menu      []menuRow
+	showMenu  bool   // the new game screen is open, toggled with N
+	menuError string // why the game picked couldn't start
+
+	analysis      bool // analyzing the position on the turns of the human, toggled with A
+	analysisLines int
+	analysisStop  chan struct{}
+	analysisDone  chan struct{}
+	analysisMu    sync.Mutex
+	analysisInfo  *engine.Info
+
+	engineCh   chan engineResult
+	ponder     bool       // the engine searches the expected reply on the turns of the human, toggled with P
+	ponderMove *game.Move // the reply the engine ponders on, nil when not pondering
+	ponderHit  chan struct{}
+	ponderStop chan struct{}
+}
+
+type engineResult struct {
+	move   *game.Move
+	ponder *game.Move // the expected reply
+}
+
+// startPonder searches the position after the expected reply with the engine to move, the result is only played on a ponder hit
+func (uiState *UIState) startPonder(reply game.Move) {
+	state := uiState.gameState.Copy()
+	state.RunMove(reply)
+	state.Turn = (state.Turn + 1) % 2
+	hit, stop := make(chan struct{}), make(chan struct{})
+	uiState.ponderMove, uiState.ponderHit, uiState.ponderStop = &reply, hit, stop
+	limits := uiState.engineLimits(state.Turn)
+	limits.Ponder, limits.Stop = hit, stop
+	uiState.searchOptions(1, uiState.level)
+	go func() {
+		m, ponder := engine.Play(state, state.Turn, limits)
+		uiState.engineCh <- engineResult{m, ponder}
+	}()
+}
+
+func (uiState *UIState) stopPonder() {
+	if uiState.ponderMove == nil {
+		return
+	}
+	close(uiState.ponderStop)
+	<-uiState.engineCh
+	uiState.ponderMove = nil
+}
+
+// humanMoved stops the analysis and ends the pondering: on a hit the search goes on as the search for the move of the engine,
+// on a miss it is thrown away. A promotion is a miss while its piece isn't picked
+func (uiState *UIState) humanMoved(m game.Move) {
+	uiState.stopAnalysis()
+	if uiState.ponderMove == nil {
+		return
+	}
+	p := uiState.ponderMove
+	if p.Start == m.Start && p.End == m.End && p.ConvertType == m.ConvertType && !uiState.gameState.IsGameEnd {
+		close(uiState.ponderHit)
+		uiState.ponderMove = nil
+		uiState.isEngineThinking = true
+		uiState.engineStop = uiState.ponderStop
+		return
+	}
+	uiState.stopPonder()
+}
+
+// startAnalysis searches the position until stopAnalysis, keeping the lines of the last depth for the analysis panel
+func (uiState *UIState) startAnalysis() {
+	uiState.searchOptions(uiState.analysisLines, engine.MaxSkill) // the analysis is at full strength
+	stop, done := make(chan struct{}), make(chan struct{})
+	uiState.analysisStop, uiState.analysisDone = stop, done
+	state := uiState.gameState.Copy()
+	go func() {
+		defer close(done)
+		engine.Think(state, state.Turn, engine.Limits{Infinite: true, Stop: stop}, func(info engine.Info) {
+			uiState.analysisMu.Lock()
+			uiState.analysisInfo = &info
+			uiState.analysisMu.Unlock()
+		})
+	}()
+}
+
+func (uiState *UIState) stopAnalysis() {
+	if uiState.analysisDone == nil {
+		return
+	}
+	close(uiState.analysisStop)
+	<-uiState.analysisDone
+	uiState.analysisStop, uiState.analysisDone = nil, nil
+	uiState.analysisInfo = nil
+}
+
+// setLevel sets the skill level of the engine from its next move, the analysis keeps full strength
+func (uiState *UIState) setLevel(level int) {
+	uiState.level = level
+}
+
+// searchOptions sets the options of the next search. The searches read the options while they run, so it is only
+// called with no search, pondering or analysis running, right before one starts
+func (uiState *UIState) searchOptions(multipv int, level int) {
+	engine.SetOption("multipv", strconv.Itoa(multipv))
+	engine.SetOption("skill level", strconv.Itoa(level))
+}
+
+// played records a move on the board, a move played after an undo replaces the line that was undone
+func (uiState *UIState) played(m game.Move) {
+	uiState.record.Play(m)
+	uiState.record.Promote()
+	if uiState.clock != nil {
+		uiState.clock.Press()
+		uiState.clocks[uiState.record.Current] = *uiState.clock
+	}
+}
+
+// engineLimits are the limits of a search for the move of player, the time left on its clock
+func (uiState *UIState) engineLimits(player game.Player) engine.Limits {
+	if uiState.clock == nil {
+		return engine.Limits{}
+	}
+	return engine.Limits{Time: uiState.clock.Left(player), Increment: uiState.clock.Increment(player), MovesToGo: uiState.clock.MovesToGo(player)}
+}
+
+// flagFall ends the game lost on time by player, drawn when the opponent can't mate
+func (uiState *UIState) flagFall(player game.Player) {
+	uiState.stopEngine()
+	opp := (player + 1) % 2
+	uiState.gameState.IsGameEnd = true
+	if uiState.gameState.InsufficientMaterial(opp) {
+		uiState.EndGame(game.Both, fmt.Sprintf("%v out of time, %v can't mate", game.PlayerToString[player], game.PlayerToString[opp]))
+		return
+	}
+	uiState.EndGame(opp, fmt.Sprintf("%v out of time", game.PlayerToString[player]))
+}
+
+// stopEngine cancels the search for the move of the engine, the pondering and the analysis
+func (uiState *UIState) stopEngine() {
+	if uiState.isEngineThinking {
+		close(uiState.engineStop)
+		<-uiState.engineCh
+		uiState.isEngineThinking = false
+	}
+	uiState.stopPonder()
+	uiState.stopAnalysis()
+}
+
+// restore sets the board to the current position of the record, with the highlights of the move that led to it
+func (uiState *UIState) restore() {
+	node := uiState.record.Current
+	*uiState.gameState = *uiState.record.State()
+	uiState.gameState.IsGameEnd = false
+	uiState.gameState.Winner = game.NilPlayer
+	uiState.selected, uiState.convertMenu = nil, nil
+	uiState.prevMoveStart, uiState.prevMoveEnd = nil, nil
+	uiState.record.Result, uiState.record.Reason = "*", ""
+	if uiState.clock != nil {
+		*uiState.clock = uiState.clocks[node]
+		uiState.clock.Start(uiState.gameState.Turn)
+	}
+	if node.Parent != nil {
+		uiState.prevMoveStart = &game.Pos{X: node.Move.Start.X, Y: node.Move.Start.Y}
+		uiState.prevMoveEnd = &game.Pos{X: node.Move.End.X, Y: node.Move.End.Y}
+	}
+	// the game ends when a king is taken or the player to move has no moves
+	state := uiState.gameState
+	for _, p := range game.Players {
+		hasKing := false
+		for i := 0; i <= 7; i++ {
+			for j := 0; j <= 7; j++ {
+				hasKing = hasKing || (state.Board[i][j] != nil && state.Board[i][j].Type == game.King && state.Board[i][j].Owner == p)
+			}
+		}
+		if !hasKing {
+			state.IsGameEnd = true
+			uiState.EndGame((p+1)%2, "king captured")
+			return
+		}
+	}
+	if len(state.GetMoves(state.Turn)) == 0 {
+		state.IsGameEnd = true
+		uiState.EndGame(game.Both, "no moves")
+	}
+}
+
+// engineWaits reports if the engine is to move against a human, undo and redo go on to the turn of the human
+func (uiState *UIState) engineWaits() bool {
+	turn := uiState.record.Current.State.Turn
+	return uiState.engines[turn] && !uiState.engines[(turn+1)%2]
+}
+
+// undo takes back the moves back to the previous turn of the human, a promotion waiting for its piece included
+func (uiState *UIState) undo() {
+	uiState.stopEngine()
+	if uiState.convertMenu == nil {
+		if !uiState.record.Back() {
+			return
+		}
+		for uiState.engineWaits() {
+			if !uiState.record.Back() {
+				break
+			}
+		}
+	}
+	uiState.restore()
+}
+
+// redo plays the undone moves again up to the next turn of the human
+func (uiState *UIState) redo() {
+	if uiState.convertMenu != nil || len(uiState.record.Current.Children) == 0 {
+		return
+	}
+	uiState.stopEngine()
+	uiState.record.Forward()
+	for uiState.engineWaits() {
+		if !uiState.record.Forward() {
+			break
+		}
+	}
+	uiState.restore()
+}
+
+// newGameMenu are the rows of the new game screen, with the level and personality of the engine selected
+func newGameMenu(level int, personality string) []menuRow {
+	levels := []string{}
+	for l := 1; l <= engine.MaxSkill; l++ {
+		levels = append(levels, strconv.Itoa(l))
+	}
+	styles := []string{}
+	style := 0
+	for i, p := range engine.Personalities {
+		styles = append(styles, p.Name)
+		if p.Name == personality {
+			style = i
+		}
+	}
+	times := []string{}
+	for _, tc := range timeControls {
+		times = append(times, tc.name)
+	}
+	return []menuRow{
+		menuSide:     {"Side", []string{"White", "Black", "Random"}, 0},
+		menuOpponent: {"Opponent", []string{"Engine", "Human", "Engine vs engine"}, 0},
+		menuLevel:    {"Level", levels, level - 1},
+		menuStyle:    {"Style", styles, style},
+		menuPosition: {"Position", []string{"Standard", "FEN from clipboard", chess960}, 0},
+		menuTime:     {"Time", times, 0},
+	}
+}
+
+// startGame sets up the game picked in the new game screen, the side picked is at the bottom of the board
+func (uiState *UIState) startGame() error {
+	pick := func(row int) string {
+		return uiState.menu[row].options[uiState.menu[row].selected]
+	}
+	fen := game.StartFEN
+	switch pick(menuPosition) {
+	case "FEN from clipboard":
+		text, err := sdl.GetClipboardText()
+		if err != nil {
+			return err
+		}
+		fen = strings.TrimSpace(text)
+	case chess960:
+		fen = game.Chess960FEN(rand.Intn(960))
+	}
+	state, err := game.NewStateFromFEN(fen)
+	if err != nil {
+		return err
+	}
+	side := game.White
+	switch pick(menuSide) {
+	case "Black":
+		side = game.Black
+	case "Random":
+		side = game.Player(rand.Intn(2))
+	}
+	uiState.stopEngine()
+	if err := engine.SetOption("personality", pick(menuStyle)); err != nil {
+		return err
+	}
+	level, _ := strconv.Atoi(pick(menuLevel))
+	uiState.setLevel(level)
+	engine.NewGame()
+	uiState.engines = [2]bool{}
+	switch pick(menuOpponent) {
+	case "Engine":
+		uiState.engines[(side+1)%2] = true
+	case "Engine vs engine":
+		uiState.engines = [2]bool{true, true}
+	}
+	*uiState.gameState = *state.Rotated(side)
+	uiState.record = game.NewGame(uiState.gameState, engine.Hash)
+	if pick(menuPosition) == chess960 {
+		uiState.record.Tags["Variant"] = chess960
+	}
+	uiState.clock = nil
+	if spec := timeControls[uiState.menu[menuTime].selected].spec; spec != "" {
+		tc, err := clock.Parse(spec)
+		if err != nil {
+			return err
+		}
+		uiState.clock = clock.New(tc, nil)
+		uiState.clocks = map[*game.Node]clock.Clock{uiState.record.Root: *uiState.clock}
+	}
+	uiState.restore()
+	uiState.showMenu, uiState.menuError = false, ""
+	return nil
+}
+
+// openMenu shows the new game screen, the game and its clock stay as they are until a new one starts
+func (uiState *UIState) openMenu() {
+	uiState.stopEngine()
+	if uiState.clock != nil {
+		uiState.clock.Stop()
+	}
+	uiState.showMenu = true
+	uiState.levelMenu = false
 }
 
-func (uiState *UIState) EndGame(winner game.Player) {
+// closeMenu goes back to the game from the new game screen
+func (uiState *UIState) closeMenu() {
+	uiState.showMenu = false
+	if uiState.clock != nil && !uiState.gameState.IsGameEnd {
+		uiState.clock.Start(uiState.gameState.Turn)
+	}
+}
+
+func (uiState *UIState) EndGame(winner game.Player, reason string) {
+	if uiState.clock != nil {
+		uiState.clock.Stop()
+	}
+	uiState.record.End(winner, reason)
 	uiState.gameState.Winner = winner
 	uiState.gameState.IsGameEnd = true
 	uiState.convertMenu = nil
@@ -76,6 +466,10 @@ func LoadFonts(renderer *sdl.Renderer) error {
 		return err
 	}
 	openSans, err = ttf.OpenFont(fmt.Sprintf("%v/%v/opensans.ttf", wd, assetsFolder), 60)
+	if err != nil {
+		return err
+	}
+	openSansSmall, err = ttf.OpenFont(fmt.Sprintf("%v/%v/opensans.ttf", wd, assetsFolder), 20)
 	return err
 }
 
@@ -95,7 +489,7 @@ func RectF(renderer *sdl.Renderer, rect *sdl.FRect, color color.RGBA) {
 }
 
 func TextF(renderer *sdl.Renderer, text string, posX float32, posY float32, font *ttf.Font, color color.RGBA, center bool) {
-	textSurf, err := openSans.RenderUTF8Solid(text, sdl.Color{R: color.R, G: color.G, B: color.B, A: color.A})
+	textSurf, err := font.RenderUTF8Solid(text, sdl.Color{R: color.R, G: color.G, B: color.B, A: color.A})
 	defer textSurf.Free()
 	if err != nil {
 		panic(err)
@@ -183,16 +577,271 @@ func RenderState(renderer *sdl.Renderer, uiState *UIState, rect *sdl.FRect) {
 			winText = fmt.Sprintf("%v won", game.PlayerToString[uiState.gameState.Winner])
 		}
 		TextF(renderer, winText, rect.X+rect.W/2, rect.Y+rect.H/2, openSans, black, true)
+		TextF(renderer, uiState.record.Reason+", N for a new game", rect.X+rect.W/2, rect.Y+rect.H/2+float32(openSans.Height()), openSansSmall, black, true)
 	}
 
+	if uiState.clock != nil { // the clock of the player at the bottom of the board is at the bottom, the running one in blue
+		for _, p := range game.Players {
+			box := &sdl.FRect{X: rect.X + rect.W - clockW - 5, Y: rect.Y + boardButtonH + 10, W: clockW, H: clockH}
+			if p == state.Starter {
+				box.Y = rect.Y + rect.H - clockH - 5
+			}
+			boxCol := grey
+			if uiState.clock.Flagged() == p {
+				boxCol = darkRed
+			} else if uiState.clock.Running() == p {
+				boxCol = darkBlue
+			}
+			RectF(renderer, box, boxCol)
+			TextF(renderer, clock.Format(uiState.clock.Left(p)), box.X+box.W/2, box.Y+box.H/2, openSansSmall, white, true)
+		}
+	}
+	TextF(renderer, fmt.Sprintf("Level %v, %v (L to change)", uiState.level, engine.GetOptions().Personality), rect.X+5, rect.Y+rect.H-float32(openSansSmall.Height())-5, openSansSmall, grey, false)
 	if uiState.isEngineThinking {
 		TextF(renderer, "Engine thinking...", 0, 0, openSans, black, false)
+	} else if uiState.ponderMove != nil {
+		TextF(renderer, "Engine pondering...", 0, 0, openSansSmall, grey, false)
+	}
+}
+
+// boardButtonRects are the new game, undo and redo buttons in the top right corner of the board
+func boardButtonRects(boardRect *sdl.FRect) (*sdl.FRect, *sdl.FRect, *sdl.FRect) {
+	redo := &sdl.FRect{X: boardRect.X + boardRect.W - boardButtonW - 5, Y: boardRect.Y + 5, W: boardButtonW, H: boardButtonH}
+	undo := &sdl.FRect{X: redo.X - boardButtonW - 5, Y: redo.Y, W: boardButtonW, H: boardButtonH}
+	newGame := &sdl.FRect{X: undo.X - boardButtonW - 5, Y: redo.Y, W: boardButtonW, H: boardButtonH}
+	return newGame, undo, redo
+}
+
+// RenderBoardButtons draws the new game, undo and redo buttons, greyed out when there is no move to take back or play again
+func RenderBoardButtons(renderer *sdl.Renderer, uiState *UIState, boardRect *sdl.FRect) {
+	newGame, undo, redo := boardButtonRects(boardRect)
+	canUndo := uiState.record.Current.Parent != nil || uiState.convertMenu != nil
+	canRedo := len(uiState.record.Current.Children) > 0 && uiState.convertMenu == nil
+	for _, button := range []struct {
+		rect    *sdl.FRect
+		text    string
+		enabled bool
+	}{{newGame, "New", true}, {undo, "Undo", canUndo}, {redo, "Redo", canRedo}} {
+		col := grey
+		if button.enabled {
+			col = darkBlue
+		}
+		RectF(renderer, button.rect, col)
+		TextF(renderer, button.text, button.rect.X+button.rect.W/2, button.rect.Y+button.rect.H/2, openSansSmall, white, true)
+	}
+}
+
+// menuLayout places the options of the new game screen in rows under the title, and the start button under them
+func menuLayout(uiState *UIState, rect *sdl.FRect) ([][]*sdl.FRect, *sdl.FRect) {
+	rows := [][]*sdl.FRect{}
+	y := rect.Y + 120
+	for _, row := range uiState.menu {
+		x, w := rect.X+menuLabelW, (rect.W-menuLabelW-20)/float32(len(row.options))
+		rects := []*sdl.FRect{}
+		for range row.options {
+			rects = append(rects, &sdl.FRect{X: x + 2, Y: y, W: w - 4, H: menuRowH - 24})
+			x += w
+		}
+		rows = append(rows, rects)
+		y += menuRowH
+	}
+	return rows, &sdl.FRect{X: rect.X + rect.W/2 - 100, Y: y + 10, W: 200, H: 50}
+}
+
+// RenderMenu draws the new game screen over rect with the selected options highlighted
+func RenderMenu(renderer *sdl.Renderer, uiState *UIState, rect *sdl.FRect) {
+	RectF(renderer, rect, lightYellow)
+	TextF(renderer, "New game", rect.X+rect.W/2, rect.Y+60, openSans, black, true)
+	rows, start := menuLayout(uiState, rect)
+	for i, row := range uiState.menu {
+		TextF(renderer, row.name, rect.X+20, rows[i][0].Y+rows[i][0].H/2, openSansSmall, black, false)
+		for j, option := range row.options {
+			col, textCol := yellow, black
+			if j == row.selected {
+				col, textCol = darkBlue, white
+			}
+			RectF(renderer, rows[i][j], col)
+			TextF(renderer, option, rows[i][j].X+rows[i][j].W/2, rows[i][j].Y+rows[i][j].H/2, openSansSmall, textCol, true)
+		}
+	}
+	RectF(renderer, start, darkBlue)
+	TextF(renderer, "Start", start.X+start.W/2, start.Y+start.H/2, openSansSmall, white, true)
+	if uiState.menuError != "" {
+		TextF(renderer, uiState.menuError, rect.X+rect.W/2, start.Y+start.H+30, openSansSmall, darkRed, true)
+	}
+	TextF(renderer, "Esc to go back to the game", rect.X+rect.W/2, rect.Y+rect.H-30, openSansSmall, grey, true)
+}
+
+// menuClick selects the option clicked on the new game screen, or starts the game
+func (uiState *UIState) menuClick(x float32, y float32, rect *sdl.FRect) {
+	rows, start := menuLayout(uiState, rect)
+	for i := range rows {
+		for j, option := range rows[i] {
+			if inRect(x, y, option) {
+				uiState.menu[i].selected = j
+				uiState.menuError = ""
+			}
+		}
+	}
+	if inRect(x, y, start) {
+		if err := uiState.startGame(); err != nil {
+			uiState.menuError = err.Error()
+		}
+	}
+}
+
+// inRect reports if the point x, y is in rect
+func inRect(x float32, y float32, rect *sdl.FRect) bool {
+	return x >= rect.X && y >= rect.Y && x <= rect.X+rect.W && y <= rect.Y+rect.H
+}
+
+// RenderAnalysis lists the lines of the running analysis, best first, with their scores for the player to move
+func RenderAnalysis(renderer *sdl.Renderer, uiState *UIState, rect *sdl.FRect) {
+	RectF(renderer, rect, lightYellow)
+	lineH := float32(openSansSmall.Height())
+	x, y := rect.X+10, rect.Y+10
+	uiState.analysisMu.Lock()
+	info := uiState.analysisInfo
+	uiState.analysisMu.Unlock()
+	if info == nil {
+		TextF(renderer, "Analysis (A to close)", x, y, openSansSmall, black, false)
+		return
+	}
+	TextF(renderer, fmt.Sprintf("Analysis, depth %v", info.Depth), x, y, openSansSmall, black, false)
+	y += lineH * 1.5
+	for i, line := range info.Lines {
+		score := fmt.Sprintf("%+.2f", engine.ScoreToPawns(line.Score))
+		if n, ok := engine.MateIn(line.Score); ok {
+			score = fmt.Sprintf("#%v", n)
+		}
+		pv := []string{}
+		for j, m := range line.PV {
+			if j == analysisPVMoves {
+				pv = append(pv, "...")
+				break
+			}
+			pv = append(pv, uiState.gameState.UCIMove(m))
+		}
+		TextF(renderer, fmt.Sprintf("%v. %v", i+1, score), x, y, openSansSmall, black, false)
+		y += lineH
+		if len(pv) > 0 {
+			TextF(renderer, strings.Join(pv, " "), x+20, y, openSansSmall, grey, false)
+		}
+		y += lineH * 1.5
+	}
+}
+
+// levelMenuRect is the level picker in the middle of the board
+func levelMenuRect(boardRect *sdl.FRect) *sdl.FRect {
+	return &sdl.FRect{X: boardRect.X + boardRect.W*0.2, Y: boardRect.Y + boardRect.H*0.25, W: boardRect.W * 0.6, H: boardRect.H * 0.5}
+}
+
+// RenderLevelMenu draws the skill levels in a grid with the current one highlighted
+func RenderLevelMenu(renderer *sdl.Renderer, uiState *UIState, rect *sdl.FRect) {
+	RectF(renderer, rect, darkBlue)
+	rows := (engine.MaxSkill + levelMenuCols - 1) / levelMenuCols
+	cellW, cellH := rect.W/float32(levelMenuCols), rect.H/float32(rows)
+	for level := 1; level <= engine.MaxSkill; level++ {
+		col, row := (level-1)%levelMenuCols, (level-1)/levelMenuCols
+		cell := &sdl.FRect{X: rect.X + cellW*float32(col) + 2, Y: rect.Y + cellH*float32(row) + 2, W: cellW - 4, H: cellH - 4}
+		cellCol := lightYellow
+		if level == uiState.level {
+			cellCol = yellow
+		}
+		RectF(renderer, cell, cellCol)
+		TextF(renderer, strconv.Itoa(level), cell.X+cell.W/2, cell.Y+cell.H/2, openSans, black, true)
 	}
 }
 
 func main() {
-	if len(os.Args) == 2 && os.Args[1] == "bench" {
-		bench.Bench()
+	threads := flag.Int("threads", engine.DefaultOptions.Threads, "number of engine search threads")
+	paramFile := flag.String("params", "", "json or toml (.toml) file with the evaluation weights")
+	bookFile := flag.String("book", "", "polyglot (.bin) book or file of opening lines, the built in lines are used when empty")
+	bookDepth := flag.Int("bookdepth", engine.DefaultOptions.BookDepth, "plies to play book moves for, 0 turns the book off")
+	syzygyPath := flag.String("syzygy", "", "directories with syzygy tablebases, separated like PATH")
+	evalFile := flag.String("nnue", "", "network weights file, evaluates with the network instead of the hand crafted evaluation")
+	analysisLines := flag.Int("multipv", 3, "number of lines shown in the analysis panel")
+	level := flag.Int("level", engine.MaxSkill, fmt.Sprintf("skill level of the engine, 1 to %v", engine.MaxSkill))
+	personalities := []string{}
+	for _, p := range engine.Personalities {
+		personalities = append(personalities, p.Name)
+	}
+	personality := flag.String("personality", engine.DefaultPersonality, "playing style of the engine: "+strings.Join(personalities, ", "))
+	flag.Parse()
+	opts := engine.GetOptions()
+	opts.Threads = *threads
+	opts.ParamFile = *paramFile
+	opts.BookFile = *bookFile
+	opts.BookDepth = *bookDepth
+	opts.SyzygyPath = *syzygyPath
+	opts.UseNNUE = *evalFile != ""
+	opts.EvalFile = *evalFile
+	opts.SkillLevel = util.Max(1, util.Min(*level, engine.MaxSkill))
+	opts.Personality = *personality
+	if err := engine.SetOptions(opts); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	engine.Init()
+	if flag.NArg() == 1 && flag.Arg(0) == "uci" {
+		if err := uci.Run(os.Stdin, os.Stdout); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+	if flag.NArg() >= 1 && flag.Arg(0) == "bench" {
+		if err := bench.Run(flag.Args()[1:]); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+	if flag.NArg() >= 1 && flag.Arg(0) == "epd" {
+		if err := epd.Run(flag.Args()[1:]); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+	if flag.NArg() >= 1 && flag.Arg(0) == "match" {
+		if err := match.Run(flag.Args()[1:]); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+	if flag.NArg() == 2 && flag.Arg(0) == "params" { // writes the weights in use, to start a new parameter file from
+		if err := engine.GetParams().Save(flag.Arg(1)); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+	if flag.NArg() >= 2 && flag.Arg(0) == "book" && flag.Arg(1) == "build" {
+		if err := book.Build(flag.Args()[2:]); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+	if flag.NArg() >= 1 && flag.Arg(0) == "tune" {
+		if err := tune.Run(flag.Args()[1:]); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+	if flag.NArg() >= 2 && flag.Arg(0) == "eval" { // the fen can be quoted or passed as separate arguments
+		state, err := game.NewStateFromFEN(strings.Join(flag.Args()[1:], " "))
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		fmt.Print(engine.EvalTrace(state))
+		if ev, name := engine.StaticEval(state); name != "classical" {
+			fmt.Printf("Score (%v): %.2f (white pov)\n", name, engine.ScoreToPawns(ev))
+		}
 		return
 	}
 	if err := sdl.Init(sdl.INIT_EVERYTHING); err != nil {
@@ -225,18 +874,18 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
-	engine.Init()
-
 	renderer.SetDrawBlendMode(sdl.BLENDMODE_BLEND)
 
-	humanPlayer := game.White
-	state := game.NewStartState(humanPlayer)
-	uiState := &UIState{state, nil, nil, nil, nil, false}
+	state := game.NewStartState(game.White)
+	uiState := &UIState{gameState: state, record: game.NewGame(state, engine.Hash), menu: newGameMenu(opts.SkillLevel, opts.Personality), showMenu: true,
+		analysisLines: util.Max(1, util.Min(*analysisLines, engine.MaxMultiPV)), engineCh: make(chan engineResult, 1), level: opts.SkillLevel}
 	running := true
-	engineCh := make(chan *game.Move, 1)
 	for running {
 		Clear(renderer, white)
 		w, h := window.GetSize()
+		if uiState.analysis { // the panel takes the right of the window
+			w -= int32(analysisPanelW)
+		}
 		boardRect := &sdl.FRect{}
 		if w < h {
 			boardRect.X = 0
@@ -248,13 +897,84 @@ func main() {
 		boardRect.W = float32(util.Min(int(w), int(h)))
 		boardRect.H = float32(util.Min(int(w), int(h)))
 		RenderState(renderer, uiState, boardRect)
+		RenderBoardButtons(renderer, uiState, boardRect)
+		if uiState.levelMenu {
+			RenderLevelMenu(renderer, uiState, levelMenuRect(boardRect))
+		}
+		if uiState.analysis {
+			RenderAnalysis(renderer, uiState, &sdl.FRect{X: float32(w), Y: 0, W: analysisPanelW, H: float32(h)})
+		}
+		menuRect := &sdl.FRect{W: float32(w), H: float32(h)}
+		if uiState.showMenu {
+			RenderMenu(renderer, uiState, menuRect)
+		}
 		renderer.Present()
 	eventLoop:
 		for event := sdl.PollEvent(); event != nil; event = sdl.PollEvent() {
+			if uiState.showMenu { // the screen takes the clicks and keys while open
+				switch e := event.(type) {
+				case *sdl.QuitEvent:
+					running = false
+				case *sdl.KeyboardEvent:
+					if e.Type == sdl.KEYDOWN && e.Keysym.Sym == sdl.K_ESCAPE {
+						uiState.closeMenu()
+					}
+				case *sdl.MouseButtonEvent:
+					if e.Button == sdl.BUTTON_LEFT && e.Type == sdl.MOUSEBUTTONDOWN {
+						uiState.menuClick(float32(e.X), float32(e.Y), menuRect)
+					}
+				}
+				continue
+			}
 			switch e := event.(type) {
 			case *sdl.QuitEvent:
 				running = false
+			case *sdl.KeyboardEvent:
+				if e.Type == sdl.KEYDOWN && e.Keysym.Sym == sdl.K_a {
+					uiState.analysis = !uiState.analysis
+					if !uiState.analysis {
+						uiState.stopAnalysis()
+					}
+				} else if e.Type == sdl.KEYDOWN && e.Keysym.Sym == sdl.K_p {
+					uiState.ponder = !uiState.ponder
+					if !uiState.ponder {
+						uiState.stopPonder()
+					}
+				} else if e.Type == sdl.KEYDOWN && e.Keysym.Sym == sdl.K_n {
+					uiState.openMenu()
+				} else if e.Type == sdl.KEYDOWN && e.Keysym.Sym == sdl.K_l {
+					uiState.levelMenu = !uiState.levelMenu
+				} else if e.Type == sdl.KEYDOWN && (e.Keysym.Sym == sdl.K_LEFT || (e.Keysym.Sym == sdl.K_z && e.Keysym.Mod&sdl.KMOD_CTRL != 0)) {
+					uiState.undo()
+				} else if e.Type == sdl.KEYDOWN && (e.Keysym.Sym == sdl.K_RIGHT || (e.Keysym.Sym == sdl.K_y && e.Keysym.Mod&sdl.KMOD_CTRL != 0)) {
+					uiState.redo()
+				}
 			case *sdl.MouseButtonEvent:
+				if uiState.levelMenu { // the picker takes the clicks while open
+					if e.Button == sdl.BUTTON_LEFT && e.Type == sdl.MOUSEBUTTONDOWN {
+						menu := levelMenuRect(boardRect)
+						rows := (engine.MaxSkill + levelMenuCols - 1) / levelMenuCols
+						col, row := int((float32(e.X)-menu.X)/(menu.W/float32(levelMenuCols))), int((float32(e.Y)-menu.Y)/(menu.H/float32(rows)))
+						if float32(e.X) >= menu.X && float32(e.Y) >= menu.Y && col < levelMenuCols && row < rows && row*levelMenuCols+col < engine.MaxSkill {
+							uiState.setLevel(row*levelMenuCols + col + 1)
+						}
+						uiState.levelMenu = false
+					}
+					break
+				}
+				if e.Button == sdl.BUTTON_LEFT && e.Type == sdl.MOUSEBUTTONDOWN {
+					newGame, undo, redo := boardButtonRects(boardRect)
+					if inRect(float32(e.X), float32(e.Y), newGame) {
+						uiState.openMenu()
+						break
+					} else if inRect(float32(e.X), float32(e.Y), undo) {
+						uiState.undo()
+						break
+					} else if inRect(float32(e.X), float32(e.Y), redo) {
+						uiState.redo()
+						break
+					}
+				}
 				if state.IsGameEnd {
 					break eventLoop
 				}
@@ -264,8 +984,8 @@ func main() {
 					if mX >= boardRect.X && mY >= boardRect.Y && mX <= boardRect.X+boardRect.W && mY <= boardRect.Y+boardRect.H {
 						relX, relY := mX-boardRect.X, mY-boardRect.Y
 						sqW, sqH := boardRect.W/8.0, boardRect.H/8.0
-						sqC, sqR := util.Min(int(relX/sqH), 7), util.Min(int(relY/sqW), 7)                                                           //col, row C is X, R is Y
-						if uiState.convertMenu != nil && uiState.convertMenu.X == sqR && uiState.convertMenu.Y == sqC && state.Turn == humanPlayer { // convert menu
+						sqC, sqR := util.Min(int(relX/sqH), 7), util.Min(int(relY/sqW), 7)                                                              //col, row C is X, R is Y
+						if uiState.convertMenu != nil && uiState.convertMenu.X == sqR && uiState.convertMenu.Y == sqC && !uiState.engines[state.Turn] { // convert menu
 							menuX, menuY := int((relX-sqW*float32(sqC))/(sqW/2.0)), int((relY-sqH*float32(sqR))/(sqH/2.0))
 							if menuX < 0 || menuY < 0 || menuX >= 2 || menuY >= 2 {
 								break
@@ -279,19 +999,22 @@ func main() {
 							} else {
 								state.Board[uiState.convertMenu.X][uiState.convertMenu.Y].Type = game.Rook
 							}
+							uiState.convertMove.ConvertType = state.Board[uiState.convertMenu.X][uiState.convertMenu.Y].Type
+							uiState.played(uiState.convertMove)
 							state.Turn = (state.Turn + 1) % 2
 							uiState.convertMenu = nil
+							uiState.stopAnalysis()
 							break
 						}
 
 						//selecting own piece
-						if state.Board[sqR][sqC] != nil && state.Board[sqR][sqC].Owner == state.Turn && state.Turn == humanPlayer {
+						if state.Board[sqR][sqC] != nil && state.Board[sqR][sqC].Owner == state.Turn && !uiState.engines[state.Turn] {
 							if uiState.selected != nil && uiState.selected.X == sqR && uiState.selected.Y == sqC {
 								uiState.selected = nil
 							} else {
 								uiState.selected = &game.Pos{X: sqR, Y: sqC}
 							}
-						} else if uiState.selected != nil && state.Turn == humanPlayer { //selecting place to move
+						} else if uiState.selected != nil && !uiState.engines[state.Turn] { //selecting place to move
 							moves := state.GetMoves(state.Turn)
 							for _, m := range moves {
 								if m.Start.X == uiState.selected.X && m.Start.Y == uiState.selected.Y && m.End.X == sqR && m.End.Y == sqC {
@@ -299,14 +1022,17 @@ func main() {
 									uiState.prevMoveStart = &game.Pos{X: m.Start.X, Y: m.Start.Y}
 									uiState.prevMoveEnd = &game.Pos{X: m.End.X, Y: m.End.Y}
 									if state.IsGameEnd {
-										uiState.EndGame(state.Turn)
+										uiState.EndGame(state.Turn, "king captured")
 									}
 									if len(state.GetMoves(state.Turn)) == 0 {
-										uiState.EndGame(game.Both)
+										uiState.EndGame(game.Both, "no moves")
 									}
+									uiState.humanMoved(m)
 									if m.IsConversion && m.ConvertType == game.NilPiece {
 										uiState.convertMenu = &game.Pos{X: m.End.X, Y: m.End.Y}
+										uiState.convertMove = m
 									} else {
+										uiState.played(m)
 										state.Turn = (state.Turn + 1) % 2
 									}
 									uiState.selected = nil
@@ -319,25 +1045,46 @@ func main() {
 			}
 		}
 		//end event loop
-		if !state.IsGameEnd && state.Turn != humanPlayer && !uiState.isEngineThinking { //engine move
+		if uiState.clock != nil && !state.IsGameEnd && !uiState.showMenu {
+			if flagged := uiState.clock.Flagged(); flagged != game.NilPlayer {
+				uiState.flagFall(flagged)
+			}
+		}
+		if uiState.analysis && uiState.analysisDone == nil && uiState.ponderMove == nil && !state.IsGameEnd && !uiState.engines[state.Turn] && uiState.convertMenu == nil && !uiState.showMenu {
+			uiState.startAnalysis()
+		}
+		if !state.IsGameEnd && uiState.engines[state.Turn] && !uiState.isEngineThinking && !uiState.showMenu { //engine move
 			copiedState, _ := deepcopy.Anything(state)
-			go engine.GetBestMove(copiedState.(*game.State), state.Turn, engineCh)
+			stop := make(chan struct{})
+			limits := uiState.engineLimits(state.Turn)
+			limits.Stop = stop
+			uiState.searchOptions(1, uiState.level)
+			go func(state *game.State) {
+				m, ponder := engine.Play(state, state.Turn, limits)
+				uiState.engineCh <- engineResult{m, ponder}
+			}(copiedState.(*game.State))
 			uiState.isEngineThinking = true
+			uiState.engineStop = stop
 		}
-		if len(engineCh) > 0 {
+		if uiState.ponderMove == nil && len(uiState.engineCh) > 0 {
 			uiState.isEngineThinking = false
-			m := <-engineCh
+			result := <-uiState.engineCh
+			m := result.move
 			if m == nil {
-				uiState.EndGame(game.Both)
+				uiState.EndGame(game.Both, "no moves")
 			} else {
+				uiState.played(*m)
 				state.IsGameEnd = state.RunMove(*m)
 				if state.IsGameEnd {
-					uiState.EndGame(state.Turn)
+					uiState.EndGame(state.Turn, "king captured")
 				}
 
 				uiState.prevMoveStart = &game.Pos{X: m.Start.X, Y: m.Start.Y}
 				uiState.prevMoveEnd = &game.Pos{X: m.End.X, Y: m.End.Y}
 				state.Turn = (state.Turn + 1) % 2
+				if uiState.ponder && result.ponder != nil && !state.IsGameEnd && !uiState.engines[state.Turn] {
+					uiState.startPonder(*result.ponder)
+				}
 			}
 		}
 	}
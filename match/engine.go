@@ -0,0 +1,242 @@
+package match
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// mateScore is the score of a mate in the uci info lines, in centipawns
+const mateScore int = 100000
+
+var errTimeout error = errors.New("engine timed out")
+
+// engineConfig is an engine of the match: a uci binary, by default this one in uci mode, and the options it is set up with
+type engineConfig struct {
+	name    string
+	cmd     []string
+	options [][2]string // name and value, in the order given
+}
+
+// parseEngineConfig reads a spec like "name=tuned,ParamFile=tuned.json,Hash=64": cmd is the command line of the engine,
+// name the name in the pgn and any other key is a uci option
+func parseEngineConfig(spec string, defaultName string) (*engineConfig, error) {
+	self, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	c := &engineConfig{name: defaultName, cmd: []string{self, "uci"}}
+	for _, field := range strings.Split(spec, ",") {
+		if strings.TrimSpace(field) == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid engine spec %q: %q is not key=value", spec, field)
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		switch key {
+		case "name":
+			c.name = value
+		case "cmd":
+			c.cmd = strings.Fields(value)
+			if len(c.cmd) == 0 {
+				return nil, fmt.Errorf("invalid engine spec %q: empty cmd", spec)
+			}
+		default:
+			c.options = append(c.options, [2]string{key, value})
+		}
+	}
+	return c, nil
+}
+
+// uciEngine is a running engine process, talked to over uci
+type uciEngine struct {
+	config *engineConfig
+	cmd    *exec.Cmd
+	in     io.WriteCloser
+	lines  chan string // closed when the engine exits
+}
+
+func startEngine(config *engineConfig) (*uciEngine, error) {
+	cmd := exec.Command(config.cmd[0], config.cmd[1:]...)
+	in, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("%v: %v", config.name, err)
+	}
+	e := &uciEngine{config: config, cmd: cmd, in: in, lines: make(chan string, 64)}
+	go func() {
+		scanner := bufio.NewScanner(out)
+		for scanner.Scan() {
+			e.lines <- strings.TrimSpace(scanner.Text())
+		}
+		close(e.lines)
+	}()
+	e.send("uci")
+	if _, err := e.waitFor("uciok", 10*time.Second); err != nil {
+		e.quit()
+		return nil, fmt.Errorf("%v: %v", config.name, err)
+	}
+	for _, option := range config.options {
+		e.send("setoption name %v value %v", option[0], option[1])
+	}
+	if err := e.isReady(); err != nil {
+		e.quit()
+		return nil, fmt.Errorf("%v: %v", config.name, err)
+	}
+	return e, nil
+}
+
+func (e *uciEngine) send(format string, args ...any) {
+	fmt.Fprintf(e.in, format+"\n", args...)
+}
+
+// waitFor reads lines until one starts with prefix and returns it
+func (e *uciEngine) waitFor(prefix string, timeout time.Duration) (string, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case line, ok := <-e.lines:
+			if !ok {
+				return "", errors.New("engine exited")
+			}
+			if line == prefix || strings.HasPrefix(line, prefix+" ") {
+				return line, nil
+			}
+		case <-timer.C:
+			return "", errTimeout
+		}
+	}
+}
+
+func (e *uciEngine) isReady() error {
+	e.send("isready")
+	_, err := e.waitFor("readyok", 30*time.Second)
+	return err
+}
+
+func (e *uciEngine) newGame() error {
+	e.send("ucinewgame")
+	return e.isReady()
+}
+
+// searchResult is the answer of the engine to a go command, the score is from its own pov and of the last info line
+type searchResult struct {
+	move  string
+	score int
+	depth int
+	took  time.Duration
+}
+
+// think sends the position and the go command and waits for the best move, at most timeout when it isn't zero
+func (e *uciEngine) think(fen string, moves []string, goArgs string, timeout time.Duration) (searchResult, error) {
+	position := "position fen " + fen
+	if len(moves) > 0 {
+		position += " moves " + strings.Join(moves, " ")
+	}
+	e.send(position)
+	e.send("go " + goArgs)
+	start := time.Now()
+	var timer <-chan time.Time
+	if timeout > 0 {
+		t := time.NewTimer(timeout)
+		defer t.Stop()
+		timer = t.C
+	}
+	result := searchResult{}
+	for {
+		select {
+		case line, ok := <-e.lines:
+			if !ok {
+				return result, errors.New("engine exited")
+			}
+			fields := strings.Fields(line)
+			if len(fields) == 0 {
+				continue
+			}
+			switch fields[0] {
+			case "info":
+				parseInfo(fields[1:], &result)
+			case "bestmove":
+				result.took = time.Since(start)
+				if len(fields) < 2 {
+					return result, errors.New("bestmove without a move")
+				}
+				result.move = fields[1]
+				return result, nil
+			}
+		case <-timer:
+			result.took = time.Since(start)
+			return result, errTimeout
+		}
+	}
+}
+
+// parseInfo keeps the depth and the score of an info line, the score of the first line when there are several
+func parseInfo(fields []string, result *searchResult) {
+	multipv := 1
+	depth, score, hasScore := 0, 0, false
+	for i := 0; i+1 < len(fields); i++ {
+		switch fields[i] {
+		case "depth":
+			depth, _ = strconv.Atoi(fields[i+1])
+		case "multipv":
+			multipv, _ = strconv.Atoi(fields[i+1])
+		case "score":
+			if i+2 >= len(fields) {
+				continue
+			}
+			n, err := strconv.Atoi(fields[i+2])
+			if err != nil {
+				continue
+			}
+			switch fields[i+1] {
+			case "cp":
+				score, hasScore = n, true
+			case "mate":
+				score, hasScore = mateScore-n, true
+				if n < 0 {
+					score = -mateScore - n
+				}
+			}
+		case "pv":
+			i = len(fields)
+		}
+	}
+	if multipv == 1 && hasScore {
+		result.depth, result.score = depth, score
+	}
+}
+
+// quit asks the engine to exit and kills it if it doesn't, the output left is thrown away
+func (e *uciEngine) quit() {
+	e.send("quit")
+	go func() {
+		for range e.lines {
+		}
+	}()
+	done := make(chan error, 1)
+	go func() {
+		done <- e.cmd.Wait()
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		e.cmd.Process.Kill()
+		<-done
+	}
+}
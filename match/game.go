@@ -0,0 +1,238 @@
+package match
+
+import (
+	"chess/game"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// PGN termination tags
+const (
+	terminationNormal      string = "normal"
+	terminationAdjudicated string = "adjudication"
+	terminationTime        string = "time forfeit"
+	terminationInfraction  string = "rules infraction"
+)
+
+// opening is where a game starts: a position and moves played from it
+type opening struct {
+	fen     string // without castling rights, the engine can't castle so no engine in the match may
+	fromFEN bool   // the position isn't the start position, the pgn needs a FEN tag
+	moves   []game.Move
+}
+
+// playedGame is a finished game, the results are from the pov of white
+type playedGame struct {
+	number      int // from 1, in the order the games were started
+	white       string
+	black       string
+	fen         string
+	fromFEN     bool
+	san         []string
+	bookPlies   int // the first plies are from the opening
+	result      string
+	reason      string
+	termination string
+	date        time.Time
+}
+
+// engine1Score is the score of the first engine of the match in the game
+func (g *playedGame) engine1Score(engine1White bool) float64 {
+	score := map[string]float64{"1-0": 1, "0-1": 0, "1/2-1/2": 0.5}[g.result]
+	if !engine1White {
+		score = 1 - score
+	}
+	return score
+}
+
+// position is the part of the fen that has to match for a repetition
+func position(state *game.State) string {
+	return strings.Join(strings.Fields(state.FEN())[:4], " ")
+}
+
+// insufficientMaterial is a king against a king with at most one minor piece
+func insufficientMaterial(state *game.State) bool {
+	minors := 0
+	for i := 0; i <= 7; i++ {
+		for j := 0; j <= 7; j++ {
+			piece := state.Board[i][j]
+			if piece == nil || piece.Type == game.King {
+				continue
+			}
+			if piece.Type != game.Bishop && piece.Type != game.Knight {
+				return false
+			}
+			minors++
+		}
+	}
+	return minors <= 1
+}
+
+// clock is the time left of a player under a time control, with the moves left until the next control
+type clock struct {
+	left      time.Duration
+	movesLeft int
+}
+
+// goArgs is the go command of player to move
+func (m *match) goArgs(clocks [2]*clock, player game.Player) string {
+	tc := m.tc
+	if tc.moveTime > 0 {
+		return fmt.Sprintf("movetime %v", tc.moveTime.Milliseconds())
+	}
+	args := []string{}
+	if tc.base > 0 {
+		args = append(args, fmt.Sprintf("wtime %v btime %v winc %v binc %v", clocks[game.White].left.Milliseconds(), clocks[game.Black].left.Milliseconds(),
+			tc.inc.Milliseconds(), tc.inc.Milliseconds()))
+		if tc.moves > 0 {
+			args = append(args, fmt.Sprintf("movestogo %v", clocks[player].movesLeft))
+		}
+	}
+	if tc.depth > 0 {
+		args = append(args, fmt.Sprintf("depth %v", tc.depth))
+	}
+	if tc.nodes > 0 {
+		args = append(args, fmt.Sprintf("nodes %v", tc.nodes))
+	}
+	return strings.Join(args, " ")
+}
+
+// play plays a game between white and black from op, an error is returned only when an engine can't be started
+func (m *match) play(number int, white *engineConfig, black *engineConfig, op opening) (*playedGame, error) {
+	g := &playedGame{number: number, white: white.name, black: black.name, fen: op.fen, fromFEN: op.fromFEN, date: time.Now()}
+	engines := [2]*uciEngine{}
+	for p, config := range []*engineConfig{white, black} {
+		e, err := startEngine(config)
+		if err != nil {
+			for _, started := range engines {
+				if started != nil {
+					started.quit()
+				}
+			}
+			return nil, err
+		}
+		defer e.quit()
+		if err := e.newGame(); err != nil {
+			return nil, fmt.Errorf("%v: %v", config.name, err)
+		}
+		engines[p] = e
+	}
+
+	state, err := game.NewStateFromFEN(op.fen)
+	if err != nil {
+		return nil, err
+	}
+	player := state.Turn
+	positions := map[string]int{position(state): 1}
+	halfMoves := 0 // since the last capture or pawn move
+	uciMoves := []string{}
+	run := func(mv game.Move) {
+		piece := state.Board[mv.Start.X][mv.Start.Y]
+		if mv.Capture != nil || piece.Type == game.Pawn {
+			halfMoves = 0
+		} else {
+			halfMoves++
+		}
+		g.san = append(g.san, state.SAN(mv, player))
+		uciMoves = append(uciMoves, state.UCIMove(mv))
+		state.RunMove(mv)
+		player = (player + 1) % 2
+		state.Turn = player
+		positions[position(state)]++
+	}
+	for _, mv := range op.moves {
+		run(mv)
+	}
+	g.bookPlies = len(op.moves)
+
+	end := func(winner game.Player, termination string, format string, args ...any) *playedGame {
+		g.result = "1/2-1/2"
+		if winner == game.White {
+			g.result = "1-0"
+		} else if winner == game.Black {
+			g.result = "0-1"
+		}
+		g.termination, g.reason = termination, fmt.Sprintf(format, args...)
+		return g
+	}
+	clocks := [2]*clock{{m.tc.base, m.tc.moves}, {m.tc.base, m.tc.moves}}
+	resignCounts := [2]int{}
+	drawCount := 0
+	for {
+		name := game.PlayerToString[player]
+		opp := (player + 1) % 2
+		if len(state.LegalMoves(player)) == 0 {
+			if state.InCheck(player) {
+				return end(opp, terminationNormal, "%v mates", game.PlayerToString[opp]), nil
+			}
+			return end(game.Both, terminationNormal, "stalemate"), nil
+		}
+		if halfMoves >= 100 {
+			return end(game.Both, terminationNormal, "fifty move rule"), nil
+		}
+		if positions[position(state)] >= 3 {
+			return end(game.Both, terminationNormal, "threefold repetition"), nil
+		}
+		if insufficientMaterial(state) {
+			return end(game.Both, terminationNormal, "insufficient material"), nil
+		}
+		if m.maxMoves > 0 && state.Ply/2 >= m.maxMoves {
+			return end(game.Both, terminationAdjudicated, "draw by the move limit"), nil
+		}
+
+		var timeout time.Duration
+		if m.tc.base > 0 {
+			timeout = clocks[player].left + m.timeMargin
+		}
+		result, err := engines[player].think(op.fen, uciMoves, m.goArgs(clocks, player), timeout)
+		if errors.Is(err, errTimeout) {
+			return end(opp, terminationTime, "%v loses on time", name), nil
+		} else if err != nil {
+			return end(opp, terminationInfraction, "%v engine error: %v", name, err), nil
+		}
+		if m.tc.base > 0 {
+			c := clocks[player]
+			if result.took > c.left+m.timeMargin {
+				return end(opp, terminationTime, "%v loses on time", name), nil
+			}
+			c.left -= result.took
+			if c.left < 0 {
+				c.left = 0
+			}
+			c.left += m.tc.inc
+			if m.tc.moves > 0 {
+				c.movesLeft--
+				if c.movesLeft == 0 {
+					c.left += m.tc.base
+					c.movesLeft = m.tc.moves
+				}
+			}
+		}
+		mv, err := state.ParseUCIMove(result.move, player)
+		if err != nil || state.LeavesKingAttacked(mv, player) {
+			return end(opp, terminationInfraction, "%v makes an illegal move: %v", name, result.move), nil
+		}
+		moved := player
+		run(mv)
+
+		// adjudication by the scores the engines report, from the pov of the engine that moved
+		if m.resignMoves > 0 && result.score <= -m.resignScore {
+			resignCounts[moved]++
+		} else {
+			resignCounts[moved] = 0
+		}
+		if m.resignMoves > 0 && resignCounts[moved] >= m.resignMoves {
+			return end(opp, terminationAdjudicated, "%v resigns", name), nil
+		}
+		if m.drawMoves > 0 && state.Ply/2+1 >= m.drawMoveNumber && result.score >= -m.drawScore && result.score <= m.drawScore {
+			drawCount++
+		} else {
+			drawCount = 0
+		}
+		if m.drawMoves > 0 && drawCount >= 2*m.drawMoves {
+			return end(game.Both, terminationAdjudicated, "draw by adjudication"), nil
+		}
+	}
+}
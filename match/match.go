@@ -0,0 +1,394 @@
+package match
+
+import (
+	"bufio"
+	"chess/engine"
+	"chess/game"
+	"chess/util"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// timeControl is a clock of base time for moves moves (the whole game when 0) with an increment, or a fixed time,
+// depth or number of nodes a move
+type timeControl struct {
+	moves    int
+	base     time.Duration
+	inc      time.Duration
+	moveTime time.Duration
+	depth    int
+	nodes    int
+}
+
+// parseTimeControl reads "moves/seconds+increment" like "40/60", "10+0.1" or "60"
+func parseTimeControl(s string) (timeControl, error) {
+	tc := timeControl{}
+	if s == "" {
+		return tc, nil
+	}
+	rest := s
+	if moves, after, ok := strings.Cut(rest, "/"); ok {
+		n, err := strconv.Atoi(moves)
+		if err != nil || n < 1 {
+			return tc, fmt.Errorf("invalid time control %q", s)
+		}
+		tc.moves, rest = n, after
+	}
+	base, inc, hasInc := strings.Cut(rest, "+")
+	seconds, err := strconv.ParseFloat(base, 64)
+	if err != nil || seconds <= 0 {
+		return tc, fmt.Errorf("invalid time control %q", s)
+	}
+	tc.base = time.Duration(seconds * float64(time.Second))
+	if hasInc {
+		seconds, err := strconv.ParseFloat(inc, 64)
+		if err != nil || seconds < 0 {
+			return tc, fmt.Errorf("invalid time control %q", s)
+		}
+		tc.inc = time.Duration(seconds * float64(time.Second))
+	}
+	return tc, nil
+}
+
+// String is the time control as in the TimeControl tag of a pgn
+func (tc timeControl) String() string {
+	if tc.moveTime > 0 {
+		return fmt.Sprintf("%v/move", tc.moveTime.Seconds())
+	}
+	if tc.base == 0 {
+		return "-"
+	}
+	s := fmt.Sprint(tc.base.Seconds())
+	if tc.moves > 0 {
+		s = fmt.Sprintf("%v/%v", tc.moves, s)
+	}
+	if tc.inc > 0 {
+		s += fmt.Sprintf("+%v", tc.inc.Seconds())
+	}
+	return s
+}
+
+type match struct {
+	engines        [2]*engineConfig
+	tc             timeControl
+	timeMargin     time.Duration // an engine loses on time when it goes over its clock by more than this
+	maxMoves       int
+	drawMoveNumber int
+	drawMoves      int
+	drawScore      int
+	resignMoves    int
+	resignScore    int
+}
+
+// loadOpenings reads a pgn file (.pgn) or a file with a fen or a line of moves in SAN from the start position on every line,
+// up to maxPlies plies of every opening. Without a path they are the lines of the built in book. Lines seen before are skipped
+func loadOpenings(path string, maxPlies int) ([]opening, error) {
+	var lines []string
+	var pgns []*game.PGN
+	if path == "" {
+		lines = engine.OpeningLines()
+	} else if strings.HasSuffix(path, ".pgn") {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		reader := game.NewPGNReader(file)
+		for {
+			pgn, err := reader.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("%v: %v", path, err)
+			}
+			pgns = append(pgns, pgn)
+		}
+	} else {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			lines = append(lines, scanner.Text())
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		pgn := &game.PGN{Tags: map[string]string{}}
+		if fields := strings.Fields(line); len(fields) >= 4 && strings.Count(fields[0], "/") == 7 {
+			pgn.Tags["FEN"] = strings.Join(fields[:util.Min(len(fields), 6)], " ") // without the operations of an epd
+		} else {
+			for _, token := range fields {
+				if san := strings.TrimLeft(token, "0123456789."); san != "" {
+					pgn.Moves = append(pgn.Moves, san)
+				}
+			}
+		}
+		pgns = append(pgns, pgn)
+	}
+
+	openings := []opening{}
+	seen := map[string]bool{}
+	for _, pgn := range pgns {
+		state, err := pgn.StartState()
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range game.Players {
+			state.CanCastleLong[p] = false
+			state.CanCastleShort[p] = false
+		}
+		_, fromFEN := pgn.Tags["FEN"]
+		op := opening{fen: state.FEN(), fromFEN: fromFEN}
+		player := state.Turn
+		for _, san := range pgn.Moves {
+			if maxPlies > 0 && len(op.moves) >= maxPlies {
+				break
+			}
+			m, err := state.ParseSAN(san, player)
+			if err != nil { // castling or a note, the opening ends here
+				break
+			}
+			op.moves = append(op.moves, m)
+			state.RunMove(m)
+			player = (player + 1) % 2
+			state.Turn = player
+		}
+		key := state.FEN()
+		if !seen[key] {
+			seen[key] = true
+			openings = append(openings, op)
+		}
+	}
+	if len(openings) == 0 {
+		return nil, errors.New("no openings")
+	}
+	return openings, nil
+}
+
+// writePGN writes g with the opening moves marked and the reason the game ended in a comment
+func writePGN(w io.Writer, g *playedGame, event string, tc timeControl) error {
+	var sb strings.Builder
+	tags := [][2]string{{"Event", event}, {"Site", "?"}, {"Date", g.date.Format("2006.01.02")}, {"Round", strconv.Itoa(g.number)},
+		{"White", g.white}, {"Black", g.black}, {"Result", g.result}}
+	if g.fromFEN {
+		tags = append(tags, [2]string{"FEN", g.fen}, [2]string{"SetUp", "1"})
+	}
+	tags = append(tags, [2]string{"PlyCount", strconv.Itoa(len(g.san))}, [2]string{"TimeControl", tc.String()}, [2]string{"Termination", g.termination})
+	for _, tag := range tags {
+		fmt.Fprintf(&sb, "[%v \"%v\"]\n", tag[0], strings.ReplaceAll(tag[1], `"`, `\"`))
+	}
+	sb.WriteByte('\n')
+
+	state, err := game.NewStateFromFEN(g.fen)
+	if err != nil {
+		return err
+	}
+	ply := state.Ply
+	tokens := []string{}
+	for i, san := range g.san {
+		if ply%2 == 0 {
+			tokens = append(tokens, fmt.Sprintf("%v.", ply/2+1))
+		} else if i == 0 {
+			tokens = append(tokens, fmt.Sprintf("%v...", ply/2+1))
+		}
+		tokens = append(tokens, san)
+		if i == g.bookPlies-1 {
+			tokens = append(tokens, "{book}")
+		}
+		ply++
+	}
+	tokens = append(tokens, fmt.Sprintf("{%v}", g.reason), g.result)
+	lineLen := 0
+	for i, token := range tokens {
+		if i > 0 && lineLen+1+len(token) > 80 {
+			sb.WriteByte('\n')
+			lineLen = 0
+		} else if i > 0 {
+			sb.WriteByte(' ')
+			lineLen++
+		}
+		sb.WriteString(token)
+		lineLen += len(token)
+	}
+	sb.WriteString("\n\n")
+	_, err = io.WriteString(w, sb.String())
+	return err
+}
+
+// Run is the match command: chess match [flags]
+func Run(args []string) error {
+	flags := flag.NewFlagSet("match", flag.ContinueOnError)
+	engine1 := flags.String("engine1", "", `first engine, like "name=new,ParamFile=tuned.json": cmd is the command line of a uci engine, this one by default, name its name and the other keys uci options`)
+	engine2 := flags.String("engine2", "", "second engine, like engine1")
+	games := flags.Int("games", 100, "number of games, every opening is played twice with the colors swapped")
+	openingsFile := flags.String("openings", "", "pgn file (.pgn) or file of fens or lines of moves, the built in book lines when empty")
+	plies := flags.Int("plies", 0, "maximum number of plies of every opening, 0 for all")
+	tcFlag := flags.String("tc", "10+0.1", "time control in seconds, moves/time+increment like 40/60 or 10+0.1")
+	moveTime := flags.Float64("st", 0, "fixed time a move in seconds, instead of the time control")
+	depth := flags.Int("depth", 0, "fixed depth a move")
+	nodes := flags.Int("nodes", 0, "fixed number of nodes a move")
+	timeMargin := flags.Int("timemargin", 100, "milliseconds an engine can go over its time before losing on time")
+	concurrency := flags.Int("concurrency", 1, "number of games played at the same time")
+	pgnFile := flags.String("pgn", "", "file to write the games to")
+	event := flags.String("event", "Engine match", "event of the games in the pgn")
+	maxMoves := flags.Int("maxmoves", 0, "adjudicate a draw after this many moves, 0 for no limit")
+	drawMoveNumber := flags.Int("draw-movenumber", 40, "first move of the draw adjudication")
+	drawMoves := flags.Int("draw-movecount", 8, "adjudicate a draw when both engines score the position within draw-score for this many moves, 0 turns it off")
+	drawScore := flags.Int("draw-score", 10, "score of the draw adjudication in centipawns")
+	resignMoves := flags.Int("resign-movecount", 3, "adjudicate a loss when an engine scores its position below -resign-score for this many moves, 0 turns it off")
+	resignScore := flags.Int("resign-score", 900, "score of the resign adjudication in centipawns")
+	useSPRT := flags.Bool("sprt", false, "stop the match once a sequential probability ratio test of elo0 against elo1 decides, games is then the most games to play")
+	elo0 := flags.Float64("elo0", 0, "elo difference of the null hypothesis of the sprt")
+	elo1 := flags.Float64("elo1", 5, "elo difference of the alternative hypothesis of the sprt")
+	alpha := flags.Float64("alpha", 0.05, "false positive rate of the sprt")
+	beta := flags.Float64("beta", 0.05, "false negative rate of the sprt")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 0 {
+		return errors.New("usage: chess match [flags]")
+	}
+
+	m := &match{timeMargin: time.Duration(*timeMargin) * time.Millisecond, maxMoves: *maxMoves, drawMoveNumber: *drawMoveNumber,
+		drawMoves: *drawMoves, drawScore: *drawScore, resignMoves: *resignMoves, resignScore: *resignScore}
+	var err error
+	for i, spec := range []string{*engine1, *engine2} {
+		if m.engines[i], err = parseEngineConfig(spec, fmt.Sprintf("engine%v", i+1)); err != nil {
+			return err
+		}
+	}
+	if m.engines[0].name == m.engines[1].name {
+		return fmt.Errorf("both engines are named %v", m.engines[0].name)
+	}
+	if *moveTime > 0 || *depth > 0 || *nodes > 0 {
+		*tcFlag = ""
+	}
+	if m.tc, err = parseTimeControl(*tcFlag); err != nil {
+		return err
+	}
+	m.tc.moveTime = time.Duration(*moveTime * float64(time.Second))
+	m.tc.depth, m.tc.nodes = *depth, *nodes
+	var test *sprt
+	if *useSPRT {
+		if *elo0 >= *elo1 || *alpha <= 0 || *alpha >= 1 || *beta <= 0 || *beta >= 1 {
+			return errors.New("the sprt needs elo0 < elo1 and alpha and beta between 0 and 1")
+		}
+		test = &sprt{*elo0, *elo1, *alpha, *beta}
+	}
+	openings, err := loadOpenings(*openingsFile, *plies)
+	if err != nil {
+		return err
+	}
+	var pgn *os.File
+	if *pgnFile != "" {
+		if pgn, err = os.Create(*pgnFile); err != nil {
+			return err
+		}
+		defer pgn.Close()
+	}
+
+	fmt.Printf("%v vs %v, %v games, %v openings, time control %v\n", m.engines[0].name, m.engines[1].name, *games, len(openings), m.tc)
+	type finished struct {
+		game         *playedGame
+		engine1White bool
+		err          error
+	}
+	jobs, results := make(chan int), make(chan finished)
+	var wg sync.WaitGroup
+	for w := 0; w < *concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				// the two games of a pair play the same opening with the colors swapped
+				engine1White := i%2 == 0
+				white, black := m.engines[0], m.engines[1]
+				if !engine1White {
+					white, black = black, white
+				}
+				g, err := m.play(i+1, white, black, openings[(i/2)%len(openings)])
+				results <- finished{g, engine1White, err}
+			}
+		}()
+	}
+	stop := make(chan struct{})
+	go func() {
+		defer close(jobs)
+		for i := 0; i < *games; i++ {
+			select {
+			case jobs <- i:
+			case <-stop:
+				return
+			}
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	// no new games start once stopped, the ones being played are finished and counted
+	stopped := false
+	stopGames := func() {
+		if !stopped {
+			stopped = true
+			close(stop)
+		}
+	}
+	r := newResults()
+	decision := 0
+	var firstErr error
+	for f := range results {
+		if f.err != nil {
+			if firstErr == nil {
+				firstErr = f.err
+			}
+			stopGames()
+			continue
+		}
+		g := f.game
+		r.add((g.number-1)/2, g.engine1Score(f.engine1White))
+		fmt.Printf("Finished game %v (%v vs %v): %v {%v}\n", g.number, g.white, g.black, g.result, g.reason)
+		r.print(m.engines[0].name, m.engines[1].name, test)
+		if pgn != nil {
+			if err := writePGN(pgn, g, *event, m.tc); err != nil && firstErr == nil {
+				firstErr = err
+				stopGames()
+			}
+		}
+		if test != nil && decision == 0 {
+			if decision = test.decide(r); decision != 0 {
+				fmt.Println("SPRT decided, finishing the games being played")
+				stopGames()
+			}
+		}
+	}
+	if test != nil && r.games() > 0 {
+		switch decision {
+		case 1:
+			fmt.Printf("SPRT: H1 (elo %v) was accepted\n", test.elo1)
+		case -1:
+			fmt.Printf("SPRT: H0 (elo %v) was accepted\n", test.elo0)
+		default:
+			fmt.Println("SPRT: no decision")
+		}
+	}
+	return firstErr
+}
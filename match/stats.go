@@ -0,0 +1,145 @@
+package match
+
+import (
+	"fmt"
+	"math"
+)
+
+// results are the games of a match from the pov of the first engine. The two games of a pair play the same opening,
+// the pentanomial counts the pairs by their score of 0, 0.5, 1, 1.5 or 2 points
+type results struct {
+	wins   int
+	draws  int
+	losses int
+	halves map[int]float64 // score of the first game to finish of the pairs with one game left
+	ptnml  [5]int
+}
+
+func newResults() *results {
+	return &results{halves: map[int]float64{}}
+}
+
+func (r *results) add(pair int, score float64) {
+	switch score {
+	case 1:
+		r.wins++
+	case 0:
+		r.losses++
+	default:
+		r.draws++
+	}
+	first, ok := r.halves[pair]
+	if !ok {
+		r.halves[pair] = score
+		return
+	}
+	delete(r.halves, pair)
+	r.ptnml[int((first+score)*2)]++
+}
+
+func (r *results) pairs() int {
+	pairs := 0
+	for _, n := range r.ptnml {
+		pairs += n
+	}
+	return pairs
+}
+
+func (r *results) games() int {
+	return r.wins + r.draws + r.losses
+}
+
+func (r *results) score() float64 {
+	return (float64(r.wins) + float64(r.draws)/2) / float64(r.games())
+}
+
+// eloDiff is the logistic elo difference of a score
+func eloDiff(score float64) float64 {
+	return -400 * math.Log10(1/score-1)
+}
+
+// expectedScore is the score of an elo difference
+func expectedScore(elo float64) float64 {
+	return 1 / (1 + math.Pow(10, -elo/400))
+}
+
+// elo is the elo difference with the half width of its 95% confidence interval, from the variance of the game results
+func (r *results) elo() (float64, float64) {
+	n := float64(r.games())
+	s := r.score()
+	if s == 0 || s == 1 {
+		return eloDiff(s), math.Inf(1)
+	}
+	variance := (float64(r.wins)*math.Pow(1-s, 2) + float64(r.draws)*math.Pow(0.5-s, 2) + float64(r.losses)*math.Pow(s, 2)) / n
+	margin := 1.959964 * math.Sqrt(variance/n)
+	return eloDiff(s), (eloDiff(math.Min(s+margin, 1)) - eloDiff(math.Max(s-margin, 0))) / 2
+}
+
+// los is the likelihood of superiority, the chance the first engine is stronger, draws tell nothing about it
+func (r *results) los() float64 {
+	if r.wins+r.losses == 0 {
+		return 0.5
+	}
+	return 0.5 * (1 + math.Erf(float64(r.wins-r.losses)/math.Sqrt(2*float64(r.wins+r.losses))))
+}
+
+// sprt is a sequential probability ratio test of the hypotheses that the elo difference is elo0 (H0) or elo1 (H1),
+// with the false positive rate alpha and false negative rate beta
+type sprt struct {
+	elo0  float64
+	elo1  float64
+	alpha float64
+	beta  float64
+}
+
+// bounds are the log likelihood ratios that accept H0 (lower) or H1 (upper)
+func (t sprt) bounds() (float64, float64) {
+	return math.Log(t.beta / (1 - t.alpha)), math.Log((1 - t.beta) / t.alpha)
+}
+
+// llr is the log likelihood ratio of the pentanomial results, by the normal approximation of the pair scores.
+// Every count gets a small part of a pair so the variance isn't zero while all pairs scored the same
+func (t sprt) llr(r *results) float64 {
+	const regularization = 1e-3
+	if r.pairs() == 0 {
+		return 0
+	}
+	pairs, mean := 0.0, 0.0
+	for i, n := range r.ptnml {
+		pairs += float64(n) + regularization
+		mean += (float64(n) + regularization) * float64(i) / 4
+	}
+	mean /= pairs
+	variance := 0.0
+	for i, n := range r.ptnml {
+		variance += (float64(n) + regularization) * math.Pow(float64(i)/4-mean, 2)
+	}
+	variance /= pairs
+	s0, s1 := expectedScore(t.elo0), expectedScore(t.elo1)
+	return pairs * (s1 - s0) * (2*mean - s0 - s1) / (2 * variance)
+}
+
+// decide is 1 when H1 is accepted, -1 when H0 is and 0 while the test goes on
+func (t sprt) decide(r *results) int {
+	lower, upper := t.bounds()
+	llr := t.llr(r)
+	if llr >= upper {
+		return 1
+	} else if llr <= lower {
+		return -1
+	}
+	return 0
+}
+
+// print writes the score, elo, pentanomial and sprt state, test is nil without an sprt
+func (r *results) print(name1 string, name2 string, test *sprt) {
+	fmt.Printf("Score of %v vs %v: %v - %v - %v  [%.3f] %v\n", name1, name2, r.wins, r.losses, r.draws, r.score(), r.games())
+	elo, margin := r.elo()
+	fmt.Printf("Elo difference: %.1f +/- %.1f, LOS: %.1f %%, DrawRatio: %.1f %%\n", elo, margin, r.los()*100,
+		float64(r.draws)/float64(r.games())*100)
+	fmt.Printf("Ptnml(0-2): %v\n", r.ptnml)
+	if test != nil {
+		lower, upper := test.bounds()
+		fmt.Printf("SPRT: llr %.2f (%.2f, %.2f) [%.2f, %.2f]\n", test.llr(r), lower, upper, test.elo0, test.elo1)
+	}
+}
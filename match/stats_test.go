@@ -0,0 +1,124 @@
+package match
+
+import (
+	"math"
+	"testing"
+)
+
+func near(got float64, want float64, tolerance float64) bool {
+	return math.Abs(got-want) <= tolerance
+}
+
+// resultsOf are results with the counts of the games and the pentanomial set directly
+func resultsOf(wins int, draws int, losses int, ptnml [5]int) *results {
+	r := newResults()
+	r.wins, r.draws, r.losses, r.ptnml = wins, draws, losses, ptnml
+	return r
+}
+
+func TestEloDiff(t *testing.T) {
+	tests := []struct {
+		score float64
+		elo   float64
+	}{
+		{0.5, 0},
+		{0.6, 70.437},
+		{0.75, 190.849},
+		{0.25, -190.849},
+		{10.0 / 11, 400},
+	}
+	for _, test := range tests {
+		if elo := eloDiff(test.score); !near(elo, test.elo, 1e-3) {
+			t.Errorf("eloDiff(%v) = %v, want %v", test.score, elo, test.elo)
+		}
+		if score := expectedScore(test.elo); !near(score, test.score, 1e-5) {
+			t.Errorf("expectedScore(%v) = %v, want %v", test.elo, score, test.score)
+		}
+	}
+}
+
+func TestElo(t *testing.T) {
+	// 100 wins, 100 draws and 50 losses score 60%, the variance of a game is 0.14
+	elo, margin := resultsOf(100, 100, 50, [5]int{}).elo()
+	if !near(elo, 70.437, 1e-3) || !near(margin, 33.690, 1e-3) {
+		t.Errorf("elo %v +/- %v, want 70.437 +/- 33.690", elo, margin)
+	}
+	elo, margin = resultsOf(10, 0, 10, [5]int{}).elo()
+	if elo != 0 || !near(margin, 163.321, 1e-3) {
+		t.Errorf("elo %v +/- %v of an even score, want 0 +/- 163.3", elo, margin)
+	}
+	if _, margin := resultsOf(5, 0, 0, [5]int{}).elo(); !math.IsInf(margin, 1) {
+		t.Errorf("margin %v of a perfect score, want +Inf", margin)
+	}
+}
+
+func TestLOS(t *testing.T) {
+	tests := []struct {
+		wins   int
+		draws  int
+		losses int
+		los    float64
+	}{
+		{0, 10, 0, 0.5},
+		{30, 5, 30, 0.5},
+		{60, 100, 40, 0.977250}, // 2 standard deviations
+		{40, 100, 60, 0.022750},
+		{58, 0, 42, 0.945201}, // 1.6 standard deviations
+	}
+	for _, test := range tests {
+		if los := resultsOf(test.wins, test.draws, test.losses, [5]int{}).los(); !near(los, test.los, 1e-6) {
+			t.Errorf("los of +%v =%v -%v is %v, want %v", test.wins, test.draws, test.losses, los, test.los)
+		}
+	}
+}
+
+func TestPentanomial(t *testing.T) {
+	r := newResults()
+	// the games of the pairs finish out of order, a pair counts once both its games have
+	r.add(0, 1)
+	r.add(1, 0)
+	r.add(2, 0.5)
+	r.add(0, 0.5)
+	r.add(1, 0)
+	r.add(3, 1)
+	r.add(3, 1)
+	r.add(2, 0.5)
+	if want := [5]int{1, 0, 1, 1, 1}; r.ptnml != want {
+		t.Errorf("ptnml %v, want %v", r.ptnml, want)
+	}
+	r.add(4, 0)
+	if r.wins != 3 || r.draws != 3 || r.losses != 3 || r.games() != 9 {
+		t.Errorf("+%v =%v -%v in %v games, want +3 =3 -3 in 9", r.wins, r.draws, r.losses, r.games())
+	}
+	if r.pairs() != 4 || len(r.halves) != 1 {
+		t.Errorf("%v pairs with %v unfinished, want 4 with 1", r.pairs(), len(r.halves))
+	}
+}
+
+func TestSPRT(t *testing.T) {
+	test := sprt{elo0: 0, elo1: 5, alpha: 0.05, beta: 0.05}
+	lower, upper := test.bounds()
+	if !near(lower, -2.944439, 1e-6) || !near(upper, 2.944439, 1e-6) {
+		t.Errorf("bounds (%v, %v), want (-2.94, 2.94)", lower, upper)
+	}
+	tests := []struct {
+		ptnml  [5]int
+		llr    float64
+		decide int
+	}{
+		{[5]int{}, 0, 0},
+		{[5]int{10, 20, 40, 20, 10}, -0.034513, 0},
+		{[5]int{5, 20, 40, 30, 15}, 0.738478, 0},
+		{[5]int{0, 0, 10, 0, 0}, -4.145679, -1}, // all the pairs drawn, the regularization keeps the variance above zero
+		{[5]int{20, 150, 400, 250, 40}, 5.117888, 1},
+	}
+	for _, tt := range tests {
+		r := resultsOf(0, 0, 0, tt.ptnml)
+		if llr := test.llr(r); !near(llr, tt.llr, 1e-5) {
+			t.Errorf("llr of %v is %v, want %v", tt.ptnml, llr, tt.llr)
+		}
+		if decide := test.decide(r); decide != tt.decide {
+			t.Errorf("decide of %v is %v, want %v", tt.ptnml, decide, tt.decide)
+		}
+	}
+}
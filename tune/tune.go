@@ -0,0 +1,203 @@
+package tune
+
+import (
+	"bufio"
+	"chess/engine"
+	"chess/game"
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+type position struct {
+	state  *game.State
+	result float64 // 1 white won, 0.5 draw, 0 black won
+}
+
+var (
+	// c9 "1-0"; or [1.0] or a plain result after the fen
+	resultRegexp *regexp.Regexp     = regexp.MustCompile(`(1-0|0-1|1/2-1/2|\[1\.0\]|\[0\.5\]|\[0\.0\]|\[1\]|\[0\])`)
+	resultValues map[string]float64 = map[string]float64{"1-0": 1, "[1.0]": 1, "[1]": 1, "0-1": 0, "[0.0]": 0, "[0]": 0, "1/2-1/2": 0.5, "[0.5]": 0.5}
+)
+
+// loadPositions reads an epd file of quiet positions, each line is a fen followed by the game result
+func loadPositions(path string, limit int) ([]position, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	positions := []position{}
+	scanner := bufio.NewScanner(file)
+	lineNum := 0
+	for scanner.Scan() && (limit <= 0 || len(positions) < limit) {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		result := ""
+		if len(fields) > 4 {
+			result = resultRegexp.FindString(strings.Join(fields[4:], " "))
+		}
+		if result == "" {
+			return nil, fmt.Errorf("%v:%v: expected a fen followed by a result", path, lineNum)
+		}
+		state, err := game.NewStateFromFEN(strings.Join(fields[:4], " "))
+		if err != nil {
+			return nil, fmt.Errorf("%v:%v: %v", path, lineNum, err)
+		}
+		positions = append(positions, position{state, resultValues[result]})
+	}
+	return positions, scanner.Err()
+}
+
+// sigmoid maps a centipawn evaluation to a win probability
+func sigmoid(k float64, ev float64) float64 {
+	return 1 / (1 + math.Pow(10, -k*ev/400))
+}
+
+// meanError is the mean squared difference between the game results and the evaluations mapped to a win probability
+func meanError(positions []position, k float64) float64 {
+	numWorkers := runtime.NumCPU()
+	errs := make([]float64, numWorkers)
+	var wg sync.WaitGroup
+	for w := 0; w < numWorkers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := w; i < len(positions); i += numWorkers {
+				diff := positions[i].result - sigmoid(k, float64(engine.Evaluate(positions[i].state)))
+				errs[w] += diff * diff
+			}
+		}(w)
+	}
+	wg.Wait()
+	total := 0.0
+	for _, e := range errs {
+		total += e
+	}
+	return total / float64(len(positions))
+}
+
+// findK scales the sigmoid to the current weights so that tuning only changes the weights relative to each other
+func findK(positions []position) float64 {
+	best, bestErr := 0.0, math.Inf(1)
+	lo, hi := 0.1, 5.0
+	for step := 0.1; step >= 0.001; step /= 10 {
+		for k := lo; k <= hi; k += step {
+			if e := meanError(positions, k); e < bestErr {
+				best, bestErr = k, e
+			}
+		}
+		lo, hi = math.Max(best-step, step/10), best+step
+	}
+	return best
+}
+
+// localSearch is the texel method: try moving every weight by a step and keep the changes that lower the error
+func localSearch(positions []position, k float64, params *engine.Params, step int, iterations int, out string) error {
+	weights := params.Weights()
+	bestErr := meanError(positions, k)
+	for iter := 1; iterations <= 0 || iter <= iterations; iter++ {
+		improved := false
+		for _, w := range weights {
+			for _, delta := range []int{step, -step} {
+				w.Set(w.Get() + delta)
+				if e := meanError(positions, k); e < bestErr {
+					bestErr = e
+					improved = true
+					break
+				}
+				w.Set(w.Get() - delta)
+			}
+		}
+		fmt.Printf("iteration: %v, error: %v\n", iter, bestErr)
+		if err := params.Save(out); err != nil {
+			return err
+		}
+		if !improved {
+			break
+		}
+	}
+	return nil
+}
+
+// gradientDescent moves all the weights along the error gradient, estimated by central differences.
+// The weights are whole centipawns so the fractional part of every update is kept on the side
+func gradientDescent(positions []position, k float64, params *engine.Params, step int, rate float64, iterations int, out string) error {
+	weights := params.Weights()
+	grad := make([]float64, len(weights))
+	values := make([]float64, len(weights))
+	for i, w := range weights {
+		values[i] = float64(w.Get())
+	}
+	if iterations <= 0 {
+		iterations = 100
+	}
+	for iter := 1; iter <= iterations; iter++ {
+		for i, w := range weights {
+			orig := w.Get()
+			w.Set(orig + step)
+			plus := meanError(positions, k)
+			w.Set(orig - step)
+			minus := meanError(positions, k)
+			w.Set(orig)
+			grad[i] = (plus - minus) / (2 * float64(step))
+		}
+		for i, w := range weights {
+			values[i] -= rate * grad[i]
+			w.Set(int(math.Round(values[i])))
+		}
+		fmt.Printf("iteration: %v, error: %v\n", iter, meanError(positions, k))
+		if err := params.Save(out); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Run is the tune command: chess tune [flags] <dataset.epd> <out.json>
+func Run(args []string) error {
+	flags := flag.NewFlagSet("tune", flag.ContinueOnError)
+	method := flags.String("method", "local", "optimization method, local or gradient")
+	iterations := flags.Int("iterations", 0, "maximum number of iterations, 0 runs local search until no weight improves")
+	limit := flags.Int("limit", 0, "maximum number of positions to load, 0 loads all")
+	step := flags.Int("step", 1, "change of a weight tried by local search and used for the gradient estimate, in centipawns")
+	rate := flags.Float64("rate", 100000, "learning rate of gradient descent")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 2 {
+		return errors.New("usage: chess tune [flags] <dataset.epd> <out.json>")
+	}
+	positions, err := loadPositions(flags.Arg(0), *limit)
+	if err != nil {
+		return err
+	}
+	if len(positions) == 0 {
+		return fmt.Errorf("%v: no positions", flags.Arg(0))
+	}
+	params, err := engine.GetParams().Copy()
+	if err != nil {
+		return err
+	}
+	engine.SetParams(params)
+	k := findK(positions)
+	fmt.Printf("positions: %v, weights: %v, k: %v, error: %v\n", len(positions), len(params.Weights()), k, meanError(positions, k))
+	switch *method {
+	case "local":
+		return localSearch(positions, k, params, *step, *iterations, flags.Arg(1))
+	case "gradient":
+		return gradientDescent(positions, k, params, *step, *rate, *iterations, flags.Arg(1))
+	default:
+		return fmt.Errorf("unknown method %v", *method)
+	}
+}
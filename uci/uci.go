@@ -0,0 +1,292 @@
+package uci
+
+import (
+	"bufio"
+	"chess/engine"
+	"chess/game"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// session is the state of the protocol between the commands, searches run in the background so stop can end them
+type session struct {
+	out    io.Writer
+	outMu  sync.Mutex
+	state  *game.State
+	player game.Player
+	stop   chan struct{} // closed to end the running search
+	ponder chan struct{} // closed on ponderhit, nil unless the running search ponders
+	done   chan struct{} // closed once the running search sent its best move
+}
+
+// Run speaks the uci protocol, reading commands from in and answering on out until quit or the end of in
+func Run(in io.Reader, out io.Writer) error {
+	u := &session{out: out, state: game.NewStartState(game.White), player: game.White}
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		var err error
+		switch fields[0] {
+		case "uci":
+			u.sendID()
+		case "isready":
+			u.send("readyok")
+		case "setoption":
+			u.stopSearch()
+			err = setOption(fields[1:])
+		case "ucinewgame":
+			u.stopSearch()
+			engine.NewGame()
+		case "position":
+			u.stopSearch()
+			err = u.position(fields[1:])
+		case "go":
+			u.stopSearch()
+			err = u.think(fields[1:])
+		case "ponderhit":
+			if u.ponder != nil {
+				close(u.ponder)
+				u.ponder = nil
+			}
+		case "stop":
+			u.stopSearch()
+		case "quit":
+			u.stopSearch()
+			return nil
+		}
+		if err != nil {
+			u.send("info string %v", err)
+		}
+	}
+	u.stopSearch()
+	return scanner.Err()
+}
+
+func (u *session) send(format string, a ...any) {
+	u.outMu.Lock()
+	defer u.outMu.Unlock()
+	fmt.Fprintf(u.out, format+"\n", a...)
+}
+
+func (u *session) sendID() {
+	d := engine.DefaultOptions
+	u.send("id name chess")
+	u.send("id author chess contributors")
+	u.send("option name Ponder type check default false")
+	u.send("option name Threads type spin default %v min 1 max 512", d.Threads)
+	u.send("option name Hash type spin default %v min 1 max 65536", d.HashMB)
+	u.send("option name MultiPV type spin default %v min 1 max %v", d.MultiPV, engine.MaxMultiPV)
+	u.send("option name MoveTime type spin default %v min 1 max 3600000", d.MoveTime.Milliseconds())
+	u.send("option name ParamFile type string default <empty>")
+	u.send("option name Use NNUE type check default %v", d.UseNNUE)
+	u.send("option name EvalFile type string default <empty>")
+	u.send("option name BookFile type string default <empty>")
+	u.send("option name BookDepth type spin default %v min 0 max 1000", d.BookDepth)
+	u.send("option name BookVariety type spin default %v min 0 max 100", d.BookVariety)
+	u.send("option name SyzygyPath type string default <empty>")
+	u.send("option name SyzygyProbeDepth type spin default %v min 1 max 100", d.SyzygyProbeDepth)
+	u.send("option name Syzygy50MoveRule type check default %v", d.Syzygy50MoveRule)
+	u.send("option name Skill Level type spin default %v min 1 max %v", d.SkillLevel, engine.MaxSkill)
+	u.send("option name UCI_LimitStrength type check default %v", d.LimitStrength)
+	u.send("option name UCI_Elo type spin default %v min %v max %v", d.Elo, engine.MinElo, engine.MaxElo)
+	personalities := []string{}
+	for _, p := range engine.Personalities {
+		personalities = append(personalities, "var "+p.Name)
+	}
+	u.send("option name Personality type combo default %v %v", d.Personality, strings.Join(personalities, " "))
+	u.send("uciok")
+}
+
+// setOption handles "name <name> value <value>", both can have spaces
+func setOption(args []string) error {
+	text := strings.Join(args, " ")
+	if !strings.HasPrefix(text, "name ") {
+		return fmt.Errorf("setoption without a name")
+	}
+	name, value, _ := strings.Cut(strings.TrimPrefix(text, "name "), " value ")
+	if value == "<empty>" {
+		value = ""
+	}
+	if strings.EqualFold(strings.TrimSpace(name), "ponder") { // only tells if the gui will send go ponder
+		return nil
+	}
+	return engine.SetOption(strings.TrimSpace(name), strings.TrimSpace(value))
+}
+
+// position handles "startpos|fen <fen> [moves <move>...]", the moves stop at the first one that can't be played
+func (u *session) position(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("position without a position")
+	}
+	var state *game.State
+	i := 1
+	switch args[0] {
+	case "startpos":
+		state = game.NewStartState(game.White)
+	case "fen":
+		for i < len(args) && args[i] != "moves" {
+			i++
+		}
+		var err error
+		if state, err = game.NewStateFromFEN(strings.Join(args[1:i], " ")); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown position %q", args[0])
+	}
+	u.state, u.player = state, state.Turn
+	if i < len(args) && args[i] == "moves" {
+		for _, s := range args[i+1:] {
+			m, err := u.state.ParseUCIMove(s, u.player)
+			if err != nil {
+				return err
+			}
+			u.state.RunMove(m)
+			u.player = (u.player + 1) % 2
+			u.state.Turn = u.player
+		}
+	}
+	return nil
+}
+
+// parseGo reads the limits of a go command and if it ponders, the clock is the one of player
+func parseGo(args []string, player game.Player) (engine.Limits, bool, error) {
+	limits := engine.Limits{}
+	ponder := false
+	clock := map[string]game.Player{"wtime": game.White, "btime": game.Black, "winc": game.White, "binc": game.Black}
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "infinite":
+			limits.Infinite = true
+			continue
+		case "ponder":
+			ponder = true
+			continue
+		case "wtime", "btime", "winc", "binc", "movestogo", "depth", "nodes", "movetime":
+		default:
+			continue
+		}
+		if i+1 == len(args) {
+			return limits, false, fmt.Errorf("go %v without a value", args[i])
+		}
+		n, err := strconv.Atoi(args[i+1])
+		if err != nil {
+			return limits, false, err
+		}
+		ms := time.Duration(n) * time.Millisecond
+		switch args[i] {
+		case "wtime", "btime":
+			if clock[args[i]] == player {
+				limits.Time = ms
+			}
+		case "winc", "binc":
+			if clock[args[i]] == player {
+				limits.Increment = ms
+			}
+		case "movestogo":
+			limits.MovesToGo = n
+		case "depth":
+			limits.Depth = n
+		case "nodes":
+			limits.Nodes = uint64(n)
+		case "movetime":
+			limits.MoveTime = ms
+		}
+		i++
+	}
+	return limits, ponder, nil
+}
+
+// think starts the search of a go command, it sends the best move when done. Searching infinitely it waits for stop
+// and pondering for stop or ponderhit, even if the search ends early
+func (u *session) think(args []string) error {
+	limits, ponder, err := parseGo(args, u.player)
+	if err != nil {
+		return err
+	}
+	state, player := u.state.Copy(), u.player
+	stop, done := make(chan struct{}), make(chan struct{})
+	u.stop, u.done = stop, done
+	limits.Stop = stop
+	var ponderHit chan struct{}
+	if ponder {
+		ponderHit = make(chan struct{})
+		u.ponder = ponderHit
+		limits.Ponder = ponderHit
+	}
+	go func() {
+		defer close(done)
+		var best, reply *game.Move
+		source := ""
+		if !limits.Infinite && engine.GetOptions().MultiPV == 1 {
+			best, source = engine.RootProbe(state, player)
+		}
+		if best != nil {
+			u.send("info string %v move", source)
+		} else {
+			lines := engine.Think(state, player, limits, func(info engine.Info) {
+				u.sendInfo(state, info)
+			})
+			if len(lines) > 0 {
+				best = &lines[0].Move
+				if len(lines[0].PV) > 1 {
+					reply = &lines[0].PV[1]
+				}
+			}
+		}
+		if limits.Infinite {
+			<-stop
+		} else if ponder {
+			select {
+			case <-stop:
+			case <-ponderHit:
+			}
+		}
+		if best == nil {
+			u.send("bestmove 0000")
+		} else if reply != nil {
+			u.send("bestmove %v ponder %v", state.UCIMove(*best), state.UCIMove(*reply))
+		} else {
+			u.send("bestmove %v", state.UCIMove(*best))
+		}
+	}()
+	return nil
+}
+
+func (u *session) stopSearch() {
+	if u.done == nil {
+		return
+	}
+	close(u.stop)
+	<-u.done
+	u.stop, u.ponder, u.done = nil, nil, nil
+}
+
+func (u *session) sendInfo(state *game.State, info engine.Info) {
+	var nps uint64 // the first depths can take no measurable time
+	if info.Time > 0 {
+		nps = uint64(float64(info.Nodes) / info.Time.Seconds())
+	}
+	for i, line := range info.Lines {
+		pv := make([]string, len(line.PV))
+		for j, m := range line.PV {
+			pv[j] = state.UCIMove(m)
+		}
+		u.send("info depth %v multipv %v score %v nodes %v nps %v time %v pv %v", info.Depth, i+1, scoreString(line.Score),
+			info.Nodes, nps, info.Time.Milliseconds(), strings.Join(pv, " "))
+	}
+}
+
+func scoreString(score int) string {
+	if n, ok := engine.MateIn(score); ok {
+		return fmt.Sprintf("mate %v", n)
+	}
+	return fmt.Sprintf("cp %v", score)
+}